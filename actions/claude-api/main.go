@@ -2,7 +2,10 @@ package main
 
 import (
 	"bytes"
+	"context"
+	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -13,6 +16,12 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+// manifest is the action manifest, with the schemas of ActionInput and
+// ActionOutput
+//
+//go:embed claude-api.action.yaml
+var manifest []byte
+
 // ActionInput represents the input structure for the claude-api action
 type ActionInput struct {
 	APIKey       string  `yaml:"api_key,omitempty"`       // Claude API key (can also be set via CLAUDE_API_KEY env var)
@@ -30,14 +39,14 @@ type ActionOutput struct {
 	Message  string `yaml:"message"`
 	Response string `yaml:"response,omitempty"` // Claude's response
 	Model    string `yaml:"model,omitempty"`    // Model used
-	Usage    Usage  `json:"usage,omitempty"`    // Token usage information
-	Error    string `json:"error,omitempty"`
+	Usage    Usage  `yaml:"usage,omitempty"`    // Token usage information
+	Error    string `yaml:"error,omitempty"`
 }
 
 // Usage represents token usage information from Claude API
 type Usage struct {
-	InputTokens  int `json:"input_tokens"`
-	OutputTokens int `json:"output_tokens"`
+	InputTokens  int `json:"input_tokens" yaml:"input_tokens"`
+	OutputTokens int `json:"output_tokens" yaml:"output_tokens"`
 }
 
 // ClaudeMessage represents a message in the Claude API format
@@ -80,6 +89,19 @@ type ClaudeErrorResponse struct {
 }
 
 func main() {
+	// The manifest documents the input and output
+	if len(os.Args) > 1 && os.Args[1] == "--describe" {
+		os.Stdout.Write(manifest)
+		return
+	}
+
+	// The orchestrator starts actions declaring a worker in their manifest
+	// with the protocol to speak
+	if os.Getenv("OCTA_ACTION_PROTOCOL") == "ndjson" {
+		serveWorker()
+		return
+	}
+
 	// Read YAML input from stdin
 	inputData, err := io.ReadAll(os.Stdin)
 	if err != nil {
@@ -93,10 +115,39 @@ func main() {
 		return
 	}
 
+	output, err := generate(context.Background(), input)
+	var failed *failure
+	if errors.As(err, &failed) {
+		sendErrorResponse(failed.Message, failed.Detail)
+		return
+	}
+
+	outputYAML, err := yaml.Marshal(output)
+	if err != nil {
+		log.Printf("Failed to marshal output: %v", err)
+		os.Exit(1)
+	}
+	fmt.Print(string(outputYAML))
+
+	log.Printf("Request completed successfully. Input tokens: %d, Output tokens: %d", output.Usage.InputTokens, output.Usage.OutputTokens)
+}
+
+// failure is an error reported in the output's message and error fields
+type failure struct {
+	Message string
+	Detail  string
+}
+
+func (f *failure) Error() string {
+	return f.Message + ": " + f.Detail
+}
+
+// generate sends the prompt to the Claude API. Requests share the default
+// transport, so a worker reuses its connections.
+func generate(ctx context.Context, input ActionInput) (ActionOutput, error) {
 	// Validate required fields
 	if input.Prompt == "" {
-		sendErrorResponse("Missing required field", "prompt is required")
-		return
+		return ActionOutput{}, &failure{"Missing required field", "prompt is required"}
 	}
 
 	// Get API key from input or environment variable
@@ -105,8 +156,7 @@ func main() {
 		apiKey = os.Getenv("CLAUDE_API_KEY")
 	}
 	if apiKey == "" {
-		sendErrorResponse("Missing API key", "api_key must be provided in input or CLAUDE_API_KEY environment variable must be set")
-		return
+		return ActionOutput{}, &failure{"Missing API key", "api_key must be provided in input or CLAUDE_API_KEY environment variable must be set"}
 	}
 
 	// Set defaults
@@ -156,8 +206,7 @@ func main() {
 	// Marshal request to JSON
 	requestBody, err := json.Marshal(claudeReq)
 	if err != nil {
-		sendErrorResponse("Failed to marshal request", err.Error())
-		return
+		return ActionOutput{}, &failure{"Failed to marshal request", err.Error()}
 	}
 
 	// Create HTTP client with timeout
@@ -166,10 +215,9 @@ func main() {
 	}
 
 	// Create HTTP request
-	req, err := http.NewRequest("POST", "https://api.anthropic.com/v1/messages", bytes.NewBuffer(requestBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.anthropic.com/v1/messages", bytes.NewBuffer(requestBody))
 	if err != nil {
-		sendErrorResponse("Failed to create HTTP request", err.Error())
-		return
+		return ActionOutput{}, &failure{"Failed to create HTTP request", err.Error()}
 	}
 
 	// Set headers
@@ -182,34 +230,29 @@ func main() {
 	// Execute the request
 	resp, err := client.Do(req)
 	if err != nil {
-		sendErrorResponse("Failed to execute request to Claude API", err.Error())
-		return
+		return ActionOutput{}, &failure{"Failed to execute request to Claude API", err.Error()}
 	}
 	defer resp.Body.Close()
 
 	// Read response body
 	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
-		sendErrorResponse("Failed to read response body", err.Error())
-		return
+		return ActionOutput{}, &failure{"Failed to read response body", err.Error()}
 	}
 
 	// Check for API errors
 	if resp.StatusCode != http.StatusOK {
 		var errorResp ClaudeErrorResponse
 		if err := json.Unmarshal(bodyBytes, &errorResp); err != nil {
-			sendErrorResponse("Claude API error", fmt.Sprintf("Status: %d, Body: %s", resp.StatusCode, string(bodyBytes)))
-			return
+			return ActionOutput{}, &failure{"Claude API error", fmt.Sprintf("Status: %d, Body: %s", resp.StatusCode, string(bodyBytes))}
 		}
-		sendErrorResponse("Claude API error", fmt.Sprintf("Status: %d, Type: %s, Message: %s", resp.StatusCode, errorResp.Error.Type, errorResp.Error.Message))
-		return
+		return ActionOutput{}, &failure{"Claude API error", fmt.Sprintf("Status: %d, Type: %s, Message: %s", resp.StatusCode, errorResp.Error.Type, errorResp.Error.Message)}
 	}
 
 	// Parse Claude response
 	var claudeResp ClaudeResponse
 	if err := json.Unmarshal(bodyBytes, &claudeResp); err != nil {
-		sendErrorResponse("Failed to parse Claude response", err.Error())
-		return
+		return ActionOutput{}, &failure{"Failed to parse Claude response", err.Error()}
 	}
 
 	// Extract response text
@@ -220,23 +263,13 @@ func main() {
 		responseText = "No text content in response"
 	}
 
-	// Send success response
-	output := ActionOutput{
+	return ActionOutput{
 		Success:  true,
 		Message:  fmt.Sprintf("Successfully generated response using %s", claudeResp.Model),
 		Response: responseText,
 		Model:    claudeResp.Model,
 		Usage:    claudeResp.Usage,
-	}
-
-	outputYAML, err := yaml.Marshal(output)
-	if err != nil {
-		log.Printf("Failed to marshal output: %v", err)
-		os.Exit(1)
-	}
-	fmt.Print(string(outputYAML))
-
-	log.Printf("Request completed successfully. Input tokens: %d, Output tokens: %d", claudeResp.Usage.InputTokens, claudeResp.Usage.OutputTokens)
+	}, nil
 }
 
 func sendErrorResponse(message, errorDetail string) {
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// workerRequest is a request frame of the orchestrator's NDJSON worker
+// protocol. A request with cancel set abandons the request with its id.
+type workerRequest struct {
+	ID     string `json:"id"`
+	Input  string `json:"input,omitempty"`
+	Cancel bool   `json:"cancel,omitempty"`
+}
+
+// workerResponse is a response frame; the first frame only names the protocol
+type workerResponse struct {
+	ID       string `json:"id,omitempty"`
+	Output   string `json:"output,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
+}
+
+// serveWorker answers requests from stdin until it is closed. Requests run
+// concurrently and share their HTTP connections to the API.
+func serveWorker() {
+	var writeMu sync.Mutex
+	encoder := json.NewEncoder(os.Stdout)
+	respond := func(resp workerResponse) {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		if err := encoder.Encode(resp); err != nil {
+			log.Printf("Failed to write response: %v", err)
+		}
+	}
+	respond(workerResponse{Protocol: "ndjson"})
+
+	var (
+		mu      sync.Mutex
+		cancels = make(map[string]context.CancelFunc)
+		wg      sync.WaitGroup
+	)
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		var req workerRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			log.Printf("Ignoring invalid request frame: %v", err)
+			continue
+		}
+
+		if req.Cancel {
+			mu.Lock()
+			if cancel := cancels[req.ID]; cancel != nil {
+				cancel()
+			}
+			mu.Unlock()
+			continue
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		mu.Lock()
+		cancels[req.ID] = cancel
+		mu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			respond(handleRequest(ctx, req))
+
+			mu.Lock()
+			delete(cancels, req.ID)
+			mu.Unlock()
+			cancel()
+		}()
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("Failed to read requests: %v", err)
+	}
+	wg.Wait()
+}
+
+// handleRequest runs one request the way a one-shot invocation would
+func handleRequest(ctx context.Context, req workerRequest) workerResponse {
+	var input ActionInput
+	if err := yaml.Unmarshal([]byte(req.Input), &input); err != nil {
+		return workerResponse{ID: req.ID, Error: "Failed to parse YAML input: " + err.Error()}
+	}
+
+	output, err := generate(ctx, input)
+	if err != nil {
+		return workerResponse{ID: req.ID, Error: err.Error()}
+	}
+
+	outputYAML, err := yaml.Marshal(output)
+	if err != nil {
+		return workerResponse{ID: req.ID, Error: "Failed to marshal output: " + err.Error()}
+	}
+	log.Printf("Request %s completed successfully. Input tokens: %d, Output tokens: %d", req.ID, output.Usage.InputTokens, output.Usage.OutputTokens)
+	return workerResponse{ID: req.ID, Output: string(outputYAML)}
+}
@@ -0,0 +1,38 @@
+// Package echojson implements the echo-json action. The echo-json binary and
+// the orchestrator, which runs it in-process, share it.
+package echojson
+
+import (
+	_ "embed"
+	"errors"
+)
+
+// Manifest is the action manifest, with the schemas of Input and Output
+//
+//go:embed echo-json.action.yaml
+var Manifest []byte
+
+// Input represents the expected input structure
+type Input struct {
+	Message string `yaml:"message"`
+	Prefix  string `yaml:"prefix,omitempty"`
+}
+
+// Output represents the output structure
+type Output struct {
+	EchoedMessage string      `yaml:"echoed_message"`
+	OriginalInput interface{} `yaml:"original_input"`
+}
+
+// Run echoes the input message behind its prefix
+func Run(input Input) (Output, error) {
+	// Validate required fields
+	if input.Message == "" {
+		return Output{}, errors.New("Missing required field: message")
+	}
+
+	return Output{
+		EchoedMessage: input.Prefix + input.Message,
+		OriginalInput: input,
+	}, nil
+}
@@ -5,21 +5,10 @@ import (
 	"io"
 	"os"
 
+	"github.com/octo-agent/go-ai-agent-v1/actions/echo-json/echojson"
 	"gopkg.in/yaml.v3"
 )
 
-// EchoInput represents the expected input structure
-type EchoInput struct {
-	Message string `yaml:"message"`
-	Prefix  string `yaml:"prefix,omitempty"`
-}
-
-// EchoOutput represents the output structure
-type EchoOutput struct {
-	EchoedMessage string      `yaml:"echoed_message"`
-	OriginalInput interface{} `yaml:"original_input"`
-}
-
 // ErrorOutput represents error response structure
 type ErrorOutput struct {
 	Error           string      `yaml:"error"`
@@ -27,6 +16,12 @@ type ErrorOutput struct {
 }
 
 func main() {
+	// The manifest documents the input and output
+	if len(os.Args) > 1 && os.Args[1] == "--describe" {
+		os.Stdout.Write(echojson.Manifest)
+		return
+	}
+
 	// Read YAML input from stdin
 	inputData, err := io.ReadAll(os.Stdin)
 	if err != nil {
@@ -35,32 +30,18 @@ func main() {
 	}
 
 	// Parse input YAML
-	var input EchoInput
+	var input echojson.Input
 	if err := yaml.Unmarshal(inputData, &input); err != nil {
 		outputError("Invalid input YAML format", string(inputData))
 		return
 	}
 
-	// Validate required fields
-	if input.Message == "" {
-		outputError("Missing required field: message", input)
+	output, err := echojson.Run(input)
+	if err != nil {
+		outputError(err.Error(), input)
 		return
 	}
 
-	// Process the echo operation
-	prefix := input.Prefix
-	if prefix == "" {
-		prefix = ""
-	}
-
-	echoedMessage := prefix + input.Message
-
-	// Create output
-	output := EchoOutput{
-		EchoedMessage: echoedMessage,
-		OriginalInput: input,
-	}
-
 	// Marshal and output result
 	outputYAML, err := yaml.Marshal(output)
 	if err != nil {
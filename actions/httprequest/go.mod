@@ -2,4 +2,9 @@ module github.com/octo-agent/go-ai-agent-v1/actions/httprequest
 
 go 1.19
 
-require gopkg.in/yaml.v3 v3.0.1
+require (
+	github.com/octo-agent/go-ai-agent-v1/actions/permissions v0.0.0-00010101000000-000000000000
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+replace github.com/octo-agent/go-ai-agent-v1/actions/permissions => ../permissions
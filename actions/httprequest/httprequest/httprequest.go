@@ -0,0 +1,212 @@
+// Package httprequest implements the httprequest action. The httprequest
+// binary and the orchestrator, which runs it in-process, share it.
+package httprequest
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/octo-agent/go-ai-agent-v1/actions/permissions"
+)
+
+// Manifest is the action manifest, with the schemas of Input and Output
+//
+//go:embed httprequest.action.yaml
+var Manifest []byte
+
+// Input represents the input structure for the httprequest action
+type Input struct {
+	URL     string            `yaml:"url"`
+	Method  string            `yaml:"method,omitempty"` // Default: GET
+	Headers map[string]string `yaml:"headers,omitempty"`
+	Body    string            `yaml:"body,omitempty"`
+	Timeout int               `yaml:"timeout,omitempty"` // Timeout in seconds, default: 30
+}
+
+// Output represents the output structure for the httprequest action
+type Output struct {
+	Success    bool              `yaml:"success"`
+	Message    string            `yaml:"message"`
+	StatusCode int               `yaml:"status_code,omitempty"`
+	Headers    map[string]string `yaml:"headers,omitempty"`
+	Body       string            `yaml:"body,omitempty"`
+	Error      string            `yaml:"error,omitempty"`
+}
+
+// Error is a failure reported as the message and error of the output
+type Error struct {
+	Message string
+	Detail  string
+}
+
+func (e *Error) Error() string {
+	return e.Message + ": " + e.Detail
+}
+
+// Run sends the request until ctx is done. lookupEnv reads the action's
+// environment. A positive maxBodyBytes bounds the response body read into
+// memory: a longer body is cut to that size if truncate is set, and fails
+// the request otherwise.
+func Run(ctx context.Context, input Input, lookupEnv func(string) (string, bool), maxBodyBytes int64, truncate bool) (Output, error) {
+	// Validate required fields
+	if input.URL == "" {
+		return Output{}, &Error{"Missing required field", "url is required"}
+	}
+
+	// Set defaults
+	if input.Method == "" {
+		input.Method = "GET"
+	}
+	if input.Timeout == 0 {
+		input.Timeout = 30
+	}
+
+	// Validate HTTP method
+	validMethods := map[string]bool{
+		"GET":     true,
+		"POST":    true,
+		"PUT":     true,
+		"DELETE":  true,
+		"PATCH":   true,
+		"HEAD":    true,
+		"OPTIONS": true,
+	}
+	method := strings.ToUpper(input.Method)
+	if !validMethods[method] {
+		return Output{}, &Error{"Invalid HTTP method", fmt.Sprintf("method must be one of: GET, POST, PUT, DELETE, PATCH, HEAD, OPTIONS, got: %s", input.Method)}
+	}
+
+	// Refuse hosts outside the workflow's url_hosts, including on redirects
+	allowed, err := permissions.Load(lookupEnv)
+	if err != nil {
+		return Output{}, &Error{"Permission denied by workflow policy", err.Error()}
+	}
+	if err := checkURLPermission(allowed, input.URL); err != nil {
+		return Output{}, &Error{"Permission denied by workflow policy", err.Error()}
+	}
+
+	// Create HTTP client with timeout
+	client := &http.Client{
+		Timeout: time.Duration(input.Timeout) * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return checkURLPermission(allowed, req.URL.String())
+		},
+	}
+
+	// Prepare request body
+	var bodyReader io.Reader
+	if input.Body != "" {
+		bodyReader = strings.NewReader(input.Body)
+	}
+
+	// Create HTTP request
+	req, err := http.NewRequestWithContext(ctx, method, input.URL, bodyReader)
+	if err != nil {
+		return Output{}, &Error{"Failed to create HTTP request", err.Error()}
+	}
+
+	// Forward the orchestrator's trace context so the request joins the
+	// workflow's trace; explicit headers take precedence
+	for header, envVar := range map[string]string{"traceparent": "TRACEPARENT", "tracestate": "TRACESTATE"} {
+		if value, _ := lookupEnv(envVar); value != "" {
+			req.Header.Set(header, value)
+		}
+	}
+
+	// Set headers
+	for key, value := range input.Headers {
+		req.Header.Set(key, value)
+	}
+
+	// Set default Content-Type if body is provided and no Content-Type is set
+	if input.Body != "" && req.Header.Get("Content-Type") == "" {
+		// Try to detect if it's JSON
+		if body := strings.TrimSpace(input.Body); body != "" && (body[0] == '{' || body[0] == '[') {
+			req.Header.Set("Content-Type", "application/json")
+		} else {
+			req.Header.Set("Content-Type", "text/plain")
+		}
+	}
+
+	log.Printf("Making %s request to %s", method, input.URL)
+
+	// Execute the request
+	resp, err := client.Do(req)
+	if err != nil {
+		return Output{}, &Error{"Failed to execute HTTP request", err.Error()}
+	}
+	defer resp.Body.Close()
+
+	// Read response body, at most one byte past the limit to detect a longer one
+	var body io.Reader = resp.Body
+	if maxBodyBytes > 0 {
+		body = io.LimitReader(resp.Body, maxBodyBytes+1)
+	}
+	bodyBytes, err := io.ReadAll(body)
+	if err != nil {
+		return Output{}, &Error{"Failed to read response body", err.Error()}
+	}
+	if maxBodyBytes > 0 && int64(len(bodyBytes)) > maxBodyBytes {
+		if !truncate {
+			return Output{}, fmt.Errorf("action output exceeded max_output_bytes of %d bytes", maxBodyBytes)
+		}
+		log.Printf("Response body truncated to %d bytes", maxBodyBytes)
+		bodyBytes = bodyBytes[:maxBodyBytes]
+	}
+
+	// Convert response headers to map
+	responseHeaders := make(map[string]string)
+	for key, values := range resp.Header {
+		if len(values) > 0 {
+			responseHeaders[key] = values[0] // Take first value if multiple
+		}
+	}
+
+	log.Printf("Request completed with status code: %d", resp.StatusCode)
+
+	return Output{
+		Success:    true,
+		Message:    fmt.Sprintf("HTTP %s request to %s completed successfully", method, input.URL),
+		StatusCode: resp.StatusCode,
+		Headers:    responseHeaders,
+		Body:       string(bodyBytes),
+	}, nil
+}
+
+// checkURLPermission verifies that rawURL is an http(s) URL whose host matches
+// one of the workflow's url_hosts. Patterns of the form *.example.com match
+// subdomains of example.com only.
+func checkURLPermission(allowed *permissions.Permissions, rawURL string) error {
+	if allowed == nil {
+		return nil
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid url %s: %w", rawURL, err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("requesting %s is not allowed: only http and https urls may be used", rawURL)
+	}
+
+	host := strings.ToLower(parsed.Hostname())
+	if allowed.AllowsHost(host) {
+		return nil
+	}
+
+	if len(allowed.URLHosts) == 0 {
+		return fmt.Errorf("requesting %s is not allowed: the workflow declares no url_hosts", rawURL)
+	}
+	return fmt.Errorf("requesting %s is not allowed: host %s is not in the workflow's url_hosts (%s)", rawURL, host, strings.Join(allowed.URLHosts, ", "))
+}
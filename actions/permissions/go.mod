@@ -0,0 +1,3 @@
+module github.com/octo-agent/go-ai-agent-v1/actions/permissions
+
+go 1.19
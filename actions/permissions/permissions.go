@@ -0,0 +1,111 @@
+// Package permissions reads the workflow permissions the orchestrator passes
+// to actions and matches hosts and paths against them. The httprequest,
+// writefile-json and watch-git actions share it.
+package permissions
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Permissions are the workflow permissions passed by the orchestrator
+type Permissions struct {
+	URLHosts       []string `json:"url_hosts"`
+	WriteRoots     []string `json:"write_roots"`
+	GitCredentials bool     `json:"git_credentials"`
+}
+
+// EnvVar is set by the orchestrator when a workflow declares permissions
+const EnvVar = "OCTA_PERMISSIONS"
+
+// Load reads the workflow permissions from the action's environment; nil
+// means unrestricted
+func Load(lookupEnv func(string) (string, bool)) (*Permissions, error) {
+	encoded, ok := lookupEnv(EnvVar)
+	if !ok {
+		return nil, nil
+	}
+
+	var permissions Permissions
+	if err := json.Unmarshal([]byte(encoded), &permissions); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", EnvVar, err)
+	}
+	return &permissions, nil
+}
+
+// AllowsHost reports whether host matches one of the url_hosts. Patterns of
+// the form *.example.com match subdomains of example.com only. Nil
+// permissions allow every host.
+func (p *Permissions) AllowsHost(host string) bool {
+	if p == nil {
+		return true
+	}
+
+	host = strings.ToLower(host)
+	for _, pattern := range p.URLHosts {
+		if strings.HasPrefix(pattern, "*.") {
+			if strings.HasSuffix(host, pattern[1:]) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsPath reports whether path lies beneath one of the write_roots.
+// Symlinks are resolved, so a link inside a root cannot be used to write
+// outside it. Nil permissions allow every path.
+func (p *Permissions) AllowsPath(path string) (bool, error) {
+	if p == nil {
+		return true, nil
+	}
+
+	target, err := resolvePath(path)
+	if err != nil {
+		return false, err
+	}
+
+	for _, root := range p.WriteRoots {
+		resolvedRoot, err := resolvePath(root)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(resolvedRoot, target); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// resolvePath returns the absolute path with symlinks resolved. Components that
+// do not exist yet are appended to their nearest existing ancestor.
+func resolvePath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid path %s: %w", path, err)
+	}
+
+	var missing []string
+	current := abs
+	for {
+		resolved, err := filepath.EvalSymlinks(current)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		if _, lstatErr := os.Lstat(current); lstatErr == nil {
+			// A dangling symlink could point anywhere once created
+			return "", fmt.Errorf("failed to resolve path %s: %w", path, err)
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return "", fmt.Errorf("failed to resolve path %s: %w", path, err)
+		}
+		missing = append([]string{filepath.Base(current)}, missing...)
+		current = parent
+	}
+}
@@ -0,0 +1,125 @@
+package permissions
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    *Permissions
+		wantErr bool
+	}{
+		{
+			name: "unset is unrestricted",
+			env:  map[string]string{},
+		},
+		{
+			name: "declared permissions",
+			env:  map[string]string{EnvVar: `{"url_hosts":["example.com"],"write_roots":["/tmp"],"git_credentials":true}`},
+			want: &Permissions{URLHosts: []string{"example.com"}, WriteRoots: []string{"/tmp"}, GitCredentials: true},
+		},
+		{
+			name:    "invalid json",
+			env:     map[string]string{EnvVar: "{"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Load(func(key string) (string, bool) {
+				value, ok := tt.env[key]
+				return value, ok
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Load() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowsHost(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions *Permissions
+		host        string
+		want        bool
+	}{
+		{"nil allows every host", nil, "example.com", true},
+		{"no url_hosts", &Permissions{}, "example.com", false},
+		{"exact host", &Permissions{URLHosts: []string{"example.com"}}, "example.com", true},
+		{"host is lowercased", &Permissions{URLHosts: []string{"example.com"}}, "Example.COM", true},
+		{"other host", &Permissions{URLHosts: []string{"example.com"}}, "example.org", false},
+		{"exact host does not match subdomains", &Permissions{URLHosts: []string{"example.com"}}, "api.example.com", false},
+		{"wildcard matches subdomain", &Permissions{URLHosts: []string{"*.example.com"}}, "api.example.com", true},
+		{"wildcard matches nested subdomain", &Permissions{URLHosts: []string{"*.example.com"}}, "a.b.example.com", true},
+		{"wildcard does not match the domain itself", &Permissions{URLHosts: []string{"*.example.com"}}, "example.com", false},
+		{"wildcard does not match a suffix", &Permissions{URLHosts: []string{"*.example.com"}}, "badexample.com", false},
+		{"any of several", &Permissions{URLHosts: []string{"example.org", "*.example.com"}}, "api.example.com", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.permissions.AllowsHost(tt.host); got != tt.want {
+				t.Errorf("AllowsHost(%q) = %v, want %v", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowsPath(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	outside := filepath.Join(dir, "outside")
+	for _, d := range []string{root, outside} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "missing"), filepath.Join(root, "dangling")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		permissions *Permissions
+		path        string
+		want        bool
+		wantErr     bool
+	}{
+		{name: "nil allows every path", path: filepath.Join(outside, "file"), want: true},
+		{name: "no write_roots", permissions: &Permissions{}, path: filepath.Join(root, "file")},
+		{name: "file in root", permissions: &Permissions{WriteRoots: []string{root}}, path: filepath.Join(root, "file"), want: true},
+		{name: "root itself", permissions: &Permissions{WriteRoots: []string{root}}, path: root, want: true},
+		{name: "missing directories in root", permissions: &Permissions{WriteRoots: []string{root}}, path: filepath.Join(root, "a", "b", "file"), want: true},
+		{name: "file outside root", permissions: &Permissions{WriteRoots: []string{root}}, path: filepath.Join(outside, "file")},
+		{name: "dot-dot escapes root", permissions: &Permissions{WriteRoots: []string{root}}, path: filepath.Join(root, "..", "outside", "file")},
+		{name: "sibling with root as prefix", permissions: &Permissions{WriteRoots: []string{root}}, path: root + "2/file"},
+		{name: "symlink out of root", permissions: &Permissions{WriteRoots: []string{root}}, path: filepath.Join(root, "link", "file")},
+		{name: "dangling symlink", permissions: &Permissions{WriteRoots: []string{root}}, path: filepath.Join(root, "dangling"), wantErr: true},
+		{name: "any of several", permissions: &Permissions{WriteRoots: []string{outside, root}}, path: filepath.Join(root, "file"), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.permissions.AllowsPath(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AllowsPath(%q) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("AllowsPath(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	_ "embed"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net/url"
 	"os"
 	"strings"
 	"time"
@@ -13,9 +16,16 @@ import (
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/transport/http"
 	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/octo-agent/go-ai-agent-v1/actions/permissions"
 	"gopkg.in/yaml.v3"
 )
 
+// manifest is the action manifest, with the schemas of ActionInput and
+// ActionOutput
+//
+//go:embed watch-git.action.yaml
+var manifest []byte
+
 // ActionInput represents the input structure for the watch-git action
 type ActionInput struct {
 	URL          string `yaml:"url"`                      // Git repository URL
@@ -26,6 +36,8 @@ type ActionInput struct {
 	MaxChecks    int    `yaml:"max_checks,omitempty"`     // Max number of checks (default: 10)
 	LocalDir     string `yaml:"local_dir,omitempty"`      // Local directory to clone to (optional)
 	ExitOnChange *bool  `yaml:"exit_on_change,omitempty"` // Exit immediately when first change is detected (default: true)
+	SinceCommit  string `yaml:"since_commit,omitempty"`   // Last commit already seen; changes are reported relative to it (optional)
+	MaxCommits   int    `yaml:"max_commits,omitempty"`    // Max commits reported per detected change (default: 20)
 }
 
 // ActionOutput represents the output structure for the watch-git action
@@ -36,6 +48,7 @@ type ActionOutput struct {
 	Branch     string   `yaml:"branch"`
 	LastCommit string   `yaml:"last_commit,omitempty"`
 	Changes    []Change `yaml:"changes,omitempty"`
+	HasMore    bool     `yaml:"has_more,omitempty"`
 	CheckCount int      `yaml:"check_count"`
 	Error      string   `yaml:"error,omitempty"`
 }
@@ -50,6 +63,12 @@ type Change struct {
 }
 
 func main() {
+	// The manifest documents the input and output
+	if len(os.Args) > 1 && os.Args[1] == "--describe" {
+		os.Stdout.Write(manifest)
+		return
+	}
+
 	// Read YAML input from stdin
 	var input ActionInput
 
@@ -72,6 +91,12 @@ func main() {
 		return
 	}
 
+	// Refuse repositories and credentials the workflow has not granted
+	if err := checkPermissions(input); err != nil {
+		sendErrorResponse("Permission denied by workflow policy", err.Error())
+		return
+	}
+
 	// Set defaults
 	if input.Branch == "" {
 		input.Branch = "main"
@@ -82,6 +107,9 @@ func main() {
 	if input.MaxChecks == 0 {
 		input.MaxChecks = 10
 	}
+	if input.MaxCommits == 0 {
+		input.MaxCommits = 20
+	}
 	// Default to exit on first change (true by default)
 	exitOnChange := true
 	if input.ExitOnChange != nil {
@@ -98,7 +126,7 @@ func main() {
 	}
 
 	// Watch the repository
-	changes, lastCommit, actualChecks, err := watchRepository(input.URL, input.Branch, auth, input.Interval, input.MaxChecks, exitOnChange)
+	changes, lastCommit, hasMore, actualChecks, err := watchRepository(input.URL, input.Branch, auth, input.Interval, input.MaxChecks, exitOnChange, input.SinceCommit, input.MaxCommits)
 	if err != nil {
 		sendErrorResponse("Failed to watch repository", err.Error())
 		return
@@ -124,6 +152,7 @@ func main() {
 		Branch:     input.Branch,
 		LastCommit: lastCommit,
 		Changes:    changes,
+		HasMore:    hasMore,
 		CheckCount: actualChecks,
 	}
 
@@ -136,22 +165,96 @@ func main() {
 	fmt.Print(string(outputYAML))
 }
 
-// watchRepository watches a git repository for changes
-func watchRepository(url, branch string, auth *http.BasicAuth, interval, maxChecks int, exitOnChange bool) ([]Change, string, int, error) {
+// checkPermissions verifies that the repository host is in the workflow's
+// url_hosts and that credentials are only used when git_credentials is granted.
+// Local repositories need no host permission. Without declared permissions
+// everything is allowed.
+func checkPermissions(input ActionInput) error {
+	allowed, err := permissions.Load(os.LookupEnv)
+	if err != nil || allowed == nil {
+		return err
+	}
+
+	host, hasCredentials, err := repositoryHost(input.URL)
+	if err != nil {
+		return err
+	}
+
+	if (input.Username != "" || input.Password != "" || hasCredentials) && !allowed.GitCredentials {
+		return fmt.Errorf("using git credentials is not allowed: the workflow does not grant git_credentials")
+	}
+
+	if host == "" || allowed.AllowsHost(host) {
+		return nil
+	}
+
+	if len(allowed.URLHosts) == 0 {
+		return fmt.Errorf("watching %s is not allowed: the workflow declares no url_hosts", input.URL)
+	}
+	return fmt.Errorf("watching %s is not allowed: host %s is not in the workflow's url_hosts (%s)", input.URL, host, strings.Join(allowed.URLHosts, ", "))
+}
+
+// repositoryHost returns the host of a remote repository URL, or "" for a
+// local repository, and whether access uses credentials of its own: a password
+// in the URL, or the SSH keys used for ssh and scp-like (git@host:owner/repo)
+// addresses.
+func repositoryHost(repoURL string) (string, bool, error) {
+	if strings.Contains(repoURL, "://") {
+		parsed, err := url.Parse(repoURL)
+		if err != nil {
+			return "", false, fmt.Errorf("invalid repository url %s: %w", repoURL, err)
+		}
+		if parsed.Scheme == "file" {
+			return "", false, nil
+		}
+		_, hasPassword := parsed.User.Password()
+		return strings.ToLower(parsed.Hostname()), hasPassword || parsed.Scheme == "ssh", nil
+	}
+
+	// scp-like syntax has a colon before any slash
+	if colon := strings.Index(repoURL, ":"); colon > 0 && !strings.Contains(repoURL[:colon], "/") {
+		host := repoURL[:colon]
+		if at := strings.LastIndex(host, "@"); at >= 0 {
+			host = host[at+1:]
+		}
+		return strings.ToLower(host), true, nil
+	}
+
+	return "", false, nil
+}
+
+// watchRepository watches a git repository for changes. When sinceCommit is
+// set it is used as the baseline instead of the current HEAD, so commits pushed
+// while nobody was watching are reported on the first check. The returned
+// commit is the newest one reported, and hasMore is set when newer commits
+// were left for the next check because a check reports at most maxCommits.
+// The branch is cloned once and fetched again for every further check.
+func watchRepository(url, branch string, auth *http.BasicAuth, interval, maxChecks int, exitOnChange bool, sinceCommit string, maxCommits int) ([]Change, string, bool, int, error) {
 	var changes []Change
 	var lastKnownCommit string
+	var hasMore bool
 	var actualChecks int
 
 	log.Printf("Starting to watch repository: %s, branch: %s", url, branch)
 
-	// Initial clone to get the current state
-	initialCommit, err := getLatestCommit(url, branch, auth)
+	repo, err := cloneBranch(url, branch, auth)
 	if err != nil {
-		return nil, "", 0, fmt.Errorf("failed to get initial commit: %v", err)
+		return nil, "", false, 0, err
 	}
 
-	lastKnownCommit = initialCommit.Hash
-	log.Printf("Initial commit: %s", lastKnownCommit)
+	if sinceCommit != "" {
+		lastKnownCommit = sinceCommit
+		log.Printf("Resuming from commit: %s", lastKnownCommit)
+	} else {
+		// The clone holds the current state
+		initialCommit, err := branchHead(repo, branch)
+		if err != nil {
+			return nil, "", false, 0, fmt.Errorf("failed to get initial commit: %v", err)
+		}
+
+		lastKnownCommit = initialCommit.Hash.String()
+		log.Printf("Initial commit: %s", lastKnownCommit)
+	}
 
 	// Watch for changes
 	for i := 0; i < maxChecks; i++ {
@@ -159,28 +262,48 @@ func watchRepository(url, branch string, auth *http.BasicAuth, interval, maxChec
 
 		if i > 0 {
 			time.Sleep(time.Duration(interval) * time.Second)
+
+			if err := fetchBranch(repo, auth); err != nil {
+				log.Printf("Error checking for changes: %v", err)
+				continue
+			}
 		}
 
 		log.Printf("Checking for changes... (check %d/%d)", i+1, maxChecks)
 
-		latestCommit, err := getLatestCommit(url, branch, auth)
+		latestCommit, err := branchHead(repo, branch)
 		if err != nil {
 			log.Printf("Error checking for changes: %v", err)
 			continue
 		}
 
-		if latestCommit.Hash != lastKnownCommit {
-			log.Printf("New commit detected: %s", latestCommit.Hash)
+		if latestCommit.Hash.String() != lastKnownCommit {
+			log.Printf("New commit detected: %s", latestCommit.Hash.String())
+
+			// Collect every commit since the last known one, not just HEAD
+			var newCommits []*CommitInfo
+			newCommits, hasMore, err = getCommitsSince(repo, latestCommit, lastKnownCommit, maxCommits)
+			if errors.Is(err, errCommitNotInHistory) {
+				log.Printf("Warning: commit %s is no longer on branch %s, e.g. after a force push; only the new head is reported, not the commits leading to it", lastKnownCommit, branch)
+				newCommits, hasMore = []*CommitInfo{newCommitInfo(repo, latestCommit)}, false
+			} else if err != nil {
+				log.Printf("Error listing commits since %s: %v", lastKnownCommit, err)
+				continue
+			}
 
-			change := Change{
-				CommitHash:   latestCommit.Hash,
-				Author:       latestCommit.Author,
-				Message:      latestCommit.Message,
-				Timestamp:    latestCommit.Timestamp,
-				FilesChanged: latestCommit.FilesChanged,
+			for _, commit := range newCommits {
+				changes = append(changes, Change{
+					CommitHash:   commit.Hash,
+					Author:       commit.Author,
+					Message:      commit.Message,
+					Timestamp:    commit.Timestamp,
+					FilesChanged: commit.FilesChanged,
+				})
+			}
+			lastKnownCommit = newCommits[len(newCommits)-1].Hash
+			if hasMore {
+				log.Printf("More than %d new commits, reporting the oldest ones first", maxCommits)
 			}
-			changes = append(changes, change)
-			lastKnownCommit = latestCommit.Hash
 
 			// Exit early if configured to do so
 			if exitOnChange {
@@ -190,7 +313,7 @@ func watchRepository(url, branch string, auth *http.BasicAuth, interval, maxChec
 		}
 	}
 
-	return changes, lastKnownCommit, actualChecks, nil
+	return changes, lastKnownCommit, hasMore, actualChecks, nil
 }
 
 // CommitInfo represents basic commit information
@@ -202,14 +325,13 @@ type CommitInfo struct {
 	FilesChanged []string
 }
 
-// getLatestCommit gets the latest commit from the repository
-func getLatestCommit(url, branch string, auth *http.BasicAuth) (*CommitInfo, error) {
-	// Clone the repository in memory with depth 2 to get parent for comparison
+// cloneBranch clones the history of a branch in memory. The full history is
+// needed to find the last known commit however many commits followed it.
+func cloneBranch(url, branch string, auth *http.BasicAuth) (*git.Repository, error) {
 	cloneOptions := &git.CloneOptions{
 		URL:           url,
 		ReferenceName: plumbing.NewBranchReferenceName(branch),
 		SingleBranch:  true,
-		Depth:         2, // Need parent commit to compare changes
 	}
 
 	if auth != nil {
@@ -220,20 +342,39 @@ func getLatestCommit(url, branch string, auth *http.BasicAuth) (*CommitInfo, err
 	if err != nil {
 		return nil, fmt.Errorf("failed to clone repository: %v", err)
 	}
+	return repo, nil
+}
+
+// fetchBranch updates a clone made by cloneBranch, following force pushes
+func fetchBranch(repo *git.Repository, auth *http.BasicAuth) error {
+	fetchOptions := &git.FetchOptions{Force: true}
+	if auth != nil {
+		fetchOptions.Auth = auth
+	}
+
+	err := repo.Fetch(fetchOptions)
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("failed to fetch repository: %v", err)
+	}
+	return nil
+}
 
-	// Get the HEAD reference
-	ref, err := repo.Head()
+// branchHead returns the newest commit of the branch as last fetched
+func branchHead(repo *git.Repository, branch string) (*object.Commit, error) {
+	ref, err := repo.Reference(plumbing.NewRemoteReferenceName(git.DefaultRemoteName, branch), true)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get HEAD reference: %v", err)
+		return nil, fmt.Errorf("failed to get branch reference: %v", err)
 	}
 
-	// Get the commit object
 	commit, err := repo.CommitObject(ref.Hash())
 	if err != nil {
 		return nil, fmt.Errorf("failed to get commit object: %v", err)
 	}
+	return commit, nil
+}
 
-	// Get the files changed in this commit
+// newCommitInfo describes a commit with the files it changed
+func newCommitInfo(repo *git.Repository, commit *object.Commit) *CommitInfo {
 	filesChanged, err := getCommitFileChanges(repo, commit)
 	if err != nil {
 		log.Printf("Warning: could not get file changes for commit %s: %v", commit.Hash.String(), err)
@@ -246,7 +387,38 @@ func getLatestCommit(url, branch string, auth *http.BasicAuth) (*CommitInfo, err
 		Message:      strings.TrimSpace(commit.Message),
 		Timestamp:    commit.Author.When.Format(time.RFC3339),
 		FilesChanged: filesChanged,
-	}, nil
+	}
+}
+
+// errCommitNotInHistory is returned when the last known commit is not on the
+// branch anymore, e.g. after a force push
+var errCommitNotInHistory = errors.New("commit is not in the branch's history")
+
+// getCommitsSince returns the oldest commits from head back to sinceHash,
+// along first parents and oldest first, and whether there are more than
+// maxCommits of them
+func getCommitsSince(repo *git.Repository, head *object.Commit, sinceHash string, maxCommits int) ([]*CommitInfo, bool, error) {
+	// Walk back to sinceHash first, then describe only the reported commits
+	var walked []*object.Commit
+	commit := head
+	for commit.Hash.String() != sinceHash {
+		walked = append(walked, commit)
+		if commit.NumParents() == 0 {
+			return nil, false, errCommitNotInHistory
+		}
+		parent, err := commit.Parent(0)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to get parent of commit %s: %v", commit.Hash.String(), err)
+		}
+		commit = parent
+	}
+
+	hasMore := len(walked) > maxCommits
+	var commits []*CommitInfo
+	for i := len(walked) - 1; i >= 0 && len(commits) < maxCommits; i-- {
+		commits = append(commits, newCommitInfo(repo, walked[i]))
+	}
+	return commits, hasMore, nil
 }
 
 // getCommitFileChanges gets the list of files changed in a commit
@@ -0,0 +1,167 @@
+// Package writefile implements the writefile-json action. The writefile-json
+// binary and the orchestrator, which runs it in-process, share it.
+package writefile
+
+import (
+	_ "embed"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/octo-agent/go-ai-agent-v1/actions/permissions"
+)
+
+// Manifest is the action manifest, with the schemas of Input and Output
+//
+//go:embed writefile-json.action.yaml
+var Manifest []byte
+
+// Input represents the input structure for the writefile action
+type Input struct {
+	Path     string `yaml:"path"`
+	Content  string `yaml:"content"`
+	Mode     string `yaml:"mode,omitempty"`      // "create", "append", "overwrite", "delete" (default: create)
+	MkdirAll bool   `yaml:"mkdir_all,omitempty"` // Create parent directories if they don't exist
+}
+
+// Output represents the output structure for the writefile action
+type Output struct {
+	Success bool   `yaml:"success"`
+	Message string `yaml:"message"`
+	Path    string `yaml:"path"`
+	Size    int64  `yaml:"size,omitempty"`
+	Error   string `yaml:"error,omitempty"`
+}
+
+// Error is a failure reported as the message and error of the output
+type Error struct {
+	Message string
+	Detail  string
+}
+
+func (e *Error) Error() string {
+	return e.Message + ": " + e.Detail
+}
+
+// Run writes or deletes the file. lookupEnv reads the action's environment,
+// and relative paths are resolved against dir, or the current directory if
+// it is empty.
+func Run(input Input, lookupEnv func(string) (string, bool), dir string) (Output, error) {
+	// Validate required fields
+	if input.Path == "" {
+		return Output{}, &Error{"Missing required field", "path is required"}
+	}
+
+	if input.Content == "" && input.Mode != "create" && input.Mode != "delete" {
+		log.Printf("Warning: Content is empty for path: %s", input.Path)
+	}
+
+	// Set default mode
+	if input.Mode == "" {
+		input.Mode = "create"
+	}
+
+	// Validate mode
+	validModes := map[string]bool{
+		"create":    true,
+		"append":    true,
+		"overwrite": true,
+		"delete":    true,
+	}
+	if !validModes[input.Mode] {
+		return Output{}, &Error{"Invalid mode", fmt.Sprintf("mode must be one of: create, append, overwrite, delete, got: %s", input.Mode)}
+	}
+
+	path := input.Path
+	if dir != "" && !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+
+	// Refuse paths outside the workflow's write roots
+	if err := checkWritePermission(path, lookupEnv); err != nil {
+		return Output{}, &Error{"Permission denied by workflow policy", err.Error()}
+	}
+
+	// Deleting a file that does not exist succeeds, so that undoing a write
+	// can be repeated
+	if input.Mode == "delete" {
+		message := fmt.Sprintf("Deleted %s", input.Path)
+		if err := os.Remove(path); os.IsNotExist(err) {
+			message = fmt.Sprintf("%s does not exist", input.Path)
+		} else if err != nil {
+			return Output{}, &Error{"Failed to delete file", err.Error()}
+		}
+		return Output{Success: true, Message: message, Path: input.Path}, nil
+	}
+
+	// Create parent directories if requested
+	if input.MkdirAll {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return Output{}, &Error{"Failed to create parent directories", err.Error()}
+		}
+	}
+
+	// Handle different write modes
+	var file *os.File
+	var err error
+
+	switch input.Mode {
+	case "create":
+		// Check if file exists
+		if _, statErr := os.Stat(path); statErr == nil {
+			return Output{}, &Error{"File already exists", fmt.Sprintf("file %s already exists and mode is 'create'", input.Path)}
+		}
+		file, err = os.Create(path)
+	case "append":
+		file, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	case "overwrite":
+		file, err = os.Create(path)
+	}
+
+	if err != nil {
+		return Output{}, &Error{"Failed to open file", err.Error()}
+	}
+	defer file.Close()
+
+	// Write content to file
+	bytesWritten, err := file.WriteString(input.Content)
+	if err != nil {
+		return Output{}, &Error{"Failed to write content", err.Error()}
+	}
+
+	output := Output{
+		Success: true,
+		Message: fmt.Sprintf("Successfully wrote %d bytes to %s", bytesWritten, input.Path),
+		Path:    input.Path,
+	}
+
+	// Get file info for size
+	if fileInfo, err := file.Stat(); err == nil {
+		output.Size = fileInfo.Size()
+	} else {
+		log.Printf("Warning: Could not get file info: %v", err)
+	}
+	return output, nil
+}
+
+// checkWritePermission verifies that path lies beneath one of the write roots
+// declared by the workflow. Without declared permissions every path is
+// allowed.
+func checkWritePermission(path string, lookupEnv func(string) (string, bool)) error {
+	allowed, err := permissions.Load(lookupEnv)
+	if err != nil {
+		return err
+	}
+
+	ok, err := allowed.AllowsPath(path)
+	if err != nil || ok {
+		return err
+	}
+
+	if len(allowed.WriteRoots) == 0 {
+		return fmt.Errorf("writing %s is not allowed: the workflow declares no write_roots", path)
+	}
+	return fmt.Errorf("writing %s is not allowed: it is outside the workflow's write_roots (%s)", path, strings.Join(allowed.WriteRoots, ", "))
+}
@@ -49,12 +49,14 @@ echo "  - claude-api"
 cd "$PROJECT_ROOT/actions/claude-api"
 go mod tidy
 go build -o "../../bin/claude-api" .
+cp claude-api.action.yaml ../../bin/
 
 # Build watch-git action
 echo "  - watch-git"
 cd "$PROJECT_ROOT/actions/watch-git"
 go mod tidy
 go build -o "../../bin/watch-git" .
+cp watch-git.action.yaml ../../bin/
 
 echo ""
 echo "✅ Build completed successfully!"
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/octo-agent/go-ai-agent-v1/actions/echo-json/echojson"
+	"github.com/octo-agent/go-ai-agent-v1/actions/httprequest/httprequest"
+	"github.com/octo-agent/go-ai-agent-v1/actions/writefile-json/writefile"
+	"github.com/octo-agent/go-ai-agent-v1/orchestrator/engine"
+	"gopkg.in/yaml.v3"
+)
+
+// The bundled actions run in-process in the orchestrator and have no
+// manifest files, so the CLI registers their manifests like it does
+func init() {
+	engine.RegisterManifest("echo-json", echojson.Manifest)
+	engine.RegisterManifest("writefile-json", writefile.Manifest)
+	engine.RegisterManifest("httprequest", httprequest.Manifest)
+}
+
+// actionSummary is a row of the action list
+type actionSummary struct {
+	Name        string `json:"name"`
+	Version     string `json:"version,omitempty"`
+	Description string `json:"description,omitempty"`
+	Source      string `json:"source"`             // "builtin" or the action's binary
+	Manifest    string `json:"manifest,omitempty"` // Where the manifest was found: its file, "builtin" or "describe"
+	Error       string `json:"error,omitempty"`    // Why the manifest could not be read
+}
+
+// actionDescription is what describe reports about an action
+type actionDescription struct {
+	actionSummary
+	Input        []actionField            `json:"input"`
+	Output       []actionField            `json:"output"`
+	InputSchema  *engine.Schema           `json:"input_schema,omitempty"`
+	OutputSchema *engine.Schema           `json:"output_schema,omitempty"`
+	Example      string                   `json:"example"` // A node using the action, as YAML
+	Errors       []engine.DocumentedError `json:"errors"`
+}
+
+// actionField is a property of an input or output schema, flattened to a
+// dotted path
+type actionField struct {
+	Name        string        `json:"name"`
+	Type        string        `json:"type"`
+	Required    bool          `json:"required"`
+	Default     interface{}   `json:"default,omitempty"`
+	Description string        `json:"description,omitempty"`
+	Enum        []interface{} `json:"enum,omitempty"`
+}
+
+// actionsCommand lists the installed actions or describes one
+func actionsCommand() {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s actions list [-json]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s actions describe [-json] <action>\n", os.Args[0])
+		os.Exit(1)
+	}
+	if len(os.Args) < 3 {
+		usage()
+	}
+
+	flags := flag.NewFlagSet("actions "+os.Args[2], flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print JSON for tooling")
+	flags.Parse(os.Args[3:])
+	switch {
+	case os.Args[2] == "list" && flags.NArg() == 0:
+		listActions(*asJSON)
+	case os.Args[2] == "describe" && flags.NArg() == 1:
+		describeAction(flags.Arg(0), *asJSON)
+	default:
+		usage()
+	}
+}
+
+// describeCommand is short for actions describe
+func describeCommand() {
+	flags := flag.NewFlagSet("describe", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print JSON for tooling")
+	flags.Parse(os.Args[2:])
+	if flags.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: %s describe [-json] <action>\n", os.Args[0])
+		os.Exit(1)
+	}
+	describeAction(flags.Arg(0), *asJSON)
+}
+
+// listActions prints the actions found next to the CLI and the bundled ones.
+// It only reads manifests: unlike describe it never runs an action.
+func listActions(asJSON bool) {
+	e := engine.New()
+	installed, err := e.ListActions()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %v\n", statusFAILED, err)
+		os.Exit(1)
+	}
+
+	// The orchestrator shares the directory but is not an action
+	orchestrator := filepath.Base(orchestratorPath())
+	summaries := make([]actionSummary, 0, len(installed))
+	for _, action := range installed {
+		if action.Type == orchestrator {
+			continue
+		}
+		summary := actionSummary{Name: action.Type, Source: actionSource(action)}
+		manifest, err := e.LoadActionManifest(action.Type)
+		if err != nil {
+			summary.Error = err.Error()
+		} else {
+			summary.Version, summary.Description, summary.Manifest = manifest.Version, manifest.Description, manifest.Source
+		}
+		summaries = append(summaries, summary)
+	}
+
+	if asJSON {
+		printJSON(summaries)
+		return
+	}
+	if len(summaries) == 0 {
+		fmt.Printf("No actions found in %s\n", e.ActionDir)
+		return
+	}
+	fmt.Printf("%-18s %-10s %-36s %s\n", "NAME", "VERSION", "SOURCE", "DESCRIPTION")
+	for _, summary := range summaries {
+		description := summary.Description
+		if summary.Error != "" {
+			description = statusFAILED + " " + summary.Error
+		}
+		version := summary.Version
+		if version == "" {
+			version = "-"
+		}
+		line := fmt.Sprintf("%-18s %-10s %-36s %s", summary.Name, version, summary.Source, description)
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+}
+
+// actionSource is "builtin" for the bundled actions, which the orchestrator
+// runs in-process, and otherwise the action's binary or module
+func actionSource(action engine.InstalledAction) string {
+	if action.Builtin {
+		return "builtin"
+	}
+	return action.Path
+}
+
+// describeAction prints the documented input and output fields of an
+// action, an example node and the errors it reports
+func describeAction(actionType string, asJSON bool) {
+	e := engine.New()
+	manifest, err := e.DescribeAction(context.Background(), actionType)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %v\n", statusFAILED, err)
+		os.Exit(1)
+	}
+
+	description := actionDescription{
+		actionSummary: actionSummary{
+			Name:        actionType,
+			Version:     manifest.Version,
+			Description: manifest.Description,
+			Manifest:    manifest.Source,
+		},
+		Input:        schemaFields("", manifest.Input, []actionField{}),
+		Output:       schemaFields("", manifest.Output, []actionField{}),
+		InputSchema:  manifest.Input,
+		OutputSchema: manifest.Output,
+		Example:      exampleNode(actionType, manifest),
+		Errors:       manifest.Errors,
+	}
+	if description.Errors == nil {
+		description.Errors = []engine.DocumentedError{}
+	}
+	if installed, err := e.ListActions(); err == nil {
+		for _, action := range installed {
+			if action.Type == actionType {
+				description.Source = actionSource(action)
+			}
+		}
+	}
+
+	if asJSON {
+		printJSON(description)
+		return
+	}
+
+	fmt.Printf("%s", description.Name)
+	if description.Version != "" {
+		fmt.Printf(" %s", description.Version)
+	}
+	fmt.Println()
+	if description.Description != "" {
+		fmt.Println(description.Description)
+	}
+	fmt.Printf("Source: %s\n", description.Source)
+	if manifest.Source == "" {
+		fmt.Println("\nNo manifest: inputs, outputs and errors are not documented")
+		return
+	}
+	fmt.Printf("Manifest: %s\n", manifest.Source)
+
+	printFields("Input", description.Input)
+	printFields("Output", description.Output)
+
+	fmt.Printf("\nExample:\n")
+	for _, line := range strings.Split(strings.TrimRight(description.Example, "\n"), "\n") {
+		fmt.Printf("  %s\n", line)
+	}
+
+	fmt.Printf("\nErrors:\n")
+	if len(description.Errors) == 0 {
+		fmt.Println("  (not documented)")
+	}
+	for _, documented := range description.Errors {
+		fmt.Printf("  %-40s %s\n", documented.Code, documented.Description)
+	}
+}
+
+// printFields prints the fields of a schema with their types, whether they
+// are required and their defaults
+func printFields(title string, fields []actionField) {
+	fmt.Printf("\n%s:\n", title)
+	if len(fields) == 0 {
+		fmt.Println("  (not documented)")
+		return
+	}
+
+	fmt.Printf("  %-24s %-10s %-9s %-26s %s\n", "FIELD", "TYPE", "REQUIRED", "DEFAULT", "DESCRIPTION")
+	for _, field := range fields {
+		required := ""
+		if field.Required {
+			required = "yes"
+		}
+		defaultValue := ""
+		if field.Default != nil {
+			defaultValue = fmt.Sprint(field.Default)
+		}
+		description := field.Description
+		if len(field.Enum) > 0 {
+			values := make([]string, len(field.Enum))
+			for i, value := range field.Enum {
+				values[i] = fmt.Sprint(value)
+			}
+			description = strings.TrimSpace(description + " (one of " + strings.Join(values, ", ") + ")")
+		}
+		line := fmt.Sprintf("  %-24s %-10s %-9s %-26s %s", field.Name, field.Type, required, defaultValue, description)
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+}
+
+// schemaFields flattens the properties of an object schema, and of the
+// objects and arrays of objects within it, to dotted paths
+func schemaFields(prefix string, schema *engine.Schema, fields []actionField) []actionField {
+	if schema == nil {
+		return fields
+	}
+	if schema.Type == "array" && schema.Items != nil {
+		return schemaFields(prefix+"[]", schema.Items, fields)
+	}
+	for _, name := range schema.PropertyNames() {
+		property := schema.Properties[name]
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+		typ := property.Type
+		if typ == "" {
+			typ = "any"
+		}
+		fields = append(fields, actionField{
+			Name:        path,
+			Type:        typ,
+			Required:    slices.Contains(schema.Required, name),
+			Default:     property.Default,
+			Description: property.Description,
+			Enum:        property.Enum,
+		})
+		fields = schemaFields(path, property, fields)
+	}
+	return fields
+}
+
+// exampleNode writes a workflow node using the action, with the manifest's
+// example input or else placeholders for the required input fields
+func exampleNode(actionType string, manifest *engine.ActionManifest) string {
+	inputs := manifest.Example
+	if inputs == nil && manifest.Input != nil && len(manifest.Input.Required) > 0 {
+		required := make(map[string]interface{})
+		for _, name := range manifest.Input.Required {
+			property := manifest.Input.Properties[name]
+			switch {
+			case property == nil || property.Type == "":
+				required[name] = "<value>"
+			case property.Default != nil:
+				required[name] = property.Default
+			default:
+				required[name] = "<" + property.Type + ">"
+			}
+		}
+		inputs = required
+	}
+
+	node := []struct {
+		ID     string      `yaml:"id"`
+		Type   string      `yaml:"type"`
+		Inputs interface{} `yaml:"inputs_from_workflow,omitempty"`
+	}{{ID: strings.ReplaceAll(actionType, "-", "_"), Type: actionType, Inputs: inputs}}
+
+	var b bytes.Buffer
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(2)
+	encoder.Encode(node)
+	encoder.Close()
+	return b.String()
+}
+
+// printJSON writes a value as indented JSON
+func printJSON(value interface{}) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		fmt.Fprintf(os.Stderr, "%s %v\n", statusFAILED, err)
+		os.Exit(1)
+	}
+}
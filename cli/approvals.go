@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+
+	"github.com/octo-agent/go-ai-agent-v1/orchestrator/engine"
+)
+
+// approvalsCommand lists pending approvals or decides one. A decided run
+// continues on its next resume, which the server does by itself.
+func approvalsCommand() {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s approvals list\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s approvals approve|reject [-comment text] [-as name] <run-id> <node>\n", os.Args[0])
+		os.Exit(1)
+	}
+	if len(os.Args) < 3 {
+		usage()
+	}
+
+	switch os.Args[2] {
+	case "list":
+		if len(os.Args) != 3 {
+			usage()
+		}
+		listApprovals()
+	case "approve", "reject":
+		flags := flag.NewFlagSet("approvals "+os.Args[2], flag.ExitOnError)
+		comment := flags.String("comment", "", "comment recorded with the decision")
+		approver := flags.String("as", defaultApprover(), "name of the approver")
+		flags.Parse(os.Args[3:])
+		if flags.NArg() != 2 {
+			usage()
+		}
+
+		decision := engine.ApprovalDecision{
+			Decision: "approved",
+			Approver: *approver,
+			Comment:  *comment,
+		}
+		if os.Args[2] == "reject" {
+			decision.Decision = "rejected"
+		}
+		if err := engine.New().DecideApproval(flags.Arg(0), flags.Arg(1), decision); err != nil {
+			fmt.Fprintf(os.Stderr, "%s %v\n", statusFAILED, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s Node %s of run %s %s\n", statusOK, flags.Arg(1), flags.Arg(0), decision.Decision)
+		fmt.Printf("Unless a server runs the workflow, continue the run with: %s resume %s\n", os.Args[0], flags.Arg(0))
+	default:
+		usage()
+	}
+}
+
+// listApprovals prints the approvals waiting for a decision, oldest first
+func listApprovals() {
+	pending, err := engine.New().PendingApprovals()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s Failed to list approvals: %v\n", statusFAILED, err)
+		os.Exit(1)
+	}
+
+	if len(pending) == 0 {
+		fmt.Println("No pending approvals")
+		return
+	}
+
+	fmt.Printf("%-24s %-20s %-22s %-22s %s\n", "RUN ID", "NODE", "REQUESTED", "EXPIRES", "MESSAGE")
+	for _, request := range pending {
+		expires := request.ExpiresAt
+		if expires == "" {
+			expires = "-"
+		} else if request.Default != "" {
+			expires += " (" + strings.TrimSuffix(request.Default, "d") + ")"
+		}
+		fmt.Printf("%-24s %-20s %-22s %-22s %s\n", request.RunID, request.Node, request.RequestedAt, expires, request.Message)
+	}
+}
+
+// defaultApprover is the name of the user running the CLI
+func defaultApprover() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
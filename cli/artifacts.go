@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/octo-agent/go-ai-agent-v1/orchestrator/engine"
+)
+
+// runDir returns the history directory of a run
+func runDir(id string) string {
+	return filepath.Join(engine.DefaultStateDir(), "runs", id)
+}
+
+// loadRunRecord reads the history entry of a run
+func loadRunRecord(id string) (*engine.RunRecord, error) {
+	record, err := engine.New().LoadRun(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run %s: %w", id, err)
+	}
+	if record == nil {
+		return nil, fmt.Errorf("run %s not found in %s", id, filepath.Join(engine.DefaultStateDir(), "runs"))
+	}
+	return record, nil
+}
+
+// artifactsCommand lists or retrieves the artifacts of a run
+func artifactsCommand() {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s artifacts list <run-id>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s artifacts get [-o dir] [-node id] <run-id> [name...]\n", os.Args[0])
+		os.Exit(1)
+	}
+	if len(os.Args) < 3 {
+		usage()
+	}
+
+	switch os.Args[2] {
+	case "list":
+		if len(os.Args) != 4 {
+			usage()
+		}
+		listArtifacts(os.Args[3])
+	case "get":
+		flags := flag.NewFlagSet("artifacts get", flag.ExitOnError)
+		outDir := flags.String("o", ".", "directory to copy the artifacts to")
+		node := flags.String("node", "", "only retrieve artifacts of this node")
+		flags.Parse(os.Args[3:])
+		if flags.NArg() < 1 {
+			usage()
+		}
+		getArtifacts(flags.Arg(0), flags.Args()[1:], *node, *outDir)
+	default:
+		usage()
+	}
+}
+
+// listArtifacts prints the artifacts recorded for a run
+func listArtifacts(runID string) {
+	record, err := loadRunRecord(runID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %v\n", statusFAILED, err)
+		os.Exit(1)
+	}
+
+	if len(record.Artifacts) == 0 {
+		fmt.Printf("Run %s (%s, %s) has no artifacts\n", record.ID, record.Workflow, record.Status)
+		return
+	}
+
+	fmt.Printf("Run %s (%s, %s):\n", record.ID, record.Workflow, record.Status)
+	for _, artifact := range record.Artifacts {
+		fmt.Printf("  %-20s %-40s %10d  sha256:%s\n", artifact.Node, artifact.Name, artifact.Size, artifact.SHA256)
+	}
+}
+
+// getArtifacts copies the artifacts of a run into outDir, keeping their names
+// and verifying their checksums. Names, if given, select artifacts by name.
+func getArtifacts(runID string, names []string, node, outDir string) {
+	record, err := loadRunRecord(runID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %v\n", statusFAILED, err)
+		os.Exit(1)
+	}
+
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	var copied int
+	failed := false
+	for _, artifact := range record.Artifacts {
+		if node != "" && artifact.Node != node {
+			continue
+		}
+		if len(wanted) > 0 && !wanted[artifact.Name] {
+			continue
+		}
+		delete(wanted, artifact.Name)
+
+		dest := filepath.Join(outDir, filepath.FromSlash(artifact.Name))
+		if err := copyArtifact(filepath.Join(runDir(record.ID), filepath.FromSlash(artifact.Path)), dest, artifact.SHA256); err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: %v\n", statusFAILED, artifact.Name, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("%s %s (%d bytes)\n", statusOK, dest, artifact.Size)
+		copied++
+	}
+
+	for name := range wanted {
+		fmt.Fprintf(os.Stderr, "%s artifact %s not found in run %s\n", statusFAILED, name, record.ID)
+		failed = true
+	}
+	if copied == 0 && !failed {
+		fmt.Printf("%s Run %s has no matching artifacts\n", statusWARN, record.ID)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// copyArtifact copies an artifact out of the store and checks its sha256
+func copyArtifact(src, dest, checksum string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(out, hash), in); err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != checksum {
+		return fmt.Errorf("checksum mismatch: stored artifact is %s, run history records %s", sum, checksum)
+	}
+	return out.Close()
+}
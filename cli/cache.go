@@ -0,0 +1,148 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/octo-agent/go-ai-agent-v1/orchestrator/engine"
+	"gopkg.in/yaml.v3"
+)
+
+// cacheEntry is the part of a cached node output the CLI reads
+type cacheEntry struct {
+	Key       string `yaml:"key"`
+	Action    string `yaml:"action"`
+	Version   string `yaml:"version"`
+	Node      string `yaml:"node"`
+	RunID     string `yaml:"run_id"`
+	CreatedAt string `yaml:"created_at"`
+	ExpiresAt string `yaml:"expires_at"`
+}
+
+// cachedFile is a cache entry together with where it is stored
+type cachedFile struct {
+	path  string
+	size  int64
+	entry cacheEntry
+}
+
+// expired reports whether the entry is past its ttl; unreadable expiry times
+// count as expired
+func (e cacheEntry) expired(now time.Time) bool {
+	expires, err := time.Parse(time.RFC3339, e.ExpiresAt)
+	return err != nil || now.After(expires)
+}
+
+// cacheCommand lists or clears cached node outputs
+func cacheCommand() {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s cache ls [-action type]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s cache clear [-expired] [-action type]\n", os.Args[0])
+		os.Exit(1)
+	}
+	if len(os.Args) < 3 {
+		usage()
+	}
+
+	flags := flag.NewFlagSet("cache "+os.Args[2], flag.ExitOnError)
+	action := flags.String("action", "", "only entries of this action type")
+	expiredOnly := false
+	switch os.Args[2] {
+	case "ls":
+	case "clear":
+		flags.BoolVar(&expiredOnly, "expired", false, "only remove expired entries")
+	default:
+		usage()
+	}
+	flags.Parse(os.Args[3:])
+	if flags.NArg() != 0 {
+		usage()
+	}
+
+	files, err := loadCacheEntries(*action)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %v\n", statusFAILED, err)
+		os.Exit(1)
+	}
+
+	if os.Args[2] == "ls" {
+		listCache(files)
+	} else {
+		clearCache(files, expiredOnly)
+	}
+}
+
+// loadCacheEntries reads all cache entries, optionally of one action type
+func loadCacheEntries(action string) ([]cachedFile, error) {
+	dir := filepath.Join(engine.DefaultStateDir(), "cache")
+	paths, err := filepath.Glob(filepath.Join(dir, "*", "*.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache %s: %w", dir, err)
+	}
+
+	var files []cachedFile
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var entry cacheEntry
+		if err := yaml.Unmarshal(data, &entry); err != nil {
+			fmt.Fprintf(os.Stderr, "%s skipping unreadable cache entry %s: %v\n", statusWARN, path, err)
+			continue
+		}
+		if action != "" && entry.Action != action {
+			continue
+		}
+		files = append(files, cachedFile{path: path, size: int64(len(data)), entry: entry})
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].entry.CreatedAt < files[j].entry.CreatedAt })
+	return files, nil
+}
+
+// listCache prints the cache entries, oldest first
+func listCache(files []cachedFile) {
+	if len(files) == 0 {
+		fmt.Println("Cache is empty")
+		return
+	}
+
+	now := time.Now()
+	var total int64
+	fmt.Printf("%-14s %-16s %-20s %-22s %-22s %8s\n", "KEY", "ACTION", "NODE", "CREATED", "EXPIRES", "BYTES")
+	for _, file := range files {
+		expires := file.entry.ExpiresAt
+		if file.entry.expired(now) {
+			expires += " (expired)"
+		}
+		key := file.entry.Key
+		if len(key) > 12 {
+			key = key[:12]
+		}
+		fmt.Printf("%-14s %-16s %-20s %-22s %-22s %8d\n", key, file.entry.Action, file.entry.Node, file.entry.CreatedAt, expires, file.size)
+		total += file.size
+	}
+	fmt.Printf("%d entries, %d bytes\n", len(files), total)
+}
+
+// clearCache removes cache entries, or only the expired ones
+func clearCache(files []cachedFile, expiredOnly bool) {
+	now := time.Now()
+	removed := 0
+	for _, file := range files {
+		if expiredOnly && !file.entry.expired(now) {
+			continue
+		}
+		if err := os.Remove(file.path); err != nil {
+			fmt.Fprintf(os.Stderr, "%s failed to remove %s: %v\n", statusWARN, file.path, err)
+			continue
+		}
+		removed++
+	}
+	fmt.Printf("%s Removed %d cache entries\n", statusOK, removed)
+}
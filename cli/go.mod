@@ -1,5 +1,42 @@
 module github.com/octo-agent/go-ai-agent-v1/cli
 
-go 1.19
+go 1.23.0
 
-require gopkg.in/yaml.v3 v3.0.1
+require (
+	github.com/octo-agent/go-ai-agent-v1/actions/echo-json v0.0.0-00010101000000-000000000000
+	github.com/octo-agent/go-ai-agent-v1/actions/httprequest v0.0.0-00010101000000-000000000000
+	github.com/octo-agent/go-ai-agent-v1/actions/writefile-json v0.0.0-00010101000000-000000000000
+	github.com/octo-agent/go-ai-agent-v1/orchestrator v0.0.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/expr-lang/expr v1.17.8 // indirect
+	github.com/go-logr/logr v1.4.3 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
+	github.com/octo-agent/go-ai-agent-v1/actions/permissions v0.0.0-00010101000000-000000000000 // indirect
+	github.com/prometheus/client_golang v1.23.0 // indirect
+	github.com/prometheus/client_model v0.6.2 // indirect
+	github.com/prometheus/common v0.65.0 // indirect
+	github.com/prometheus/procfs v0.16.1 // indirect
+	github.com/tetratelabs/wazero v1.9.0 // indirect
+	go.opentelemetry.io/auto/sdk v1.1.0 // indirect
+	go.opentelemetry.io/otel v1.38.0 // indirect
+	go.opentelemetry.io/otel/metric v1.38.0 // indirect
+	go.opentelemetry.io/otel/trace v1.38.0 // indirect
+	go.starlark.net v0.0.0-20251109183026-be02852a5e1f // indirect
+	golang.org/x/sys v0.35.0 // indirect
+	google.golang.org/protobuf v1.36.8 // indirect
+)
+
+replace github.com/octo-agent/go-ai-agent-v1/orchestrator => ../orchestrator
+
+replace (
+	github.com/octo-agent/go-ai-agent-v1/actions/echo-json => ../actions/echo-json
+	github.com/octo-agent/go-ai-agent-v1/actions/httprequest => ../actions/httprequest
+	github.com/octo-agent/go-ai-agent-v1/actions/permissions => ../actions/permissions
+	github.com/octo-agent/go-ai-agent-v1/actions/writefile-json => ../actions/writefile-json
+)
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"os/exec"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/octo-agent/go-ai-agent-v1/orchestrator/engine"
 	"gopkg.in/yaml.v3"
 )
 
@@ -18,6 +25,9 @@ const (
 	colorBlue   = "\033[34m"
 )
 
+// exitCancelled is the exit code of a run stopped by SIGINT/SIGTERM
+const exitCancelled = 130
+
 // Status indicators
 const (
 	statusOK     = "[" + colorGreen + "OK" + colorReset + "]"
@@ -31,8 +41,21 @@ func main() {
 	if len(os.Args) < 2 {
 		fmt.Fprintf(os.Stderr, "Usage: %s <command> <args...>\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "Commands:\n")
-		fmt.Fprintf(os.Stderr, "  run <workflow_file.yaml> [initial_data_yaml]\n")
+		fmt.Fprintf(os.Stderr, "  run [--matrix matrix.yaml] [--parallelism n] <workflow_file.yaml> [initial_data_yaml]\n")
 		fmt.Fprintf(os.Stderr, "  validate <workflow_file.yaml>\n")
+		fmt.Fprintf(os.Stderr, "  render <workflow_file.yaml>\n")
+		fmt.Fprintf(os.Stderr, "  serve [-addr 127.0.0.1:8080] <workflow_file.yaml> [initial_data_yaml]\n")
+		fmt.Fprintf(os.Stderr, "  artifacts list <run-id>\n")
+		fmt.Fprintf(os.Stderr, "  artifacts get [-o dir] [-node id] <run-id> [name...]\n")
+		fmt.Fprintf(os.Stderr, "  resume [-due] [run-id]\n")
+		fmt.Fprintf(os.Stderr, "  event [-correlation id] <name> [payload_yaml]\n")
+		fmt.Fprintf(os.Stderr, "  approvals list\n")
+		fmt.Fprintf(os.Stderr, "  approvals approve|reject [-comment text] [-as name] <run-id> <node>\n")
+		fmt.Fprintf(os.Stderr, "  cache ls [-action type]\n")
+		fmt.Fprintf(os.Stderr, "  cache clear [-expired] [-action type]\n")
+		fmt.Fprintf(os.Stderr, "  actions list [-json]\n")
+		fmt.Fprintf(os.Stderr, "  actions describe [-json] <action>\n")
+		fmt.Fprintf(os.Stderr, "  describe [-json] <action>\n")
 		os.Exit(1)
 	}
 
@@ -43,6 +66,24 @@ func main() {
 		runWorkflow()
 	case "validate":
 		validateWorkflow()
+	case "render":
+		renderWorkflow()
+	case "serve":
+		serveWorkflow()
+	case "resume":
+		resumeRun()
+	case "event":
+		sendEvent()
+	case "artifacts":
+		artifactsCommand()
+	case "approvals":
+		approvalsCommand()
+	case "cache":
+		cacheCommand()
+	case "actions":
+		actionsCommand()
+	case "describe":
+		describeCommand()
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", command)
 		os.Exit(1)
@@ -51,28 +92,29 @@ func main() {
 
 // runWorkflow executes a workflow using the orchestrator
 func runWorkflow() {
-	if len(os.Args) < 3 || len(os.Args) > 4 {
-		fmt.Fprintf(os.Stderr, "Usage: %s run <workflow_file.yaml> [initial_data_yaml]\n", os.Args[0])
-		os.Exit(1)
-	}
-
-	workflowFile := os.Args[2]
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	matrixFile := flags.String("matrix", "", "run every combination of the matrix in this file")
+	parallelism := flags.Int("parallelism", 0, "matrix combinations run at the same time")
+	flags.Parse(os.Args[2:])
 
-	// Find orchestrator binary in the same directory as CLI
-	cliPath, err := os.Executable()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error getting CLI path: %v\n", err)
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		fmt.Fprintf(os.Stderr, "Usage: %s run [--matrix matrix.yaml] [--parallelism n] <workflow_file.yaml> [initial_data_yaml]\n", os.Args[0])
 		os.Exit(1)
 	}
 
-	orchestratorPath := strings.Replace(cliPath, "cli", "orchestrator", 1)
-
 	// Prepare orchestrator command
-	args := []string{workflowFile}
+	var args []string
+	if *matrixFile != "" {
+		args = append(args, "-matrix", *matrixFile)
+	}
+	if *parallelism > 0 {
+		args = append(args, "-parallelism", strconv.Itoa(*parallelism))
+	}
+	args = append(args, flags.Arg(0))
 
 	// Add initial data if provided
-	if len(os.Args) == 4 {
-		initialData := os.Args[3]
+	if flags.NArg() == 2 {
+		initialData := flags.Arg(1)
 
 		// Validate that initial data is valid YAML
 		var testData map[string]interface{}
@@ -84,18 +126,119 @@ func runWorkflow() {
 		args = append(args, initialData)
 	}
 
+	execOrchestrator(args)
+}
+
+// serveWorkflow runs the orchestrator in server mode so the workflow's
+// triggers keep starting runs until interrupted
+func serveWorkflow() {
+	if len(os.Args) < 3 {
+		fmt.Fprintf(os.Stderr, "Usage: %s serve [-addr 127.0.0.1:8080] <workflow_file.yaml> [initial_data_yaml]\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	execOrchestrator(append([]string{"serve"}, os.Args[2:]...))
+}
+
+// resumeRun continues suspended runs using the orchestrator; it exits with 75
+// when a run is still waiting
+func resumeRun() {
+	if len(os.Args) < 3 {
+		fmt.Fprintf(os.Stderr, "Usage: %s resume [-due] [run-id]\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	execOrchestrator(append([]string{"resume"}, os.Args[2:]...))
+}
+
+// sendEvent delivers an event to the suspended runs waiting for it
+func sendEvent() {
+	if len(os.Args) < 3 {
+		fmt.Fprintf(os.Stderr, "Usage: %s event [-correlation id] <name> [payload_yaml]\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	execOrchestrator(append([]string{"event"}, os.Args[2:]...))
+}
+
+// execOrchestrator runs the orchestrator binary with the given arguments and
+// exits with its exit code on failure. SIGINT and SIGTERM are forwarded to the
+// orchestrator, which cancels the run and stops its actions; if it has not
+// exited after the grace period it is killed.
+func execOrchestrator(args []string) {
 	// Execute the orchestrator
-	cmd := exec.Command(orchestratorPath, args...)
+	cmd := exec.Command(orchestratorPath(), args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
-	if err := cmd.Run(); err != nil {
-		if exitError, ok := err.(*exec.ExitError); ok {
-			os.Exit(exitError.ExitCode())
-		}
+	cmd.Stdin = os.Stdin
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	if err := cmd.Start(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error running orchestrator: %v\n", err)
 		os.Exit(1)
 	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	var killed bool
+	var deadline <-chan time.Time
+	for {
+		select {
+		case sig := <-signals:
+			cmd.Process.Signal(sig)
+			if deadline == nil {
+				fmt.Fprintf(os.Stderr, "%s Received %s, waiting up to %s for the orchestrator to stop\n", statusWARN, sig, shutdownTimeout())
+				deadline = time.After(shutdownTimeout())
+			}
+		case <-deadline:
+			fmt.Fprintf(os.Stderr, "%s Orchestrator did not stop in time, killing it\n", statusFAILED)
+			cmd.Process.Kill()
+			killed = true
+			deadline = nil
+		case err := <-exited:
+			if killed {
+				os.Exit(exitCancelled)
+			}
+			if err != nil {
+				if exitError, ok := err.(*exec.ExitError); ok {
+					os.Exit(exitError.ExitCode())
+				}
+				fmt.Fprintf(os.Stderr, "Error running orchestrator: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+}
+
+// orchestratorPath returns the orchestrator binary in the same directory as
+// the CLI
+func orchestratorPath() string {
+	cliPath, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error getting CLI path: %v\n", err)
+		os.Exit(1)
+	}
+
+	return strings.Replace(cliPath, "cli", "orchestrator", 1)
+}
+
+// shutdownTimeout is how long the orchestrator gets to stop after a signal:
+// one grace period for its actions, one for finally nodes, plus a margin.
+// The grace period is read from OCTA_GRACE_PERIOD like the orchestrator does.
+func shutdownTimeout() time.Duration {
+	grace := 10 * time.Second
+	if value := os.Getenv("OCTA_GRACE_PERIOD"); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			grace = d
+		}
+	}
+	return 2*grace + 5*time.Second
 }
 
 // validateWorkflow validates the syntax of a workflow YAML file
@@ -107,94 +250,40 @@ func validateWorkflow() {
 
 	workflowFile := os.Args[2]
 
-	// Read and parse the workflow file
-	data, err := os.ReadFile(workflowFile)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading workflow file: %v\n", err)
-		os.Exit(1)
-	}
-
-	// Basic YAML validation
-	var workflow map[string]interface{}
-	if err := yaml.Unmarshal(data, &workflow); err != nil {
-		fmt.Fprintf(os.Stderr, "Invalid YAML syntax: %v\n", err)
+	// Imports and templates are expanded on load, so that the workflow is
+	// validated the way it will run
+	e := engine.New()
+	if err := e.Load(workflowFile); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid workflow: %v\n", err)
 		os.Exit(1)
 	}
 
 	// Validate required fields
-	validationErrors := validateWorkflowStructure(workflow)
-	if len(validationErrors) > 0 {
+	var validationErr *engine.ValidationError
+	if err := e.Validate(); errors.As(err, &validationErr) {
 		fmt.Fprintf(os.Stderr, "Workflow validation failed:\n")
-		for _, err := range validationErrors {
-			fmt.Fprintf(os.Stderr, "  - %s\n", err)
+		for _, problem := range validationErr.Problems {
+			fmt.Fprintf(os.Stderr, "  - %s\n", problem)
 		}
 		os.Exit(1)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid workflow: %v\n", err)
+		os.Exit(1)
 	}
 
 	fmt.Printf("✅ Workflow file '%s' is valid\n", workflowFile)
 }
 
-// validateWorkflowStructure performs basic validation of workflow structure
-func validateWorkflowStructure(workflow map[string]interface{}) []string {
-	var errors []string
-
-	// Check required top-level fields
-	requiredFields := []string{"name", "description", "nodes"}
-	for _, field := range requiredFields {
-		if _, exists := workflow[field]; !exists {
-			errors = append(errors, fmt.Sprintf("Missing required field: %s", field))
-		}
+// renderWorkflow prints a workflow with its imports and node templates
+// expanded
+func renderWorkflow() {
+	if len(os.Args) != 3 {
+		fmt.Fprintf(os.Stderr, "Usage: %s render <workflow_file.yaml>\n", os.Args[0])
+		os.Exit(1)
 	}
 
-	// Validate nodes array
-	if nodesInterface, exists := workflow["nodes"]; exists {
-		if nodes, ok := nodesInterface.([]interface{}); ok {
-			if len(nodes) == 0 {
-				errors = append(errors, "Nodes array cannot be empty")
-			}
-
-			nodeIds := make(map[string]bool)
-			for i, nodeInterface := range nodes {
-				if node, ok := nodeInterface.(map[string]interface{}); ok {
-					// Check required node fields
-					nodeRequiredFields := []string{"id", "type", "inputs_from_workflow"}
-					for _, field := range nodeRequiredFields {
-						if _, exists := node[field]; !exists {
-							errors = append(errors, fmt.Sprintf("Node %d missing required field: %s", i, field))
-						}
-					}
-
-					// Check for duplicate node IDs
-					if idInterface, exists := node["id"]; exists {
-						if id, ok := idInterface.(string); ok {
-							if nodeIds[id] {
-								errors = append(errors, fmt.Sprintf("Duplicate node ID: %s", id))
-							}
-							nodeIds[id] = true
-
-							// Validate ID format
-							if strings.TrimSpace(id) == "" {
-								errors = append(errors, fmt.Sprintf("Node %d has empty ID", i))
-							}
-						}
-					}
-
-					// Validate type field
-					if typeInterface, exists := node["type"]; exists {
-						if typeStr, ok := typeInterface.(string); ok {
-							if strings.TrimSpace(typeStr) == "" {
-								errors = append(errors, fmt.Sprintf("Node %d has empty type", i))
-							}
-						}
-					}
-				} else {
-					errors = append(errors, fmt.Sprintf("Node %d is not a valid object", i))
-				}
-			}
-		} else {
-			errors = append(errors, "Nodes must be an array")
-		}
+	if err := engine.Render(os.Args[2], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error rendering workflow: %v\n", err)
+		os.Exit(1)
 	}
-
-	return errors
 }
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"slices"
+
+	"github.com/octo-agent/go-ai-agent-v1/actions/echo-json/echojson"
+	"github.com/octo-agent/go-ai-agent-v1/actions/httprequest/httprequest"
+	"github.com/octo-agent/go-ai-agent-v1/actions/writefile-json/writefile"
+	"github.com/octo-agent/go-ai-agent-v1/orchestrator/engine"
+)
+
+// The bundled actions run in-process. Their binaries are still used for
+// sandboxed nodes, and third-party actions are always spawned.
+func init() {
+	engine.RegisterManifest("echo-json", echojson.Manifest)
+	engine.RegisterManifest("writefile-json", writefile.Manifest)
+	engine.RegisterManifest("httprequest", httprequest.Manifest)
+
+	engine.RegisterBuiltin("echo-json", engine.TypedBuiltin(func(ctx context.Context, req engine.ActionRequest, input echojson.Input) (echojson.Output, error) {
+		return echojson.Run(input)
+	}))
+	engine.RegisterBuiltin("writefile-json", engine.TypedBuiltin(func(ctx context.Context, req engine.ActionRequest, input writefile.Input) (writefile.Output, error) {
+		return writefile.Run(input, req.LookupEnv, req.Dir)
+	}))
+	engine.RegisterBuiltin("httprequest", engine.TypedBuiltin(func(ctx context.Context, req engine.ActionRequest, input httprequest.Input) (httprequest.Output, error) {
+		return httprequest.Run(ctx, input, req.LookupEnv, req.MaxOutputBytes, req.TruncateOutput)
+	}))
+}
+
+// actionCommand runs a builtin action like its binary, reading YAML on stdin
+// and writing YAML to stdout, or printing its manifest when args hold
+// engine.DescribeFlag. The orchestrator runs it when invoked as
+// "action <type>" or under the action's name, e.g. through a symlink, so a
+// single binary can stand in for all the bundled actions.
+func actionCommand(actionType string, args []string) {
+	if slices.Contains(args, engine.DescribeFlag) {
+		manifest := engine.RegisteredManifest(actionType)
+		if manifest == nil {
+			log.Printf("Action %s has no manifest", actionType)
+			os.Exit(1)
+		}
+		os.Stdout.Write(manifest)
+		return
+	}
+	if err := engine.ServeBuiltin(context.Background(), actionType, os.Stdin, os.Stdout); err != nil {
+		log.Printf("Action %s failed: %v", actionType, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/octo-agent/go-ai-agent-v1/orchestrator/engine"
+)
+
+// benchmarkEngine returns an engine keeping its state in a temporary
+// directory, with the echo-json binary built into its ActionDir so that the
+// process runner has something to start
+func benchmarkEngine(b *testing.B, process bool) *engine.Engine {
+	b.Helper()
+
+	actionDir := b.TempDir()
+	build := exec.Command("go", "build", "-o", filepath.Join(actionDir, "echo-json"), ".")
+	build.Dir = filepath.Join("..", "actions", "echo-json")
+	if output, err := build.CombinedOutput(); err != nil {
+		b.Fatalf("building echo-json: %v\n%s", err, output)
+	}
+
+	logger := log.New(io.Discard, "", 0)
+	stateDir := b.TempDir()
+	e := engine.New()
+	e.Logger = logger
+	e.Store = &engine.FileStore{Dir: stateDir}
+	e.WorkDir = stateDir
+	e.ActionDir = actionDir
+	if process {
+		e.Runner = &engine.ProcessRunner{Logger: logger}
+	} else {
+		e.Runner = &engine.BuiltinRunner{Logger: logger, Next: &engine.ProcessRunner{Logger: logger}}
+	}
+	return e
+}
+
+func benchmarkEcho(b *testing.B, process bool) {
+	e := benchmarkEngine(b, process)
+	input := []byte("message: hello\n")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := e.RunAction(context.Background(), "echo-json", input); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkEchoBuiltin runs echo-json in-process
+func BenchmarkEchoBuiltin(b *testing.B) { benchmarkEcho(b, false) }
+
+// BenchmarkEchoProcess starts the echo-json binary for every call
+func BenchmarkEchoProcess(b *testing.B) { benchmarkEcho(b, true) }
+
+func benchmarkWorkflow(b *testing.B, process bool) {
+	e := benchmarkEngine(b, process)
+	e.Workflow = &engine.WorkflowV1{Name: "bench"}
+	for _, id := range []string{"first", "second", "third", "fourth", "fifth"} {
+		e.Workflow.Nodes = append(e.Workflow.Nodes, engine.NodeV1{
+			ID:                 id,
+			Type:               "echo-json",
+			InputsFromWorkflow: map[string]interface{}{"message": "{{.WorkflowData.message}}"},
+		})
+	}
+	data := map[string]interface{}{"message": "hello"}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := e.Run(context.Background(), data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkWorkflowBuiltin runs a five node echo-json workflow in-process
+func BenchmarkWorkflowBuiltin(b *testing.B) { benchmarkWorkflow(b, false) }
+
+// BenchmarkWorkflowProcess runs the same workflow with one process per node
+func BenchmarkWorkflowProcess(b *testing.B) { benchmarkWorkflow(b, true) }
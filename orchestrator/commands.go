@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/octo-agent/go-ai-agent-v1/orchestrator/engine"
+	"gopkg.in/yaml.v3"
+)
+
+// exitSuspended is the exit code of a run that was suspended at a wait node
+// (EX_TEMPFAIL: try again later)
+const exitSuspended = 75
+
+// resumeCommand resumes one suspended run, or with -due every run whose wait
+// is over, and exits with the outcome: 0 when all completed, exitSuspended
+// when a run is waiting, 1 on failure
+func resumeCommand(args []string) {
+	flags := flag.NewFlagSet("resume", flag.ExitOnError)
+	all := flags.Bool("due", false, "resume every suspended run whose wait is over")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s resume [-due] [run-id]\n", os.Args[0])
+		os.Exit(1)
+	}
+	flags.Parse(args)
+	if (*all && flags.NArg() != 0) || (!*all && flags.NArg() != 1) {
+		flags.Usage()
+	}
+
+	e := engine.New()
+	runIDs := flags.Args()
+	if *all {
+		var err error
+		if runIDs, err = e.DueRuns(""); err != nil {
+			log.Fatalf("Failed to list suspended runs: %v %s", err, statusFAILED)
+		}
+		if len(runIDs) == 0 {
+			log.Printf("No suspended runs are due %s", statusINFO)
+			return
+		}
+	}
+
+	shutdownTracing := initTracing()
+	ctx, stop := withSignals(contextFromEnv(context.Background()))
+
+	code := 0
+	for _, runID := range runIDs {
+		if ctx.Err() != nil {
+			break
+		}
+		result, err := e.Resume(ctx, runID)
+		switch {
+		case err == nil:
+			log.Printf("Run %s completed successfully %s", runID, statusOK)
+		case result.Status == engine.RunWaiting:
+			log.Printf("Run %s is waiting %s", runID, statusINFO)
+			if code == 0 {
+				code = exitSuspended
+			}
+		case result.Status == engine.RunCancelled:
+			log.Printf("Run %s cancelled: %v %s", runID, err, statusWARN)
+			if code != 1 {
+				code = exitCancelled
+			}
+		default:
+			log.Printf("Run %s failed: %v %s", runID, err, statusFAILED)
+			code = 1
+		}
+	}
+
+	e.Close()
+	shutdownTracing()
+	stop()
+	os.Exit(code)
+}
+
+// eventCommand delivers an event to the suspended runs waiting for it. The
+// runs continue on their next resume, which the server does by itself.
+func eventCommand(args []string) {
+	flags := flag.NewFlagSet("event", flag.ExitOnError)
+	correlationID := flags.String("correlation", "", "correlation ID of the event")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s event [-correlation id] <name> [payload_yaml]\n", os.Args[0])
+		os.Exit(1)
+	}
+	flags.Parse(args)
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		flags.Usage()
+	}
+
+	var payload interface{}
+	if flags.NArg() == 2 {
+		if err := yaml.Unmarshal([]byte(flags.Arg(1)), &payload); err != nil {
+			log.Fatalf("Error parsing event payload YAML: %v", err)
+		}
+	}
+
+	runIDs, err := engine.New().DeliverEvent(flags.Arg(0), *correlationID, payload)
+	if err != nil {
+		log.Fatalf("Failed to deliver event: %v %s", err, statusFAILED)
+	}
+	if len(runIDs) == 0 && *correlationID == "" {
+		log.Printf("No suspended run is waiting for event %s %s", flags.Arg(0), statusWARN)
+		os.Exit(1)
+	}
+	if len(runIDs) == 0 {
+		log.Printf("Stored event %s (%s) until a run waits for it %s", flags.Arg(0), *correlationID, statusOK)
+	}
+	for _, runID := range runIDs {
+		log.Printf("Delivered event %s to run %s %s", flags.Arg(0), runID, statusOK)
+	}
+}
@@ -0,0 +1,230 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Default I/O limits applied when a node does not set its own
+const (
+	defaultMaxInputBytes  = 16 << 20 // 16 MiB
+	defaultMaxOutputBytes = 16 << 20 // 16 MiB
+	maxStderrBytes        = 1 << 20  // stderr is only logged, always truncated
+)
+
+// EnvPolicyV1 controls the environment an action process receives
+type EnvPolicyV1 struct {
+	Inherit string            `yaml:"inherit,omitempty"` // all (default), none, or allowlist
+	Allow   []string          `yaml:"allow,omitempty"`   // Inherited variable names, or PREFIX_* patterns, for allowlist
+	Vars    map[string]string `yaml:"vars,omitempty"`    // Variables to set; values are templated
+}
+
+// newActionRequest builds the invocation of a node's action, resolving
+// templates in its environment variables and working directory. Non-nil
+// permissions are passed to the action in its environment.
+func (e *Engine) newActionRequest(node NodeV1, templateCtx *TemplateContext, permissions *PermissionsV1) (ActionRequest, error) {
+	req := ActionRequest{
+		RunID:          templateCtx.Run.ID,
+		NodeID:         node.ID,
+		Type:           node.Type,
+		Path:           e.actionPath(node.Type),
+		MaxOutputBytes: defaultMaxOutputBytes,
+		Logger:         e.Logger,
+		GracePeriod:    e.GracePeriod,
+	}
+
+	if node.MaxOutputBytes < 0 {
+		return req, fmt.Errorf("max_output_bytes must be positive, got %d", node.MaxOutputBytes)
+	}
+	if node.MaxOutputBytes > 0 {
+		req.MaxOutputBytes = node.MaxOutputBytes
+	}
+
+	switch node.OnOutputLimit {
+	case "", "fail":
+	case "truncate":
+		req.TruncateOutput = true
+	default:
+		return req, fmt.Errorf("on_output_limit must be fail or truncate, got %q", node.OnOutputLimit)
+	}
+
+	if node.WorkingDir != "" {
+		dir, err := resolveTemplateString(node.WorkingDir, templateCtx)
+		if err != nil {
+			return req, fmt.Errorf("failed to resolve working_dir: %w", err)
+		}
+		info, err := os.Stat(dir)
+		if err != nil {
+			return req, fmt.Errorf("working_dir %s is not usable: %w", dir, err)
+		}
+		if !info.IsDir() {
+			return req, fmt.Errorf("working_dir %s is not a directory", dir)
+		}
+		if req.Dir, err = filepath.Abs(dir); err != nil {
+			return req, fmt.Errorf("failed to resolve working_dir: %w", err)
+		}
+	}
+
+	if node.Env != nil {
+		env, err := buildActionEnv(node.Env, templateCtx)
+		if err != nil {
+			return req, err
+		}
+		req.Env = env
+	}
+
+	// WebAssembly actions only see the variables their node passes them
+	if req.Env == nil && isWasmAction(req.Path) {
+		req.Env = []string{}
+	}
+
+	if permissions != nil {
+		env, err := withPermissionsEnv(req.Env, permissions)
+		if err != nil {
+			return req, err
+		}
+		req.Env = env
+	}
+
+	manifest, err := e.LoadActionManifest(node.Type)
+	if err != nil {
+		return req, err
+	}
+	req.Worker = manifest.Worker
+
+	// A node's sandbox policy takes precedence over its action's default
+	policy := node.Sandbox
+	if policy == nil {
+		policy = manifest.Sandbox
+	}
+	if policy != nil {
+		if req.sandbox, err = resolveSandboxSpec(policy, req.Path, templateCtx); err != nil {
+			return req, fmt.Errorf("invalid sandbox policy: %w", err)
+		}
+		req.SandboxPolicy = policy
+	}
+
+	return req, nil
+}
+
+// buildActionEnv applies an environment policy to the orchestrator's environment
+func buildActionEnv(policy *EnvPolicyV1, templateCtx *TemplateContext) ([]string, error) {
+	inherit := policy.Inherit
+	if inherit == "" {
+		inherit = "all"
+		if len(policy.Allow) > 0 {
+			inherit = "allowlist"
+		}
+	}
+
+	env := make(map[string]string)
+	switch inherit {
+	case "all":
+		for _, entry := range os.Environ() {
+			if name, value, ok := strings.Cut(entry, "="); ok {
+				env[name] = value
+			}
+		}
+	case "allowlist":
+		for _, entry := range os.Environ() {
+			if name, value, ok := strings.Cut(entry, "="); ok && envAllowed(name, policy.Allow) {
+				env[name] = value
+			}
+		}
+	case "none":
+	default:
+		return nil, fmt.Errorf("env inherit must be all, none or allowlist, got %q", policy.Inherit)
+	}
+
+	for name, value := range policy.Vars {
+		resolved, err := resolveTemplateString(value, templateCtx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve env var %s: %w", name, err)
+		}
+		env[name] = resolved
+	}
+
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		result = append(result, name+"="+env[name])
+	}
+	return result, nil
+}
+
+// envAllowed reports whether name matches an allowlist entry. Entries ending
+// in * match by prefix.
+func envAllowed(name string, allow []string) bool {
+	for _, pattern := range allow {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveTemplateString resolves templates in a single string value
+func resolveTemplateString(value string, templateCtx *TemplateContext) (string, error) {
+	resolved, err := resolveTemplates(map[string]interface{}{"value": value}, templateCtx)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprint(resolved["value"]), nil
+}
+
+// limitedBuffer captures process output up to a limit. Writes beyond the limit
+// are discarded but still accepted, so the process never blocks on a full
+// pipe; onExceed is called once when the limit is first crossed.
+type limitedBuffer struct {
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	limit    int64
+	exceeded bool
+	onExceed func()
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	remaining := b.limit - int64(b.buf.Len())
+	if int64(len(p)) <= remaining {
+		return b.buf.Write(p)
+	}
+
+	if remaining > 0 {
+		b.buf.Write(p[:remaining])
+	}
+	if !b.exceeded {
+		b.exceeded = true
+		if b.onExceed != nil {
+			b.onExceed()
+		}
+	}
+	return len(p), nil
+}
+
+// Exceeded reports whether output was discarded
+func (b *limitedBuffer) Exceeded() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.exceeded
+}
+
+func (b *limitedBuffer) Bytes() []byte  { return b.buf.Bytes() }
+func (b *limitedBuffer) String() string { return b.buf.String() }
+func (b *limitedBuffer) Len() int       { return b.buf.Len() }
@@ -0,0 +1,316 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ActionManifest describes an installed action. It is read from
+// <action>.action.yaml next to the action binary or module, or registered
+// with RegisterManifest for builtin actions, and is optional. Actions print
+// their manifest when run with DescribeFlag.
+type ActionManifest struct {
+	Name        string            `yaml:"name"`
+	Version     string            `yaml:"version,omitempty"`
+	Description string            `yaml:"description,omitempty"`
+	Sandbox     *SandboxPolicyV1  `yaml:"sandbox,omitempty"` // Default sandbox for nodes using this action
+	Worker      *WorkerV1         `yaml:"worker,omitempty"`  // Set if the action can serve many requests from one process
+	Input       *Schema           `yaml:"input,omitempty"`   // Checks and coerces the rendered input of nodes
+	Output      *Schema           `yaml:"output,omitempty"`  // Checks and coerces the action's output
+	Example     interface{}       `yaml:"example,omitempty"` // Sample inputs_from_workflow, checked against Input
+	Errors      []DocumentedError `yaml:"errors,omitempty"`  // Failures the action reports
+
+	Source string `yaml:"-"` // Where the manifest was found: its file, "builtin" or "describe"; empty if the action has none
+}
+
+// DocumentedError describes a failure of an action. Code is the message the
+// action reports along with the error's detail.
+type DocumentedError struct {
+	Code        string `yaml:"code" json:"code"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+}
+
+// InstalledAction is an action found by ListActions
+type InstalledAction struct {
+	Type    string
+	Path    string // Binary or WebAssembly module; empty for builtin actions without one
+	Builtin bool   // Registered with RegisterBuiltin or RegisterManifest
+}
+
+// DescribeFlag asks an action binary to print its manifest as YAML instead
+// of running. The orchestrator never runs actions just to describe them; it
+// reads manifest files, which can be generated with the flag.
+const DescribeFlag = "--describe"
+
+var (
+	manifestsMu sync.RWMutex
+	manifests   = make(map[string][]byte)
+)
+
+// RegisterManifest sets the manifest of an action type whose binary has no
+// manifest file, typically a builtin action. It is meant to be called from
+// init functions and panics if the manifest is invalid.
+func RegisterManifest(actionType string, data []byte) {
+	var manifest ActionManifest
+	if err := decodeManifest(data, &manifest); err != nil {
+		panic("engine: invalid manifest for action " + actionType + ": " + err.Error())
+	}
+
+	manifestsMu.Lock()
+	defer manifestsMu.Unlock()
+	manifests[actionType] = data
+}
+
+// RegisteredManifest returns the manifest registered for an action type, or
+// nil if there is none
+func RegisteredManifest(actionType string) []byte {
+	manifestsMu.RLock()
+	defer manifestsMu.RUnlock()
+	return manifests[actionType]
+}
+
+// wasmExt is the extension of actions compiled to WebAssembly
+const wasmExt = ".wasm"
+
+// actionPath returns the path of an action binary in the engine's ActionDir,
+// or of its WebAssembly module if there is no native binary
+func (e *Engine) actionPath(actionType string) string {
+	path := filepath.Join(e.ActionDir, actionType)
+	if _, err := os.Stat(path); err != nil {
+		if _, err := os.Stat(path + wasmExt); err == nil {
+			return path + wasmExt
+		}
+	}
+	return path
+}
+
+// isWasmAction reports whether an action path is a WebAssembly module
+func isWasmAction(path string) bool {
+	return strings.HasSuffix(path, wasmExt)
+}
+
+// LoadActionManifest reads the manifest of an action from its file, or else
+// the registered one, without running the action. Actions without a
+// manifest yield an empty one named after the action type.
+func (e *Engine) LoadActionManifest(actionType string) (*ActionManifest, error) {
+	manifest := &ActionManifest{Name: actionType, Source: e.manifestPath(actionType)}
+	data, err := os.ReadFile(manifest.Source)
+	if errors.Is(err, fs.ErrNotExist) {
+		manifest.Source = ""
+		if data = RegisteredManifest(actionType); data != nil {
+			manifest.Source = "builtin"
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("invalid manifest for action %s: %w", actionType, err)
+	}
+	if err := decodeManifest(data, manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest for action %s: %w", actionType, err)
+	}
+	return manifest, nil
+}
+
+// DescribeAction returns the manifest of an action. Unlike runs, which only
+// read manifests, it asks an action without one to print it with
+// DescribeFlag; actions that do not support the flag yield an empty one.
+func (e *Engine) DescribeAction(ctx context.Context, actionType string) (*ActionManifest, error) {
+	manifest, err := e.LoadActionManifest(actionType)
+	if err != nil || manifest.Source != "" {
+		return manifest, err
+	}
+	path := e.actionPath(actionType)
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("action %s not found in %s", actionType, e.ActionDir)
+	}
+	if isWasmAction(path) {
+		return manifest, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, describeTimeout)
+	defer cancel()
+	// The timeout kills the action's whole process group, and stops waiting
+	// for output from children that survive it
+	cmd := exec.CommandContext(ctx, path, DescribeFlag)
+	cmd.Stdin = strings.NewReader("")
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error { return signalProcessGroup(cmd, syscall.SIGKILL) }
+	cmd.WaitDelay = describeWaitDelay
+	data, err := cmd.Output()
+	if err != nil || len(bytes.TrimSpace(data)) == 0 {
+		return manifest, nil
+	}
+	// Output without a name is the action running rather than describing itself
+	described := &ActionManifest{Source: "describe"}
+	err = decodeManifest(data, described)
+	if described.Name == "" {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid manifest printed by action %s: %w", actionType, err)
+	}
+	return described, nil
+}
+
+// ListActions returns the actions in the engine's ActionDir, found by their
+// binaries and WebAssembly modules, and the builtin actions, sorted by type.
+// The running executable is not an action.
+func (e *Engine) ListActions() ([]InstalledAction, error) {
+	entries, err := os.ReadDir(e.ActionDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read action directory: %w", err)
+	}
+	var self fs.FileInfo
+	if executable, err := os.Executable(); err == nil {
+		self, _ = os.Stat(executable)
+	}
+
+	found := make(map[string]string)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		path := filepath.Join(e.ActionDir, entry.Name())
+		if self != nil && os.SameFile(info, self) {
+			continue
+		}
+		actionType := entry.Name()
+		if isWasmAction(path) {
+			actionType = strings.TrimSuffix(actionType, wasmExt)
+		} else if info.Mode().Perm()&0o111 == 0 {
+			continue
+		}
+		// A native binary takes precedence over a module, as in actionPath
+		if _, exists := found[actionType]; !exists || !isWasmAction(path) {
+			found[actionType] = path
+		}
+	}
+
+	builtin := make(map[string]bool)
+	manifestsMu.RLock()
+	for actionType := range manifests {
+		builtin[actionType] = true
+	}
+	manifestsMu.RUnlock()
+	for _, actionType := range Builtins() {
+		builtin[actionType] = true
+	}
+	for actionType := range builtin {
+		if _, exists := found[actionType]; !exists {
+			found[actionType] = ""
+		}
+	}
+
+	actions := make([]InstalledAction, 0, len(found))
+	for actionType, path := range found {
+		actions = append(actions, InstalledAction{Type: actionType, Path: path, Builtin: builtin[actionType]})
+	}
+	sort.Slice(actions, func(i, j int) bool { return actions[i].Type < actions[j].Type })
+	return actions, nil
+}
+
+// describeTimeout bounds how long an action may take to print its manifest,
+// and describeWaitDelay how long its output is read after it was killed
+const (
+	describeTimeout   = 5 * time.Second
+	describeWaitDelay = time.Second
+)
+
+// isBuiltinNodeType reports whether nodes of a type are run by the engine
+// itself rather than by an action
+func isBuiltinNodeType(nodeType string) bool {
+	switch nodeType {
+	case approvalNodeType, switchNodeType, scriptNodeType, sleepNodeType, eventNodeType:
+		return true
+	}
+	return false
+}
+
+// manifestPath returns the path of an action's manifest file
+func (e *Engine) manifestPath(actionType string) string {
+	return filepath.Join(e.ActionDir, actionType) + ".action.yaml"
+}
+
+// decodeManifest parses a manifest and checks its schemas
+func decodeManifest(data []byte, manifest *ActionManifest) error {
+	if err := yaml.Unmarshal(data, manifest); err != nil {
+		return err
+	}
+	problems := manifest.Input.check("input")
+	problems = append(problems, manifest.Output.check("output")...)
+	if manifest.Example != nil && len(problems) == 0 {
+		problems = append(problems, manifest.Input.checkTemplated(manifest.Example, "example")...)
+	}
+	for i, documented := range manifest.Errors {
+		if documented.Code == "" {
+			problems = append(problems, fmt.Sprintf("errors[%d]: missing code", i))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// coerceActionInput checks the input of an action against the input schema
+// of its manifest, if any, and converts it to the declared types
+func coerceActionInput(actionType string, schema *Schema, input map[string]interface{}) (map[string]interface{}, error) {
+	if schema == nil {
+		return input, nil
+	}
+	if input == nil {
+		input = make(map[string]interface{})
+	}
+	coerced, problems := schema.Coerce(input, "input")
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("input does not match the schema of %s: %s", actionType, strings.Join(problems, "; "))
+	}
+	input, _ = coerced.(map[string]interface{})
+	return input, nil
+}
+
+// coerceActionInputYAML is coerceActionInput for input already marshalled
+// to YAML
+func coerceActionInputYAML(actionType string, schema *Schema, input []byte) ([]byte, error) {
+	if schema == nil {
+		return input, nil
+	}
+	var decoded map[string]interface{}
+	if err := yaml.Unmarshal(input, &decoded); err != nil {
+		return nil, fmt.Errorf("invalid input YAML: %w", err)
+	}
+	decoded, err := coerceActionInput(actionType, schema, decoded)
+	if err != nil {
+		return nil, err
+	}
+	if input, err = yaml.Marshal(decoded); err != nil {
+		return nil, fmt.Errorf("failed to marshal input YAML: %w", err)
+	}
+	return input, nil
+}
+
+// coerceActionOutput checks the output of an action against the output
+// schema of its manifest, if any, and converts it to the declared types
+func coerceActionOutput(actionType string, schema *Schema, output map[string]interface{}) (map[string]interface{}, error) {
+	if schema == nil {
+		return output, nil
+	}
+	coerced, problems := schema.Coerce(output, "output")
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("action output does not match the schema of %s: %s", actionType, strings.Join(problems, "; "))
+	}
+	output, _ = coerced.(map[string]interface{})
+	return output, nil
+}
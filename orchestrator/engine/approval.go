@@ -0,0 +1,421 @@
+package engine
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// approvalNodeType is the built-in node that suspends a run until a person
+// approves or rejects it. Its inputs are:
+//
+//	message:   prompt shown to the approver
+//	timeout:   how long to wait, e.g. 30m (default: forever)
+//	default:   approve or reject; the decision taken on timeout (default: fail)
+//	on_reject: fail (default) or continue with approved: false in the output
+const approvalNodeType = "approval"
+
+// Approval statuses
+const (
+	approvalPending   = "pending"
+	approvalApproved  = "approved"
+	approvalRejected  = "rejected"
+	approvalTimedOut  = "timed_out"
+	approvalCancelled = "cancelled"
+)
+
+// approvalPollInterval is how often a node waiting in process checks for a
+// decision
+const approvalPollInterval = 500 * time.Millisecond
+
+// ApprovalRecord is the persisted state of an approval node
+type ApprovalRecord struct {
+	RunID       string `yaml:"run_id" json:"run_id"`
+	Node        string `yaml:"node" json:"node"`
+	Message     string `yaml:"message" json:"message"`
+	Status      string `yaml:"status" json:"status"`
+	RequestedAt string `yaml:"requested_at" json:"requested_at"`
+	ExpiresAt   string `yaml:"expires_at,omitempty" json:"expires_at,omitempty"`
+	Default     string `yaml:"default,omitempty" json:"default,omitempty"` // Decision taken on timeout
+}
+
+// ApprovalDecision answers an approval. The first decision written wins.
+type ApprovalDecision struct {
+	Decision  string `yaml:"decision" json:"decision"` // approved or rejected
+	Approver  string `yaml:"approver,omitempty" json:"approver,omitempty"`
+	Comment   string `yaml:"comment,omitempty" json:"comment,omitempty"`
+	DecidedAt string `yaml:"decided_at" json:"decided_at"`
+	TimedOut  bool   `yaml:"timed_out,omitempty" json:"timed_out,omitempty"`
+}
+
+// ErrApprovalDecided is returned when an approval has already been decided
+var ErrApprovalDecided = errors.New("approval has already been decided")
+
+// approvalKey returns the state key of an approval node
+func approvalKey(runID, node string) string {
+	return runKey(runID, "approvals/"+node+".yaml")
+}
+
+// decisionKey returns the key holding the decision of an approval node
+func decisionKey(runID, node string) string {
+	return runKey(runID, "approvals/"+node+".decision.yaml")
+}
+
+// executeApproval completes an approval node once it has been decided or
+// its timeout has passed. Until then the run is suspended like at a durable
+// wait, unless the engine is Interactive: then the approver is prompted on
+// the terminal and the run waits in process.
+func (e *Engine) executeApproval(ctx context.Context, node NodeV1, templateCtx *TemplateContext) (map[string]interface{}, error) {
+	var wait WaitState
+	if resumed := templateCtx.resumed; resumed != nil && resumed.Node == node.ID {
+		wait = *resumed
+	} else {
+		var request ApprovalRecord
+		var err error
+		if wait, request, err = newApprovalWait(node, templateCtx); err != nil {
+			return nil, err
+		}
+		if err := e.Store.Write(approvalKey(request.RunID, node.ID), request); err != nil {
+			return nil, fmt.Errorf("failed to save approval request: %w", err)
+		}
+		e.Logger.Printf("Node %s is waiting for approval: %s %s", node.ID, request.Message, statusWARN)
+	}
+
+	runID := templateCtx.Run.ID
+	if output, done, err := e.approvalOutcome(runID, wait); done {
+		return output, err
+	}
+	if !e.Interactive {
+		return nil, &suspension{wait: wait}
+	}
+
+	var request ApprovalRecord
+	if err := e.Store.Read(approvalKey(runID, node.ID), &request); err != nil {
+		return nil, err
+	}
+	promptCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go e.promptApproval(promptCtx, request)
+
+	ticker := time.NewTicker(approvalPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			e.setApprovalStatus(runID, node.ID, approvalCancelled)
+			return nil, fmt.Errorf("approval cancelled: %w", context.Cause(ctx))
+		case <-ticker.C:
+		}
+		if output, done, err := e.approvalOutcome(runID, wait); done {
+			return output, err
+		}
+	}
+}
+
+// newApprovalWait resolves the inputs of an approval node into the wait of
+// the run and the request shown to approvers
+func newApprovalWait(node NodeV1, templateCtx *TemplateContext) (WaitState, ApprovalRecord, error) {
+	wait := WaitState{Node: node.ID, Type: approvalNodeType}
+	var request ApprovalRecord
+
+	inputs, err := resolveTemplates(node.InputsFromWorkflow, templateCtx)
+	if err != nil {
+		return wait, request, fmt.Errorf("failed to resolve templates: %w", err)
+	}
+
+	message, _ := inputs["message"].(string)
+	if message == "" {
+		message = fmt.Sprintf("Continue the run past node %s?", node.ID)
+	}
+	if wait.Default, err = ParseDecision(inputs["default"]); err != nil {
+		return wait, request, fmt.Errorf("invalid default: %w", err)
+	}
+	wait.OnReject, _ = inputs["on_reject"].(string)
+	if wait.OnReject != "" && wait.OnReject != "fail" && wait.OnReject != "continue" {
+		return wait, request, fmt.Errorf("invalid on_reject %q: must be fail or continue", wait.OnReject)
+	}
+
+	now := time.Now().UTC()
+	if value, ok := inputs["timeout"]; ok && fmt.Sprint(value) != "" {
+		timeout, err := time.ParseDuration(fmt.Sprint(value))
+		if err != nil || timeout <= 0 {
+			return wait, request, fmt.Errorf("invalid timeout %q: must be a positive duration such as 30m or 12h", fmt.Sprint(value))
+		}
+		wait.TimeoutAt = now.Add(timeout).Format(time.RFC3339)
+	}
+
+	request = ApprovalRecord{
+		RunID:       templateCtx.Run.ID,
+		Node:        node.ID,
+		Message:     message,
+		Status:      approvalPending,
+		RequestedAt: now.Format(time.RFC3339),
+		ExpiresAt:   wait.TimeoutAt,
+		Default:     wait.Default,
+	}
+	return wait, request, nil
+}
+
+// approvalOutcome returns the output of an approval node and true once it
+// has been decided, taking the default decision if its timeout has passed
+func (e *Engine) approvalOutcome(runID string, wait WaitState) (map[string]interface{}, bool, error) {
+	decision, err := e.readDecision(runID, wait.Node)
+	if err != nil {
+		return nil, true, err
+	}
+
+	if decision == nil && wait.TimeoutAt != "" && !time.Now().Before(parseTime(wait.TimeoutAt)) {
+		if wait.Default == "" {
+			e.setApprovalStatus(runID, wait.Node, approvalTimedOut)
+			return nil, true, fmt.Errorf("approval timed out at %s", wait.TimeoutAt)
+		}
+		timedOut := ApprovalDecision{Decision: wait.Default, TimedOut: true}
+		if err := e.DecideApproval(runID, wait.Node, timedOut); err != nil && !errors.Is(err, ErrApprovalDecided) {
+			return nil, true, err
+		}
+		if decision, err = e.readDecision(runID, wait.Node); err != nil {
+			return nil, true, err
+		}
+	}
+	if decision == nil {
+		return nil, false, nil
+	}
+
+	status := decision.Decision
+	if decision.TimedOut {
+		status = approvalTimedOut
+	}
+	e.setApprovalStatus(runID, wait.Node, status)
+	output, err := e.approvalOutput(wait.Node, decision, wait.OnReject)
+	return output, true, err
+}
+
+// setApprovalStatus updates the status of an approval request
+func (e *Engine) setApprovalStatus(runID, node, status string) {
+	var request ApprovalRecord
+	key := approvalKey(runID, node)
+	err := e.Store.Read(key, &request)
+	if err == nil {
+		request.Status = status
+		err = e.Store.Write(key, request)
+	}
+	if err != nil {
+		e.Logger.Printf("Failed to update approval request: %v %s", err, statusWARN)
+	}
+}
+
+// approvalOutput turns a decision into the node's output; a rejection fails
+// the node unless on_reject is continue
+func (e *Engine) approvalOutput(node string, decision *ApprovalDecision, onReject string) (map[string]interface{}, error) {
+	approved := decision.Decision == approvalApproved
+	who := decision.Approver
+	if decision.TimedOut {
+		who = "default after timeout"
+	}
+	e.Logger.Printf("Node %s was %s by %s %s", node, decision.Decision, who, statusINFO)
+
+	if !approved && onReject != "continue" {
+		if decision.Comment != "" {
+			return nil, fmt.Errorf("rejected by %s: %s", who, decision.Comment)
+		}
+		return nil, fmt.Errorf("rejected by %s", who)
+	}
+
+	return map[string]interface{}{
+		"approved":   approved,
+		"decision":   decision.Decision,
+		"approver":   decision.Approver,
+		"comment":    decision.Comment,
+		"decided_at": decision.DecidedAt,
+		"timed_out":  decision.TimedOut,
+	}, nil
+}
+
+// ParseDecision accepts approve/approved and reject/rejected, returning
+// approved or rejected; an empty value means no decision
+func ParseDecision(value interface{}) (string, error) {
+	if value == nil {
+		return "", nil
+	}
+	switch s := strings.ToLower(strings.TrimSpace(fmt.Sprint(value))); s {
+	case "":
+		return "", nil
+	case "approve", "approved":
+		return approvalApproved, nil
+	case "reject", "rejected":
+		return approvalRejected, nil
+	default:
+		return "", fmt.Errorf("%q is not approve or reject", s)
+	}
+}
+
+// readDecision returns the decision of an approval node, or nil if there is
+// none yet
+func (e *Engine) readDecision(runID, node string) (*ApprovalDecision, error) {
+	var decision ApprovalDecision
+	if err := e.Store.Read(decisionKey(runID, node), &decision); err != nil {
+		return nil, err
+	}
+	if decision.Decision == "" {
+		return nil, nil
+	}
+	return &decision, nil
+}
+
+// DecideApproval records the decision of a pending approval. The decision is
+// created atomically and never replaced, so concurrent approvers cannot both
+// win; the loser gets ErrApprovalDecided.
+func (e *Engine) DecideApproval(runID, node string, decision ApprovalDecision) error {
+	var request ApprovalRecord
+	if err := e.Store.Read(approvalKey(runID, node), &request); err != nil {
+		return err
+	}
+	if request.Status == "" {
+		return fmt.Errorf("run %s has no approval node %s", runID, node)
+	}
+	if request.Status != approvalPending {
+		return ErrApprovalDecided
+	}
+
+	decision.Decision, _ = ParseDecision(decision.Decision)
+	if decision.Decision == "" {
+		return fmt.Errorf("decision must be approve or reject")
+	}
+	if decision.DecidedAt == "" {
+		decision.DecidedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	if err := e.Store.Create(decisionKey(runID, node), decision); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return ErrApprovalDecided
+		}
+		return fmt.Errorf("failed to write decision: %w", err)
+	}
+	return nil
+}
+
+// PendingApprovals lists the approvals waiting for a decision, oldest first
+func (e *Engine) PendingApprovals() ([]ApprovalRecord, error) {
+	keys, err := e.Store.List("runs/*/approvals/*.yaml")
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []ApprovalRecord
+	for _, key := range keys {
+		if strings.HasSuffix(key, ".decision.yaml") {
+			continue
+		}
+		var request ApprovalRecord
+		if err := e.Store.Read(key, &request); err != nil || request.Status != approvalPending {
+			continue
+		}
+		if decision, _ := e.readDecision(request.RunID, request.Node); decision != nil {
+			continue
+		}
+		pending = append(pending, request)
+	}
+
+	sort.Slice(pending, func(i, j int) bool { return pending[i].RequestedAt < pending[j].RequestedAt })
+	return pending, nil
+}
+
+var (
+	stdinOnce  sync.Once
+	stdinLines chan string
+	promptMu   sync.Mutex // One prompt on the terminal at a time
+)
+
+// readStdinLines returns the lines typed on stdin. A single reader serves all
+// prompts so that an abandoned prompt does not swallow the next answer.
+func readStdinLines() <-chan string {
+	stdinOnce.Do(func() {
+		stdinLines = make(chan string)
+		go func() {
+			scanner := bufio.NewScanner(os.Stdin)
+			for scanner.Scan() {
+				stdinLines <- scanner.Text()
+			}
+			close(stdinLines)
+		}()
+	})
+	return stdinLines
+}
+
+// promptApproval asks on the terminal for a decision and records it, unless
+// ctx ends first because the approval was decided elsewhere
+func (e *Engine) promptApproval(ctx context.Context, request ApprovalRecord) {
+	promptMu.Lock()
+	defer promptMu.Unlock()
+
+	ask := func(prompt string) (string, bool) {
+		fmt.Fprint(os.Stderr, prompt)
+		select {
+		case line, ok := <-readStdinLines():
+			return strings.TrimSpace(line), ok
+		case <-ctx.Done():
+			fmt.Fprintln(os.Stderr)
+			return "", false
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "\nApproval required for node %s of run %s:\n  %s\n", request.Node, request.RunID, request.Message)
+	if request.ExpiresAt != "" {
+		fmt.Fprintf(os.Stderr, "  (%s automatically at %s)\n", defaultOrFail(request.Default), request.ExpiresAt)
+	}
+
+	var decision string
+	for decision == "" {
+		answer, ok := ask("Approve? [y/n]: ")
+		if !ok {
+			return
+		}
+		switch strings.ToLower(answer) {
+		case "y", "yes":
+			decision = approvalApproved
+		case "n", "no":
+			decision = approvalRejected
+		}
+	}
+	comment, ok := ask("Comment (optional): ")
+	if !ok {
+		return
+	}
+
+	err := e.DecideApproval(request.RunID, request.Node, ApprovalDecision{
+		Decision: decision,
+		Approver: currentUser(),
+		Comment:  comment,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %v\n", statusWARN, err)
+	}
+}
+
+// defaultOrFail describes what happens when an approval times out
+func defaultOrFail(decision string) string {
+	switch decision {
+	case approvalApproved:
+		return "is approved"
+	case approvalRejected:
+		return "is rejected"
+	default:
+		return "fails"
+	}
+}
+
+// currentUser identifies the person answering a prompt
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
@@ -0,0 +1,137 @@
+package engine
+
+import (
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testEngine returns an engine keeping its state in a temporary directory
+func testEngine(t *testing.T) *Engine {
+	t.Helper()
+
+	dir := t.TempDir()
+	e := New()
+	e.Logger = log.New(io.Discard, "", 0)
+	e.Store = &FileStore{Dir: dir}
+	e.WorkDir = dir
+	return e
+}
+
+// requestApproval stores a pending approval request as an approval node does
+func requestApproval(t *testing.T, e *Engine, runID, node string) {
+	t.Helper()
+
+	request := ApprovalRecord{RunID: runID, Node: node, Status: approvalPending}
+	if err := e.Store.Write(approvalKey(runID, node), request); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseDecision(t *testing.T) {
+	tests := []struct {
+		value   interface{}
+		want    string
+		wantErr bool
+	}{
+		{nil, "", false},
+		{"", "", false},
+		{"  ", "", false},
+		{"approve", approvalApproved, false},
+		{"Approved", approvalApproved, false},
+		{" reject ", approvalRejected, false},
+		{"REJECTED", approvalRejected, false},
+		{"yes", "", true},
+		{true, "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDecision(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseDecision(%#v) = %q, %v; want %q, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestDefaultOrFail(t *testing.T) {
+	tests := map[string]string{
+		approvalApproved: "is approved",
+		approvalRejected: "is rejected",
+		"":               "fails",
+	}
+	for decision, want := range tests {
+		if got := defaultOrFail(decision); got != want {
+			t.Errorf("defaultOrFail(%q) = %q, want %q", decision, got, want)
+		}
+	}
+}
+
+func TestApprovalOutcomeTimeout(t *testing.T) {
+	past := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	tests := []struct {
+		name     string
+		wait     WaitState
+		done     bool
+		approved bool
+		err      string
+	}{
+		{"pending", WaitState{TimeoutAt: future, Default: approvalApproved}, false, false, ""},
+		{"no timeout", WaitState{}, false, false, ""},
+		{"timed out without default", WaitState{TimeoutAt: past}, true, false, "approval timed out"},
+		{"timed out approved", WaitState{TimeoutAt: past, Default: approvalApproved}, true, true, ""},
+		{"timed out rejected", WaitState{TimeoutAt: past, Default: approvalRejected}, true, false, "rejected by default after timeout"},
+		{"timed out rejected, continue", WaitState{TimeoutAt: past, Default: approvalRejected, OnReject: "continue"}, true, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := testEngine(t)
+			requestApproval(t, e, "run-1", "gate")
+			tt.wait.Node = "gate"
+			tt.wait.Type = approvalNodeType
+
+			output, done, err := e.approvalOutcome("run-1", tt.wait)
+			if done != tt.done {
+				t.Fatalf("done = %v, want %v", done, tt.done)
+			}
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if done {
+				if output["approved"] != tt.approved || output["timed_out"] != true {
+					t.Errorf("output = %v, want approved %v and timed_out", output, tt.approved)
+				}
+			}
+		})
+	}
+}
+
+func TestApprovalOutcomeDecision(t *testing.T) {
+	e := testEngine(t)
+	requestApproval(t, e, "run-1", "gate")
+	wait := WaitState{Node: "gate", Type: approvalNodeType, Default: approvalRejected}
+
+	err := e.DecideApproval("run-1", "gate", ApprovalDecision{Decision: approvalApproved, Approver: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.DecideApproval("run-1", "gate", ApprovalDecision{Decision: approvalRejected}); err != ErrApprovalDecided {
+		t.Errorf("second decision: err = %v, want ErrApprovalDecided", err)
+	}
+
+	output, done, err := e.approvalOutcome("run-1", wait)
+	if !done || err != nil {
+		t.Fatalf("done = %v, err = %v", done, err)
+	}
+	if output["approved"] != true || output["approver"] != "alice" || output["timed_out"] != false {
+		t.Errorf("output = %v", output)
+	}
+}
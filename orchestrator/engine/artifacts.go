@@ -0,0 +1,192 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ArtifactRecord is the history entry of one collected artifact
+type ArtifactRecord struct {
+	Node   string `yaml:"node"`
+	Name   string `yaml:"name"`   // Path relative to the workspace, or the file name for files outside it
+	Source string `yaml:"source"` // Where the file was collected from
+	Path   string `yaml:"path"`   // Location in the artifact store, relative to the run directory
+	Size   int64  `yaml:"size"`
+	SHA256 string `yaml:"sha256"`
+}
+
+// createWorkspace creates the scratch directory of a run. It lives in the run's
+// history directory, or in the system temp directory if that is unavailable.
+func (e *Engine) createWorkspace(runID string) (string, error) {
+	dir := filepath.Join(e.runDir(runID), "workspace")
+	err := os.MkdirAll(dir, 0755)
+	if err == nil {
+		return filepath.Abs(dir)
+	}
+	e.Logger.Printf("Failed to create workspace in run history, using a temporary directory: %v %s", err, statusWARN)
+
+	dir, err = os.MkdirTemp("", "octa-run-"+runID+"-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create run workspace: %w", err)
+	}
+	return dir, nil
+}
+
+// collectArtifacts copies the files matching the artifacts globs of every
+// executed node into the run's artifact store and records them. Only files in
+// the workspace or the workflow's write roots are collected, since globs may
+// be templated from untrusted data. Collection is best effort: problems are
+// logged and never fail the run.
+func (e *Engine) collectArtifacts(nodes []NodeV1, templateCtx *TemplateContext, record *RunRecord, permissions *PermissionsV1) {
+	executed := make(map[string]bool)
+	for _, entry := range record.Nodes {
+		executed[entry.ID] = entry.Status != NodeSkipped
+	}
+	roots := artifactRoots(templateCtx.Run.Workspace, permissions)
+
+	for _, node := range nodes {
+		if len(node.Artifacts) == 0 || !executed[node.ID] {
+			continue
+		}
+
+		names := make(map[string]bool)
+		for _, pattern := range node.Artifacts {
+			files, err := matchArtifacts(pattern, templateCtx)
+			if err != nil {
+				e.Logger.Printf("Node %s artifacts %q: %v %s", node.ID, pattern, err, statusWARN)
+				continue
+			}
+			if len(files) == 0 {
+				e.Logger.Printf("Node %s artifacts %q matched no files %s", node.ID, pattern, statusWARN)
+			}
+
+			for _, file := range files {
+				source, err := artifactSource(file, roots)
+				if err != nil {
+					e.Logger.Printf("Node %s artifact %s not collected: %v %s", node.ID, file, err, statusWARN)
+					continue
+				}
+
+				name := artifactName(file, templateCtx.Run.Workspace)
+				if names[name] {
+					e.Logger.Printf("Node %s artifact %s collected twice, keeping the first %s", node.ID, name, statusWARN)
+					continue
+				}
+				names[name] = true
+
+				artifact, err := e.storeArtifact(record.ID, node.ID, name, source)
+				if err != nil {
+					e.Logger.Printf("Failed to collect artifact %s of node %s: %v %s", file, node.ID, err, statusWARN)
+					continue
+				}
+				record.Artifacts = append(record.Artifacts, artifact)
+				e.Logger.Printf("Collected artifact %s of node %s (%d bytes) %s", name, node.ID, artifact.Size, statusINFO)
+			}
+		}
+	}
+}
+
+// matchArtifacts resolves templates in a glob and returns the regular files it
+// matches. Relative globs are matched inside the workspace.
+func matchArtifacts(pattern string, templateCtx *TemplateContext) ([]string, error) {
+	resolved, err := resolveTemplateString(pattern, templateCtx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve template: %w", err)
+	}
+	if !filepath.IsAbs(resolved) {
+		resolved = filepath.Join(templateCtx.Run.Workspace, resolved)
+	}
+
+	matches, err := filepath.Glob(resolved)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil && info.Mode().IsRegular() {
+			files = append(files, match)
+		}
+	}
+	return files, nil
+}
+
+// artifactRoots returns the directories artifacts may be collected from, with
+// symlinks resolved: the workspace and, when the workflow declares
+// permissions, its write roots
+func artifactRoots(workspace string, permissions *PermissionsV1) []string {
+	dirs := []string{workspace}
+	if permissions != nil {
+		dirs = append(dirs, permissions.WriteRoots...)
+	}
+
+	var roots []string
+	for _, dir := range dirs {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			roots = append(roots, resolved)
+		}
+	}
+	return roots
+}
+
+// artifactSource resolves the symlinks of a matched file and checks that it
+// lies beneath one of roots
+func artifactSource(file string, roots []string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(file)
+	if err != nil {
+		return "", err
+	}
+	for _, root := range roots {
+		if rel, err := filepath.Rel(root, resolved); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return resolved, nil
+		}
+	}
+	return "", fmt.Errorf("%s is outside the run workspace and the workflow's write_roots", resolved)
+}
+
+// artifactName names a file relative to the workspace when it lies inside it,
+// and by its base name otherwise
+func artifactName(file, workspace string) string {
+	if rel, err := filepath.Rel(workspace, file); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.Base(file)
+}
+
+// storeArtifact copies a file into the artifact store, hashing it on the way
+func (e *Engine) storeArtifact(runID, nodeID, name, source string) (ArtifactRecord, error) {
+	artifact := ArtifactRecord{
+		Node:   nodeID,
+		Name:   name,
+		Source: source,
+		Path:   filepath.ToSlash(filepath.Join("artifacts", nodeID, name)),
+	}
+
+	in, err := os.Open(source)
+	if err != nil {
+		return artifact, err
+	}
+	defer in.Close()
+
+	dest := filepath.Join(e.runDir(runID), filepath.FromSlash(artifact.Path))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return artifact, err
+	}
+	out, err := os.Create(dest)
+	if err != nil {
+		return artifact, err
+	}
+	defer out.Close()
+
+	hash := sha256.New()
+	if artifact.Size, err = io.Copy(io.MultiWriter(out, hash), in); err != nil {
+		return artifact, err
+	}
+	artifact.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return artifact, out.Close()
+}
@@ -0,0 +1,202 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/yaml.v3"
+)
+
+// Builtin is an action implemented in Go. It runs inside the engine's process
+// instead of spawning a binary, and returns the value to encode as the
+// action's YAML output.
+type Builtin func(ctx context.Context, req ActionRequest) (interface{}, error)
+
+var (
+	builtinsMu sync.RWMutex
+	builtins   = make(map[string]Builtin)
+)
+
+// RegisterBuiltin makes an action type run in-process. It is meant to be
+// called from init functions and panics if the type is registered twice.
+func RegisterBuiltin(actionType string, action Builtin) {
+	builtinsMu.Lock()
+	defer builtinsMu.Unlock()
+
+	if _, exists := builtins[actionType]; exists {
+		panic("engine: builtin action " + actionType + " registered twice")
+	}
+	builtins[actionType] = action
+}
+
+// lookupBuiltin returns the builtin registered for an action type, or nil
+func lookupBuiltin(actionType string) Builtin {
+	builtinsMu.RLock()
+	defer builtinsMu.RUnlock()
+	return builtins[actionType]
+}
+
+// Builtins lists the registered builtin action types, sorted
+func Builtins() []string {
+	builtinsMu.RLock()
+	defer builtinsMu.RUnlock()
+
+	types := make([]string, 0, len(builtins))
+	for actionType := range builtins {
+		types = append(types, actionType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// TypedBuiltin adapts a function taking an action's input struct. The input
+// is decoded from the request's YAML the way the action's binary decodes its
+// stdin, and the returned output is encoded like the binary's stdout.
+func TypedBuiltin[In, Out any](fn func(ctx context.Context, req ActionRequest, input In) (Out, error)) Builtin {
+	return func(ctx context.Context, req ActionRequest) (interface{}, error) {
+		var input In
+		if err := yaml.Unmarshal(req.Input, &input); err != nil {
+			return nil, fmt.Errorf("invalid input YAML: %w", err)
+		}
+		return fn(ctx, req, input)
+	}
+}
+
+// LookupEnv reads a variable of the action's environment
+func (r ActionRequest) LookupEnv(name string) (string, bool) {
+	if r.Env == nil {
+		return os.LookupEnv(name)
+	}
+	for i := len(r.Env) - 1; i >= 0; i-- {
+		if value, ok := strings.CutPrefix(r.Env[i], name+"="); ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// BuiltinRunner runs builtin actions in-process and hands every other action
+// to Next. Sandboxed nodes always go to Next, since only a separate process
+// can be confined.
+type BuiltinRunner struct {
+	Logger Logger
+	Next   ActionRunner
+}
+
+// RunAction runs the registered builtin for the request's action type, if any
+func (r *BuiltinRunner) RunAction(ctx context.Context, req ActionRequest) (map[string]interface{}, error) {
+	builtin := lookupBuiltin(req.Type)
+	if builtin == nil || req.SandboxPolicy != nil {
+		return r.Next.RunAction(ctx, req)
+	}
+
+	logger := req.logger(r.Logger)
+
+	// Builtins see the trace context in their environment like processes do
+	runCtx, span := tracer.Start(ctx, "builtin.run", trace.WithAttributes(attrActionType.String(req.Type)))
+	req.Env = withTraceEnv(runCtx, req.Env)
+	result, err := callBuiltin(runCtx, builtin, req)
+	endSpan(span, err)
+
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("action cancelled: %w", context.Cause(ctx))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("action failed: %w", err)
+	}
+
+	// The output takes the same YAML round trip and limits as a process's
+	data, err := yaml.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal action output YAML: %w", err)
+	}
+	data, exceeded, err := limitOutput(req, data)
+	if err != nil {
+		return nil, err
+	}
+	return parseActionOutput(ctx, logger, req, data, exceeded)
+}
+
+// callBuiltin runs a builtin, turning a panic into an error so that a buggy
+// builtin fails its node instead of the engine's process
+func callBuiltin(ctx context.Context, builtin Builtin, req ActionRequest) (result interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			result, err = nil, fmt.Errorf("action panicked: %v", p)
+		}
+	}()
+	return builtin(ctx, req)
+}
+
+// Close closes Next if it can be closed
+func (r *BuiltinRunner) Close() error {
+	if closer, ok := r.Next.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// ServeBuiltin runs a builtin as a standalone action: it reads the YAML input
+// from stdin and writes the YAML output to stdout, or an error document if
+// the action fails, in which case the error is returned as well. Binaries
+// dispatching to builtins by name use it, so that they can stand in for the
+// action binaries.
+func ServeBuiltin(ctx context.Context, actionType string, stdin io.Reader, stdout io.Writer) error {
+	builtin := lookupBuiltin(actionType)
+	if builtin == nil {
+		return fmt.Errorf("no builtin action %s", actionType)
+	}
+
+	input, err := io.ReadAll(stdin)
+	if err != nil {
+		return fmt.Errorf("failed to read input from stdin: %w", err)
+	}
+	manifest := &ActionManifest{Name: actionType}
+	if data := RegisteredManifest(actionType); data != nil {
+		if err := decodeManifest(data, manifest); err != nil {
+			return fmt.Errorf("invalid manifest for action %s: %w", actionType, err)
+		}
+	}
+
+	// Input and output are checked against the manifest as in runs
+	var result interface{}
+	input, err = coerceActionInputYAML(actionType, manifest.Input, input)
+	if err == nil {
+		result, err = builtin(ctx, ActionRequest{Type: actionType, Input: input})
+	}
+	if err == nil && manifest.Output != nil {
+		result, err = coerceBuiltinOutput(actionType, manifest.Output, result)
+	}
+	if err != nil {
+		data, _ := yaml.Marshal(ActionError{Error: err.Error()})
+		stdout.Write(data)
+		return err
+	}
+
+	data, err := yaml.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to marshal output YAML: %w", err)
+	}
+	_, err = stdout.Write(data)
+	return err
+}
+
+// coerceBuiltinOutput checks the result of a builtin against an output
+// schema, taking the YAML round trip a process's output takes
+func coerceBuiltinOutput(actionType string, schema *Schema, result interface{}) (map[string]interface{}, error) {
+	data, err := yaml.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal output YAML: %w", err)
+	}
+	var output map[string]interface{}
+	if err := yaml.Unmarshal(data, &output); err != nil {
+		return nil, fmt.Errorf("invalid output YAML: %w", err)
+	}
+	return coerceActionOutput(actionType, schema, output)
+}
@@ -0,0 +1,146 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"time"
+)
+
+// defaultCacheTTL is used when a node enables caching without a ttl
+const defaultCacheTTL = 24 * time.Hour
+
+// CacheV1 enables reuse of a node's output across runs
+type CacheV1 struct {
+	TTL string `yaml:"ttl,omitempty"` // How long a result stays valid, e.g. 30m or 12h (default: 24h)
+	Key string `yaml:"key,omitempty"` // Templated key used instead of the rendered input (optional)
+}
+
+// CacheEntry is a stored node output
+type CacheEntry struct {
+	Key       string                 `yaml:"key"`
+	Action    string                 `yaml:"action"`
+	Version   string                 `yaml:"version"`
+	Node      string                 `yaml:"node"`
+	RunID     string                 `yaml:"run_id"`
+	CreatedAt string                 `yaml:"created_at"`
+	ExpiresAt string                 `yaml:"expires_at"`
+	Output    map[string]interface{} `yaml:"output"`
+}
+
+// nodeCache is the resolved cache configuration of one node execution
+type nodeCache struct {
+	key     string
+	version string
+	ttl     time.Duration
+	state   StateStore
+}
+
+// resolveNodeCache computes the cache key of a node from its action type, the
+// action's version and either the rendered input or the node's cache key
+func (e *Engine) resolveNodeCache(node NodeV1, inputYAML []byte, templateCtx *TemplateContext) (*nodeCache, error) {
+	cache := &nodeCache{ttl: defaultCacheTTL, state: e.Store}
+	if node.Cache.TTL != "" {
+		ttl, err := time.ParseDuration(node.Cache.TTL)
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("invalid cache ttl %q: must be a positive duration such as 30m or 12h", node.Cache.TTL)
+		}
+		cache.ttl = ttl
+	}
+
+	version, err := e.actionVersion(node.Type)
+	if err != nil {
+		return nil, err
+	}
+	cache.version = version
+
+	material := inputYAML
+	if node.Cache.Key != "" {
+		key, err := resolveTemplateString(node.Cache.Key, templateCtx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve cache key: %w", err)
+		}
+		material = []byte(key)
+	}
+
+	hash := sha256.New()
+	for _, part := range [][]byte{[]byte(node.Type), []byte(version), material} {
+		// Length-prefix each part so that they cannot run into each other
+		fmt.Fprintf(hash, "%d:", len(part))
+		hash.Write(part)
+	}
+	cache.key = hex.EncodeToString(hash.Sum(nil))
+	return cache, nil
+}
+
+// actionVersion identifies the installed version of an action: the version
+// from its manifest, or else the size and modification time of its binary, or
+// of the running executable for builtins without one, so that rebuilding an
+// action invalidates its cached results
+func (e *Engine) actionVersion(actionType string) (string, error) {
+	manifest, err := e.LoadActionManifest(actionType)
+	if err != nil {
+		return "", err
+	}
+	if manifest.Version != "" {
+		return manifest.Version, nil
+	}
+
+	info, err := os.Stat(e.actionPath(actionType))
+	if err != nil && lookupBuiltin(actionType) != nil {
+		// A builtin without its binary changes with the running executable
+		var execPath string
+		if execPath, err = os.Executable(); err == nil {
+			info, err = os.Stat(execPath)
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("action %s is not installed: %w", actionType, err)
+	}
+	return fmt.Sprintf("build-%d-%d", info.Size(), info.ModTime().UnixNano()), nil
+}
+
+// cacheKey returns the state key of a cache entry, sharded by key prefix
+func cacheKey(key string) string {
+	return path.Join("cache", key[:2], key+".yaml")
+}
+
+// lookup returns the cached output, or nil on a miss. Expired entries are
+// removed.
+func (c *nodeCache) lookup() (*CacheEntry, error) {
+	var entry CacheEntry
+	if err := c.state.Read(cacheKey(c.key), &entry); err != nil {
+		return nil, err
+	}
+	if entry.Key != c.key {
+		return nil, nil
+	}
+
+	expires, err := time.Parse(time.RFC3339, entry.ExpiresAt)
+	if err != nil || time.Now().After(expires) {
+		c.state.Delete(cacheKey(c.key))
+		return nil, nil
+	}
+	return &entry, nil
+}
+
+// store saves a node's output under the cache key
+func (c *nodeCache) store(node NodeV1, runID string, output map[string]interface{}) error {
+	now := time.Now().UTC()
+	entry := CacheEntry{
+		Key:       c.key,
+		Action:    node.Type,
+		Version:   c.version,
+		Node:      node.ID,
+		RunID:     runID,
+		CreatedAt: now.Format(time.RFC3339),
+		ExpiresAt: now.Add(c.ttl).Format(time.RFC3339),
+		Output:    output,
+	}
+	if err := c.state.Write(cacheKey(c.key), entry); err != nil {
+		return fmt.Errorf("failed to store cache entry: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// A node's compensate is an action invocation that undoes the node's side
+// effects, such as deleting a file it wrote. When a run fails or is
+// cancelled, the compensations of its completed nodes run in reverse order of
+// completion, before the finally nodes. Their inputs are templated with the
+// compensated node's output as {{.Output}}. A for_each node is compensated
+// item by item, last item first, with the item's output as {{.Output}} and
+// the item and its index as {{.Item}} and {{.Index}}.
+//
+// Compensations are best effort: a failing compensation is recorded and the
+// remaining ones still run. Nodes served from the cache did not run, so they
+// are not compensated.
+
+// checkCompensations rejects compensations that are not plain action
+// invocations, and compensations on finally nodes
+func checkCompensations(workflow *WorkflowV1) error {
+	for _, node := range workflow.Finally {
+		if node.Compensate != nil {
+			return fmt.Errorf("finally node %s: finally nodes cannot have compensate", node.ID)
+		}
+	}
+	for _, node := range workflow.Nodes {
+		compensate := node.Compensate
+		if compensate == nil {
+			continue
+		}
+		switch {
+		case compensate.Type == "":
+			return fmt.Errorf("node %s: compensate requires type", node.ID)
+		case compensate.Type == approvalNodeType, compensate.Type == switchNodeType, compensate.Type == scriptNodeType, isWaitNode(*compensate):
+			return fmt.Errorf("node %s: compensate cannot use the built-in %s node type", node.ID, compensate.Type)
+		case compensate.Cache != nil, compensate.Compensate != nil, len(compensate.Needs) > 0, compensate.When != "", compensate.ForEach != "":
+			return fmt.Errorf("node %s: compensate does not support cache, compensate, needs, when or for_each", node.ID)
+		}
+	}
+	return nil
+}
+
+// compensate runs the compensations of the run's completed nodes, latest
+// first, recording each in the run record
+func (e *Engine) compensate(ctx context.Context, workflow *WorkflowV1, templateCtx *TemplateContext, record *RunRecord, permissions *PermissionsV1) {
+	nodes := make(map[string]NodeV1)
+	for _, node := range workflow.Nodes {
+		if node.Compensate != nil {
+			nodes[node.ID] = node
+		}
+	}
+
+	var completed []NodeV1
+	for i := len(record.Nodes) - 1; i >= 0; i-- {
+		entry := record.Nodes[i]
+		if node, ok := nodes[entry.ID]; ok && entry.Status == NodeSucceeded && !entry.Cached {
+			completed = append(completed, node)
+		}
+	}
+	if len(completed) == 0 {
+		return
+	}
+
+	e.Logger.Printf("Compensating %d completed node(s) %s", len(completed), statusINFO)
+	for _, node := range completed {
+		// The compensation sees the run as it is, plus the node's own output
+		compensationCtx := *templateCtx
+		output := templateCtx.Nodes[node.ID].Output
+		if node.ForEach == "" {
+			compensationCtx.Output = output
+			e.compensateNode(ctx, node.ID, *node.Compensate, &compensationCtx, record, permissions)
+			continue
+		}
+
+		// The items are evaluated again for {{.Item}}; their outputs are the
+		// node's results
+		results, _ := output["results"].([]interface{})
+		items, err := evalList(node.ForEach, templateCtx)
+		if err != nil || len(items) != len(results) {
+			items = nil
+		}
+		for i := len(results) - 1; i >= 0; i-- {
+			itemOutput, _ := results[i].(map[string]interface{})
+			itemCtx := compensationCtx
+			itemCtx.Output, itemCtx.Index = itemOutput, i
+			if items != nil {
+				itemCtx.Item = items[i]
+			}
+			e.compensateNode(ctx, fmt.Sprintf("%s[%d]", node.ID, i), *node.Compensate, &itemCtx, record, permissions)
+		}
+	}
+}
+
+// compensateNode runs one compensation, recorded under id
+func (e *Engine) compensateNode(ctx context.Context, id string, step NodeV1, compensationCtx *TemplateContext, record *RunRecord, permissions *PermissionsV1) {
+	step.ID = id
+	started := time.Now()
+
+	stepCtx, span := tracer.Start(ctx, "compensate "+id, trace.WithAttributes(
+		attrNodeID.String(id),
+		attrActionType.String(step.Type),
+	))
+	_, _, err := e.executeNode(stepCtx, step, compensationCtx, permissions)
+	endSpan(span, err)
+
+	status := NodeSucceeded
+	if err != nil {
+		status = NodeFailed
+		e.Logger.Printf("Compensation of node %s failed: %v %s", id, err, statusFAILED)
+	} else {
+		e.Logger.Printf("Compensation of node %s completed %s", id, statusOK)
+	}
+	record.recordCompensation(step, status, started, err)
+}
@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// recordingRunner records the inputs of the actions it runs and fails the
+// action type fail
+type recordingRunner struct {
+	mu     sync.Mutex
+	inputs map[string][]map[string]interface{}
+}
+
+func (r *recordingRunner) RunAction(ctx context.Context, req ActionRequest) (map[string]interface{}, error) {
+	var input map[string]interface{}
+	if err := yaml.Unmarshal(req.Input, &input); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.inputs == nil {
+		r.inputs = make(map[string][]map[string]interface{})
+	}
+	r.inputs[req.Type] = append(r.inputs[req.Type], input)
+	if req.Type == "fail" {
+		return nil, errors.New("failed")
+	}
+	return input, nil
+}
+
+func TestCompensateForEach(t *testing.T) {
+	workflow := `version: "1"
+name: compensate-for-each
+nodes:
+  - id: write
+    type: write
+    for_each: "${{ workflow_data.files }}"
+    inputs_from_workflow:
+      path: "{{.Item}}.txt"
+    compensate:
+      type: delete
+      inputs_from_workflow:
+        path: "{{.Output.path}}"
+        item: "{{.Item}}"
+        index: "{{.Index}}"
+  - id: publish
+    type: fail
+    needs: [write]
+`
+	e := testEngine(t)
+	path := filepath.Join(t.TempDir(), "workflow.yaml")
+	if err := os.WriteFile(path, []byte(workflow), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	runner := &recordingRunner{}
+	e.Runner = runner
+
+	result, err := e.Run(context.Background(), map[string]interface{}{"files": []interface{}{"a", "b", "c"}})
+	if err == nil {
+		t.Fatal("run succeeded, want the publish node to fail it")
+	}
+
+	// Items are compensated one by one, the last one first
+	want := []map[string]interface{}{
+		{"path": "c.txt", "item": "c", "index": "2"},
+		{"path": "b.txt", "item": "b", "index": "1"},
+		{"path": "a.txt", "item": "a", "index": "0"},
+	}
+	if got := runner.inputs["delete"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("compensations = %v, want %v", got, want)
+	}
+
+	var ids []string
+	for _, entry := range result.Record.Compensations {
+		ids = append(ids, entry.ID)
+	}
+	if wantIDs := []string{"write[2]", "write[1]", "write[0]"}; !reflect.DeepEqual(ids, wantIDs) {
+		t.Errorf("recorded compensations = %v, want %v", ids, wantIDs)
+	}
+}
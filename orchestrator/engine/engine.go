@@ -0,0 +1,285 @@
+// Package engine runs Octa workflows. The orchestrator and cli binaries are
+// thin wrappers around it, and Go programs can embed it to run workflows
+// in-process:
+//
+//	e := engine.New()
+//	if err := e.Load("workflow.yaml"); err != nil {
+//		return err
+//	}
+//	if err := e.Validate(); err != nil {
+//		return err
+//	}
+//	result, err := e.Run(ctx, map[string]interface{}{"name": "octa"})
+//
+// Action nodes are executed by the engine's ActionRunner, which by default
+// runs registered builtin actions in-process, runs WebAssembly actions in an
+// embedded runtime and spawns the action binaries found in ActionDir for the
+// others; actions whose manifest declares a worker keep running between
+// requests until Close. Run history, approvals, suspended runs and cached
+// outputs are kept in its StateStore, log messages go to its Logger, and
+// Hooks observe every node of every run.
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ANSI color codes
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorBlue   = "\033[34m"
+)
+
+// Status indicators
+const (
+	statusOK     = "[" + colorGreen + "OK" + colorReset + "]"
+	statusFAILED = "[" + colorRed + "FAILED" + colorReset + "]"
+	statusINFO   = "[" + colorBlue + "INFO" + colorReset + "]"
+	statusWARN   = "[" + colorYellow + "WARN" + colorReset + "]"
+)
+
+// Engine loads, validates and runs a workflow. Create it with New and replace
+// any of its fields before its first run; an Engine may then run any number
+// of runs concurrently.
+type Engine struct {
+	Workflow    *WorkflowV1   // Set by Load
+	Runner      ActionRunner  // Executes action nodes
+	Logger      Logger        // Receives progress and diagnostic messages
+	Store       StateStore    // Persists run state
+	Hooks       Hooks         // Optional callbacks around nodes and runs
+	ActionDir   string        // Directory holding the action binaries and their manifests
+	WorkDir     string        // Directory holding runs/<run-id>/ workspaces and artifacts
+	GracePeriod time.Duration // How long cancelled actions and cleanup may take
+	Interactive bool          // Prompt for approvals on the terminal instead of suspending the run
+
+	source map[string]interface{} // The loaded document, for Validate
+}
+
+// Logger receives the engine's log messages. *log.Logger implements it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// Hooks are called as a run progresses. Every hook is optional; hooks of
+// concurrent runs are called concurrently.
+type Hooks struct {
+	// BeforeNode is called before a node runs. Returning an error fails the
+	// node without running it.
+	BeforeNode func(ctx context.Context, event NodeEvent) error
+
+	// AfterNode is called once a node has completed, failed, been skipped or
+	// suspended the run
+	AfterNode func(ctx context.Context, event NodeEvent)
+
+	// OnError is called when a run fails or is cancelled, after its
+	// compensations and finally nodes have run
+	OnError func(ctx context.Context, runID string, err error)
+}
+
+// NodeEvent describes a node to the hooks
+type NodeEvent struct {
+	RunID    string
+	Node     NodeV1
+	Status   string                 // After the node: one of the Node* statuses
+	Output   map[string]interface{} // After a succeeded node
+	Cached   bool                   // The output was served from the cache
+	Duration time.Duration
+	Err      error
+}
+
+// Result is the outcome of a run
+type Result struct {
+	RunID  string
+	Status string                 // One of the Run* statuses
+	Nodes  map[string]NodeOutput  // Outputs of the nodes that ran, by node ID
+	Vars   map[string]interface{} // Resolved workflow vars
+	Record *RunRecord             // The run's history entry
+}
+
+// ErrSuspended is matched by the error of a run that was suspended at a wait
+// node; the run continues with Resume once its wait is over
+var ErrSuspended = errors.New("run suspended")
+
+// SignalError is the cancellation cause telling the engine which signal
+// stopped a run, so that it is forwarded to running actions. Runs cancelled
+// for another cause send SIGTERM to their actions.
+type SignalError struct {
+	Signal os.Signal
+}
+
+func (e SignalError) Error() string {
+	return "received signal " + e.Signal.String()
+}
+
+// New returns an engine that runs action binaries from the directory of the
+// running executable and keeps its state in DefaultStateDir
+func New() *Engine {
+	dir := DefaultStateDir()
+	e := &Engine{
+		Logger:      log.Default(),
+		Store:       &FileStore{Dir: dir},
+		WorkDir:     dir,
+		GracePeriod: 10 * time.Second,
+	}
+
+	if execPath, err := os.Executable(); err == nil {
+		e.ActionDir = filepath.Dir(execPath)
+	}
+
+	// The grace period can be set with OCTA_GRACE_PERIOD (e.g. "30s")
+	if value := os.Getenv("OCTA_GRACE_PERIOD"); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			e.GracePeriod = d
+		} else {
+			e.Logger.Printf("Ignoring invalid OCTA_GRACE_PERIOD %q %s", value, statusWARN)
+		}
+	}
+
+	// The runners take the logger and grace period from each request, so
+	// that they follow changes to the engine's fields
+	e.Runner = &BuiltinRunner{
+		Next: &WasmRunner{
+			Next:     &ProcessRunner{},
+			CacheDir: filepath.Join(dir, "wasm-cache"),
+		},
+	}
+	return e
+}
+
+// Load reads a workflow file, expanding its imports and node templates
+func (e *Engine) Load(filename string) error {
+	doc, err := loadWorkflowDocument(filename)
+	if err != nil {
+		return err
+	}
+
+	var source map[string]interface{}
+	if err := doc.Decode(&source); err != nil {
+		return fmt.Errorf("failed to parse YAML: %w", err)
+	}
+	var workflow WorkflowV1
+	if err := doc.Decode(&workflow); err != nil {
+		return fmt.Errorf("failed to parse YAML: %w", err)
+	}
+
+	e.Workflow = &workflow
+	e.source = source
+	return nil
+}
+
+// Render writes a workflow file with its imports and templates expanded
+func Render(filename string, w io.Writer) error {
+	doc, err := loadWorkflowDocument(filename)
+	if err != nil {
+		return err
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// Run executes the workflow's nodes with data as its workflow data, followed
+// by its finally nodes, and records the run in run history. A run reaching a
+// wait node that cannot complete now is suspended with status RunWaiting and
+// an error matching ErrSuspended.
+func (e *Engine) Run(ctx context.Context, data map[string]interface{}) (Result, error) {
+	if e.Workflow == nil {
+		return Result{}, errors.New("no workflow loaded")
+	}
+	return e.start(ctx, data, nil)
+}
+
+// start runs the workflow, recording the matrix combination it belongs to
+func (e *Engine) start(ctx context.Context, data map[string]interface{}, matrix map[string]interface{}) (Result, error) {
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+
+	record, err := e.newRunRecord(e.Workflow, matrix)
+	if err != nil {
+		e.Logger.Printf("Run history unavailable: %v %s", err, statusWARN)
+	}
+	e.Logger.Printf("Run ID: %s %s", record.ID, statusINFO)
+
+	// Initialize template context
+	templateCtx := &TemplateContext{
+		WorkflowData: data,
+		Nodes:        make(map[string]NodeOutput),
+		Vars:         make(map[string]interface{}),
+		Run:          RunInfo{ID: record.ID, Status: RunRunning},
+	}
+
+	err = e.run(ctx, e.Workflow, record, templateCtx, 0)
+	return newResult(record, templateCtx), err
+}
+
+// newResult summarizes a finished, failed or suspended run
+func newResult(record *RunRecord, templateCtx *TemplateContext) Result {
+	result := Result{RunID: record.ID, Status: record.Status, Record: record}
+	if templateCtx != nil {
+		result.Nodes = templateCtx.Nodes
+		result.Vars = templateCtx.Vars
+	}
+	return result
+}
+
+// RunAction runs an action outside of any workflow with the default process
+// settings, e.g. for triggers that poll through an action. Its input and
+// output are checked against its manifest as in runs.
+func (e *Engine) RunAction(ctx context.Context, actionType string, input []byte) (map[string]interface{}, error) {
+	manifest, err := e.LoadActionManifest(actionType)
+	if err != nil {
+		return nil, err
+	}
+	if input, err = coerceActionInputYAML(actionType, manifest.Input, input); err != nil {
+		return nil, err
+	}
+	output, err := e.Runner.RunAction(ctx, ActionRequest{
+		Type:           actionType,
+		Path:           e.actionPath(actionType),
+		Input:          input,
+		MaxOutputBytes: defaultMaxOutputBytes,
+		Worker:         manifest.Worker,
+		Logger:         e.Logger,
+		GracePeriod:    e.GracePeriod,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return coerceActionOutput(actionType, manifest.Output, output)
+}
+
+// Close releases what the engine's runner holds on to between runs, such as
+// action workers, if it implements io.Closer
+func (e *Engine) Close() error {
+	if closer, ok := e.Runner.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// forwardedSignal returns the signal to forward to actions when ctx is done
+func forwardedSignal(ctx context.Context) os.Signal {
+	var cause SignalError
+	if errors.As(context.Cause(ctx), &cause) {
+		return cause.Signal
+	}
+	return syscall.SIGTERM
+}
@@ -0,0 +1,384 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/parser"
+	"github.com/expr-lang/expr/vm"
+	"gopkg.in/yaml.v3"
+)
+
+// Expressions are typed alternatives to Go templates, written ${{ ... }} in
+// any templated field and as the condition of when and the list of for_each.
+// They are evaluated with expr (https://expr-lang.org) against the run's data
+// under the keys of run records: workflow_data, nodes, vars and run, output
+// in compensations, and item and index in for_each nodes. A field holding
+// nothing but an expression takes its result with its type, such as a
+// number, list or map; an expression within a longer string is replaced by
+// its text.
+
+// Delimiters of an expression in a string
+const (
+	exprOpen  = "${{"
+	exprClose = "}}"
+)
+
+// exprEnv holds the variables of an expression. Its fields have the types
+// the values have at run time, so that expressions are checked against them.
+type exprEnv struct {
+	WorkflowData map[string]interface{} `expr:"workflow_data"`
+	Nodes        map[string]interface{} `expr:"nodes"`
+	Vars         map[string]interface{} `expr:"vars"`
+	Run          map[string]interface{} `expr:"run"`
+	Output       map[string]interface{} `expr:"output"`
+	Item         interface{}            `expr:"item"`
+	Index        int                    `expr:"index"`
+}
+
+// newExprEnv takes the variables of an expression from the run's data
+func newExprEnv(values map[string]interface{}) exprEnv {
+	env := exprEnv{Item: values["item"]}
+	env.WorkflowData, _ = values["workflow_data"].(map[string]interface{})
+	env.Nodes, _ = values["nodes"].(map[string]interface{})
+	env.Vars, _ = values["vars"].(map[string]interface{})
+	env.Run, _ = values["run"].(map[string]interface{})
+	env.Output, _ = values["output"].(map[string]interface{})
+	env.Index, _ = values["index"].(int)
+	return env
+}
+
+// exprPlaceholderPattern matches the placeholders standing in for the
+// expressions of a value while its Go templates are executed
+var exprPlaceholderPattern = regexp.MustCompile("\x00expr([0-9]+)\x00")
+
+// exprPrograms caches compiled expressions by kind and source
+var exprPrograms sync.Map
+
+// exprSpan locates an expression in a string
+type exprSpan struct {
+	start, end int    // Of the expression with its delimiters
+	source     string // Between the delimiters, trimmed
+}
+
+// findExpressions returns the ${{ }} expressions in s. Braces and quotes
+// within an expression are matched, so it may contain map literals and
+// strings with }} in them.
+func findExpressions(s string) ([]exprSpan, error) {
+	var spans []exprSpan
+	for offset := 0; ; {
+		start := strings.Index(s[offset:], exprOpen)
+		if start < 0 {
+			return spans, nil
+		}
+		start += offset
+
+		end, depth, quote := -1, 0, byte(0)
+		for i := start + len(exprOpen); i < len(s) && end < 0; i++ {
+			switch c := s[i]; {
+			case quote != 0:
+				if c == '\\' {
+					i++
+				} else if c == quote {
+					quote = 0
+				}
+			case c == '"' || c == '\'' || c == '`':
+				quote = c
+			case c == '{':
+				depth++
+			case c == '}' && depth > 0:
+				depth--
+			case c == '}' && strings.HasPrefix(s[i:], exprClose):
+				end = i + len(exprClose)
+			}
+		}
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated expression at %q", s[start:])
+		}
+
+		source := strings.TrimSpace(s[start+len(exprOpen) : end-len(exprClose)])
+		if source == "" {
+			return nil, errors.New("empty expression ${{ }}")
+		}
+		spans = append(spans, exprSpan{start: start, end: end, source: source})
+		offset = end
+	}
+}
+
+// bareExpression returns the expression of a when or for_each field, which
+// may be written with or without ${{ }}
+func bareExpression(s string) string {
+	spans, err := findExpressions(s)
+	if err == nil && len(spans) == 1 && strings.TrimSpace(s[:spans[0].start]+s[spans[0].end:]) == "" {
+		return spans[0].source
+	}
+	return strings.TrimSpace(s)
+}
+
+// extractExpressions replaces the expressions in the strings of a value with
+// placeholders, returning the copy and the expressions in placeholder order
+func extractExpressions(value interface{}, sources []string) (interface{}, []string, error) {
+	switch v := value.(type) {
+	case string:
+		spans, err := findExpressions(v)
+		if err != nil || len(spans) == 0 {
+			return v, sources, err
+		}
+		var b strings.Builder
+		last := 0
+		for _, span := range spans {
+			b.WriteString(v[last:span.start])
+			fmt.Fprintf(&b, "\x00expr%d\x00", len(sources))
+			sources = append(sources, span.source)
+			last = span.end
+		}
+		b.WriteString(v[last:])
+		return b.String(), sources, nil
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			var err error
+			if result[key], sources, err = extractExpressions(elem, sources); err != nil {
+				return nil, nil, err
+			}
+		}
+		return result, sources, nil
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, elem := range v {
+			var err error
+			if result[i], sources, err = extractExpressions(elem, sources); err != nil {
+				return nil, nil, err
+			}
+		}
+		return result, sources, nil
+	default:
+		return value, sources, nil
+	}
+}
+
+// substituteExpressions replaces the placeholders in a value with the
+// results of their expressions
+func substituteExpressions(value interface{}, results []interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		if match := exprPlaceholderPattern.FindStringSubmatch(v); match != nil && match[0] == v {
+			i, _ := strconv.Atoi(match[1])
+			return results[i]
+		}
+		return exprPlaceholderPattern.ReplaceAllStringFunc(v, func(placeholder string) string {
+			i, _ := strconv.Atoi(exprPlaceholderPattern.FindStringSubmatch(placeholder)[1])
+			return exprText(results[i])
+		})
+	case map[string]interface{}:
+		for key, elem := range v {
+			v[key] = substituteExpressions(elem, results)
+		}
+		return v
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = substituteExpressions(elem, results)
+		}
+		return v
+	default:
+		return value
+	}
+}
+
+// exprText formats the result of an expression within a string; lists and
+// maps are written as JSON
+func exprText(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	}
+	if data, err := json.Marshal(value); err == nil {
+		return string(data)
+	}
+	return fmt.Sprint(value)
+}
+
+// compileExpression compiles an expression for the variables of exprEnv,
+// requiring a boolean result if asBool is set
+func compileExpression(source string, asBool bool) (*vm.Program, error) {
+	key := "any:" + source
+	options := []expr.Option{expr.Env(exprEnv{})}
+	if asBool {
+		key = "bool:" + source
+		options = append(options, expr.AsBool())
+	}
+	if program, ok := exprPrograms.Load(key); ok {
+		return program.(*vm.Program), nil
+	}
+
+	program, err := expr.Compile(source, options...)
+	if err != nil {
+		return nil, err
+	}
+	exprPrograms.Store(key, program)
+	return program, nil
+}
+
+// exprValues returns the run's data as expressions and scripts see it: the
+// template context keyed as in run records
+func exprValues(templateCtx *TemplateContext) (map[string]interface{}, error) {
+	data, err := yaml.Marshal(templateCtx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode template context: %w", err)
+	}
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("failed to encode template context: %w", err)
+	}
+
+	for _, name := range []string{"workflow_data", "nodes", "vars", "run", "output"} {
+		if values[name] == nil {
+			values[name] = map[string]interface{}{}
+		}
+	}
+	values["item"] = templateCtx.Item
+	values["index"] = templateCtx.Index
+	return values, nil
+}
+
+// normalizeValue converts a result to the types values decoded from YAML
+// have, such as []interface{} for any list
+func normalizeValue(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.Slice, reflect.Array:
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			list[i] = normalizeValue(v.Index(i).Interface())
+		}
+		return list
+	case reflect.Map:
+		result := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			result[fmt.Sprint(iter.Key().Interface())] = normalizeValue(iter.Value().Interface())
+		}
+		return result
+	default:
+		return value
+	}
+}
+
+// evalExpression evaluates an expression against the run's data
+func evalExpression(source string, values map[string]interface{}) (interface{}, error) {
+	program, err := compileExpression(source, false)
+	if err != nil {
+		return nil, err
+	}
+	result, err := expr.Run(program, newExprEnv(values))
+	if err != nil {
+		return nil, err
+	}
+	return normalizeValue(result), nil
+}
+
+// evalCondition evaluates the when condition of a node
+func evalCondition(condition string, templateCtx *TemplateContext) (bool, error) {
+	program, err := compileExpression(bareExpression(condition), true)
+	if err != nil {
+		return false, err
+	}
+	values, err := exprValues(templateCtx)
+	if err != nil {
+		return false, err
+	}
+	result, err := expr.Run(program, newExprEnv(values))
+	if err != nil {
+		return false, err
+	}
+	return result.(bool), nil
+}
+
+// evalList evaluates the for_each list of a node
+func evalList(source string, templateCtx *TemplateContext) ([]interface{}, error) {
+	values, err := exprValues(templateCtx)
+	if err != nil {
+		return nil, err
+	}
+	result, err := evalExpression(bareExpression(source), values)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, nil
+	}
+	list, ok := result.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a list, got %s", reflect.TypeOf(result))
+	}
+	return list, nil
+}
+
+// expressionPaths returns the chains of fields an expression reads from its
+// variables, such as [nodes fetch output status], including bare variables
+func expressionPaths(source string) ([][]string, error) {
+	tree, err := parser.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	collector := &pathCollector{}
+	ast.Walk(&tree.Node, collector)
+	return collector.paths, nil
+}
+
+// pathCollector collects the longest field chains rooted at variables.
+// Chains are visited innermost first, so each replaces its prefix.
+type pathCollector struct {
+	paths [][]string
+}
+
+func (c *pathCollector) Visit(node *ast.Node) {
+	path := memberPath(*node)
+	if path == nil {
+		return
+	}
+	if n := len(c.paths); n > 0 && len(path) > 1 && reflect.DeepEqual(c.paths[n-1], path[:len(path)-1]) {
+		c.paths[n-1] = path
+		return
+	}
+	c.paths = append(c.paths, path)
+}
+
+// memberPath returns the field chain of an identifier or member access with
+// constant properties, or nil for any other node
+func memberPath(node ast.Node) []string {
+	switch n := node.(type) {
+	case *ast.IdentifierNode:
+		return []string{n.Value}
+	case *ast.ChainNode:
+		return memberPath(n.Node)
+	case *ast.MemberNode:
+		property, ok := n.Property.(*ast.StringNode)
+		if !ok {
+			return nil
+		}
+		if path := memberPath(n.Node); path != nil {
+			return append(path[:len(path):len(path)], property.Value)
+		}
+	}
+	return nil
+}
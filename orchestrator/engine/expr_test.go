@@ -0,0 +1,161 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+// exprTestContext returns the run data the expression tests evaluate against
+func exprTestContext() *TemplateContext {
+	return &TemplateContext{
+		WorkflowData: map[string]interface{}{
+			"env":   "prod",
+			"pages": []interface{}{map[string]interface{}{"slug": "a", "published": true}, map[string]interface{}{"slug": "b", "published": false}},
+		},
+		Nodes: map[string]NodeOutput{
+			"fetch": {Output: map[string]interface{}{"status_code": 200, "body": "ok"}},
+		},
+		Vars:  map[string]interface{}{"retries": 3},
+		Run:   RunInfo{ID: "run-1", Status: RunRunning},
+		Item:  "x",
+		Index: 2,
+	}
+}
+
+func TestEvalCondition(t *testing.T) {
+	tests := []struct {
+		condition string
+		want      bool
+		wantErr   bool
+	}{
+		{condition: `workflow_data.env == "prod"`, want: true},
+		{condition: `${{ workflow_data.env == "prod" }}`, want: true},
+		{condition: `  ${{ workflow_data.env == "dev" }}  `, want: false},
+		{condition: `nodes.fetch.output.status_code == 200 && vars.retries > 2`, want: true},
+		{condition: `run.status == "running"`, want: true},
+		{condition: `item == "x" && index == 2`, want: true},
+		{condition: `workflow_data.missing == nil`, want: true},
+		{condition: `len(filter(workflow_data.pages, .published)) == 1`, want: true},
+		{condition: `workflow_data.env`, wantErr: true},          // Not a boolean
+		{condition: `workflow_data.env ==`, wantErr: true},       // Syntax error
+		{condition: `unknown.field == 1`, wantErr: true},         // Unknown variable
+		{condition: `${{ true }} && ${{ true }}`, wantErr: true}, // Not a single expression
+	}
+
+	for _, tt := range tests {
+		got, err := evalCondition(tt.condition, exprTestContext())
+		if (err != nil) != tt.wantErr {
+			t.Errorf("evalCondition(%q) error = %v, wantErr %v", tt.condition, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("evalCondition(%q) = %v, want %v", tt.condition, got, tt.want)
+		}
+	}
+}
+
+func TestEvalList(t *testing.T) {
+	tests := []struct {
+		source  string
+		want    []interface{}
+		wantErr bool
+	}{
+		{source: `${{ [1, 2] }}`, want: []interface{}{1, 2}},
+		{source: `map(filter(workflow_data.pages, .published), .slug)`, want: []interface{}{"a"}},
+		{source: `workflow_data.missing`, want: nil},
+		{source: `workflow_data.env`, wantErr: true}, // Not a list
+	}
+
+	for _, tt := range tests {
+		got, err := evalList(tt.source, exprTestContext())
+		if (err != nil) != tt.wantErr {
+			t.Errorf("evalList(%q) error = %v, wantErr %v", tt.source, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("evalList(%q) = %#v, want %#v", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestSubstituteExpressions(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   interface{}
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			name:  "whole field keeps its type",
+			value: "${{ nodes.fetch.output.status_code }}",
+			want:  200,
+		},
+		{
+			name:  "list result",
+			value: "${{ [vars.retries, index] }}",
+			want:  []interface{}{3, 2},
+		},
+		{
+			name:  "within a string",
+			value: "status ${{ nodes.fetch.output.status_code }} in ${{ workflow_data.env }}",
+			want:  "status 200 in prod",
+		},
+		{
+			name:  "list within a string is JSON",
+			value: "codes: ${{ [1, 2] }}",
+			want:  "codes: [1,2]",
+		},
+		{
+			name:  "nil within a string is empty",
+			value: "[${{ workflow_data.missing }}]",
+			want:  "[]",
+		},
+		{
+			name:  "braces in a map literal and string",
+			value: `${{ {"k": "}}"}.k }}`,
+			want:  "}}",
+		},
+		{
+			name:  "nested maps and lists",
+			value: map[string]interface{}{"a": []interface{}{"${{ item }}", 1}, "b": "plain {{.Run.ID}}"},
+			want:  map[string]interface{}{"a": []interface{}{"x", 1}, "b": "plain {{.Run.ID}}"},
+		},
+		{
+			name:    "unterminated",
+			value:   "${{ workflow_data.env",
+			wantErr: true,
+		},
+		{
+			name:    "empty",
+			value:   "${{ }}",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extracted, sources, err := extractExpressions(tt.value, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("extractExpressions error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			values, err := exprValues(exprTestContext())
+			if err != nil {
+				t.Fatal(err)
+			}
+			results := make([]interface{}, len(sources))
+			for i, source := range sources {
+				if results[i], err = evalExpression(source, values); err != nil {
+					t.Fatalf("evalExpression(%q): %v", source, err)
+				}
+			}
+
+			if got := substituteExpressions(extracted, results); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("substituteExpressions = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
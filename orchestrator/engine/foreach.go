@@ -0,0 +1,51 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+)
+
+// executeForEach runs a node once for every item of its for_each list, in
+// order, with the item and its index available as {{.Item}} and {{.Index}}
+// or item and index in expressions. The node's output lists the outputs of
+// its items as results. It reports whether every output came from the cache.
+func (e *Engine) executeForEach(ctx context.Context, node NodeV1, templateCtx *TemplateContext, permissions *PermissionsV1) (map[string]interface{}, bool, error) {
+	items, err := evalList(node.ForEach, templateCtx)
+	if err != nil {
+		return nil, false, fmt.Errorf("for_each: %w", err)
+	}
+	e.Logger.Printf("Node %s runs for %d items %s", node.ID, len(items), statusINFO)
+
+	results := make([]interface{}, 0, len(items))
+	allCached := len(items) > 0
+	for i, item := range items {
+		if ctx.Err() != nil {
+			return nil, false, fmt.Errorf("cancelled before item %d: %w", i, context.Cause(ctx))
+		}
+
+		itemCtx := *templateCtx
+		itemCtx.Item, itemCtx.Index = item, i
+		output, cached, err := e.executeNode(ctx, node, &itemCtx, permissions)
+		if err != nil {
+			return nil, false, fmt.Errorf("item %d: %w", i, err)
+		}
+		observeUsage(node, cached, output)
+		results = append(results, output)
+		allCached = allCached && cached
+	}
+
+	return map[string]interface{}{"results": results}, allCached, nil
+}
+
+// checkForEach rejects for_each on built-in nodes that decide the course of
+// the run or suspend it, which cannot repeat
+func checkForEach(workflow *WorkflowV1) error {
+	for _, nodes := range [][]NodeV1{workflow.Nodes, workflow.Finally} {
+		for _, node := range nodes {
+			if node.ForEach != "" && (node.Type == approvalNodeType || node.Type == switchNodeType || isWaitNode(node)) {
+				return fmt.Errorf("node %s: for_each cannot be used on %s nodes", node.ID, node.Type)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,322 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Workflow files can import libraries of shared definitions:
+//
+//	# lib/github.yaml
+//	imports: ["common.yaml"]      # libraries may import other libraries
+//	vars:
+//	  api: "https://api.github.com"
+//	templates:
+//	  github_request:
+//	    type: "httprequest"
+//	    inputs_from_workflow:
+//	      headers: {Accept: "application/vnd.github+json"}
+//
+// Nodes use a template with extends; the node is deep-merged over the
+// template, so mappings are merged key by key while lists and scalars are
+// replaced. Templates may extend other templates, and a workflow may define
+// templates and vars of its own, which take precedence over imported ones.
+// Expansion happens before anything else looks at the workflow.
+
+// workflowDefinitions collects the templates and vars available to a workflow
+type workflowDefinitions struct {
+	templates map[string]*yaml.Node
+	sources   map[string]string // File each template was defined in
+	vars      *yaml.Node
+	loaded    map[string]bool // Libraries already imported
+	expanded  map[string]*yaml.Node
+}
+
+// loadWorkflowDocument reads a workflow file and expands its imports and
+// templates, returning the resulting YAML document
+func loadWorkflowDocument(filename string) (*yaml.Node, error) {
+	path, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	root, err := readYAMLMapping(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defs := &workflowDefinitions{
+		templates: make(map[string]*yaml.Node),
+		sources:   make(map[string]string),
+		vars:      &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"},
+		loaded:    map[string]bool{path: true},
+		expanded:  make(map[string]*yaml.Node),
+	}
+	if err := defs.importAll(root, path, []string{path}); err != nil {
+		return nil, err
+	}
+
+	// The workflow's own definitions take precedence over imported ones
+	if err := defs.add(root, path, true); err != nil {
+		return nil, err
+	}
+
+	for _, key := range []string{"nodes", "finally"} {
+		if err := defs.expandNodes(mappingValue(root, key), key); err != nil {
+			return nil, err
+		}
+	}
+
+	removeMappingKey(root, "imports")
+	removeMappingKey(root, "templates")
+	if len(defs.vars.Content) > 0 {
+		setMappingValue(root, "vars", defs.vars)
+	}
+
+	return &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}}, nil
+}
+
+// readYAMLMapping parses a YAML file whose top level must be a mapping
+func readYAMLMapping(path string) (*yaml.Node, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse YAML in %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s must contain a YAML mapping", path)
+	}
+	return doc.Content[0], nil
+}
+
+// importAll loads the libraries listed under imports in file, depth first.
+// stack holds the chain of files being imported, to report cycles.
+func (d *workflowDefinitions) importAll(root *yaml.Node, file string, stack []string) error {
+	imports := mappingValue(root, "imports")
+	if imports == nil {
+		return nil
+	}
+	if imports.Kind != yaml.SequenceNode {
+		return fmt.Errorf("imports in %s must be a list of files", file)
+	}
+
+	for _, entry := range imports.Content {
+		if entry.Kind != yaml.ScalarNode || entry.Value == "" {
+			return fmt.Errorf("imports in %s must be a list of files", file)
+		}
+
+		path := entry.Value
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(file), path)
+		}
+		path = filepath.Clean(path)
+
+		for _, importing := range stack {
+			if importing == path {
+				return fmt.Errorf("import cycle: %s", strings.Join(append(stack, path), " -> "))
+			}
+		}
+		if d.loaded[path] {
+			continue
+		}
+		d.loaded[path] = true
+
+		library, err := readYAMLMapping(path)
+		if err != nil {
+			return fmt.Errorf("failed to import %s: %w", entry.Value, err)
+		}
+		for i := 0; i < len(library.Content); i += 2 {
+			switch key := library.Content[i].Value; key {
+			case "imports", "templates", "vars":
+			default:
+				return fmt.Errorf("library %s has unknown key %q (expected imports, templates or vars)", path, key)
+			}
+		}
+
+		if err := d.importAll(library, path, append(stack, path)); err != nil {
+			return err
+		}
+		if err := d.add(library, path, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add registers the templates and vars defined in file. Unless override is
+// set, a template defined twice is an error.
+func (d *workflowDefinitions) add(root *yaml.Node, file string, override bool) error {
+	if templates := mappingValue(root, "templates"); templates != nil {
+		if templates.Kind != yaml.MappingNode {
+			return fmt.Errorf("templates in %s must be a mapping of names to nodes", file)
+		}
+		for i := 0; i < len(templates.Content); i += 2 {
+			name, template := templates.Content[i].Value, templates.Content[i+1]
+			if template.Kind != yaml.MappingNode {
+				return fmt.Errorf("template %s in %s must be a mapping", name, file)
+			}
+			if source, exists := d.sources[name]; exists && !override {
+				return fmt.Errorf("template %s is defined in both %s and %s", name, source, file)
+			}
+			d.templates[name] = template
+			d.sources[name] = file
+		}
+	}
+
+	if vars := mappingValue(root, "vars"); vars != nil {
+		if vars.Kind != yaml.MappingNode {
+			return fmt.Errorf("vars in %s must be a mapping", file)
+		}
+		d.vars = mergeYAML(d.vars, vars)
+	}
+	return nil
+}
+
+// resolve returns a template with the templates it extends merged in
+func (d *workflowDefinitions) resolve(name string, stack []string) (*yaml.Node, error) {
+	if expanded, ok := d.expanded[name]; ok {
+		return expanded, nil
+	}
+	for _, extending := range stack {
+		if extending == name {
+			return nil, fmt.Errorf("template cycle: %s", strings.Join(append(stack, name), " -> "))
+		}
+	}
+
+	template, ok := d.templates[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown template %q", name)
+	}
+
+	expanded := copyYAML(template)
+	if parent := mappingValue(expanded, "extends"); parent != nil {
+		base, err := d.resolve(parent.Value, append(stack, name))
+		if err != nil {
+			return nil, err
+		}
+		removeMappingKey(expanded, "extends")
+		expanded = mergeYAML(base, expanded)
+	}
+
+	d.expanded[name] = expanded
+	return expanded, nil
+}
+
+// expandNodes replaces every node that extends a template with the merge of
+// the template and the node
+func (d *workflowDefinitions) expandNodes(nodes *yaml.Node, label string) error {
+	if nodes == nil || nodes.Kind != yaml.SequenceNode {
+		return nil
+	}
+
+	for i, node := range nodes.Content {
+		extends := mappingValue(node, "extends")
+		if extends == nil {
+			continue
+		}
+		if extends.Kind != yaml.ScalarNode {
+			return fmt.Errorf("%s %d: extends must be a template name", label, i)
+		}
+
+		base, err := d.resolve(extends.Value, nil)
+		if err != nil {
+			return fmt.Errorf("%s %d: %w", label, i, err)
+		}
+		override := copyYAML(node)
+		removeMappingKey(override, "extends")
+		nodes.Content[i] = orderLike(mergeYAML(base, override), node, "extends")
+	}
+	return nil
+}
+
+// orderLike reorders the keys of merged to follow the node it was expanded
+// from, with the keys that came from the template where placeholder was
+func orderLike(merged, node *yaml.Node, placeholder string) *yaml.Node {
+	ordered := &yaml.Node{Kind: yaml.MappingNode, Tag: merged.Tag, Style: merged.Style}
+	for i := 0; i < len(node.Content); i += 2 {
+		key := node.Content[i].Value
+		if key != placeholder {
+			ordered.Content = append(ordered.Content, node.Content[i], mappingValue(merged, key))
+			continue
+		}
+		for j := 0; j < len(merged.Content); j += 2 {
+			if mappingValue(node, merged.Content[j].Value) == nil {
+				ordered.Content = append(ordered.Content, merged.Content[j], merged.Content[j+1])
+			}
+		}
+	}
+	return ordered
+}
+
+// mergeYAML deep-merges override over a copy of base. Mappings are merged key
+// by key; anything else in override replaces base.
+func mergeYAML(base, override *yaml.Node) *yaml.Node {
+	if base == nil || base.Kind != yaml.MappingNode || override.Kind != yaml.MappingNode {
+		return copyYAML(override)
+	}
+
+	merged := copyYAML(base)
+	for i := 0; i < len(override.Content); i += 2 {
+		key, value := override.Content[i], override.Content[i+1]
+		if existing := mappingValue(merged, key.Value); existing != nil {
+			setMappingValue(merged, key.Value, mergeYAML(existing, value))
+		} else {
+			merged.Content = append(merged.Content, copyYAML(key), copyYAML(value))
+		}
+	}
+	return merged
+}
+
+// copyYAML returns a deep copy of a YAML node
+func copyYAML(node *yaml.Node) *yaml.Node {
+	if node == nil {
+		return nil
+	}
+	copied := *node
+	copied.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		copied.Content[i] = copyYAML(child)
+	}
+	return &copied
+}
+
+// mappingValue returns the value of key in a mapping node, or nil
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setMappingValue sets key in a mapping node, appending it if missing
+func setMappingValue(mapping *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content[i+1] = value
+			return
+		}
+	}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
+
+// removeMappingKey deletes key from a mapping node
+func removeMappingKey(mapping *yaml.Node, key string) {
+	for i := 0; i < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MatrixV1 runs a workflow once per combination of parameter values. Each
+// combination's values are added to the initial data of its run.
+type MatrixV1 struct {
+	Parameters  map[string][]interface{} `yaml:"parameters"`            // Values of each parameter; runs cover the cartesian product
+	Include     []map[string]interface{} `yaml:"include,omitempty"`     // Extra combinations
+	Exclude     []map[string]interface{} `yaml:"exclude,omitempty"`     // Combinations to drop; an entry matches when all its values match
+	Parallelism int                      `yaml:"parallelism,omitempty"` // Runs executed at the same time (default: 1)
+}
+
+// MatrixSkipped is the status of a combination that was not run, in addition
+// to the run statuses
+const MatrixSkipped = "skipped"
+
+// MatrixResult is the outcome of one combination
+type MatrixResult struct {
+	Values   map[string]interface{}
+	RunID    string
+	Status   string
+	Duration time.Duration
+	Err      error
+}
+
+// LoadMatrix reads a matrix definition file
+func LoadMatrix(filename string) (*MatrixV1, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read matrix file: %w", err)
+	}
+
+	var matrix MatrixV1
+	if err := yaml.Unmarshal(data, &matrix); err != nil {
+		return nil, fmt.Errorf("failed to parse matrix file: %w", err)
+	}
+	return &matrix, nil
+}
+
+// Combinations expands the matrix into the values of each run: the cartesian
+// product of the parameters in name order, minus excluded combinations, plus
+// included ones
+func (m *MatrixV1) Combinations() ([]map[string]interface{}, error) {
+	names := make([]string, 0, len(m.Parameters))
+	for name, values := range m.Parameters {
+		if len(values) == 0 {
+			return nil, fmt.Errorf("matrix parameter %s has no values", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var product []map[string]interface{}
+	if len(names) > 0 {
+		product = []map[string]interface{}{{}}
+	}
+	for _, name := range names {
+		var next []map[string]interface{}
+		for _, partial := range product {
+			for _, value := range m.Parameters[name] {
+				combination := make(map[string]interface{}, len(partial)+1)
+				for k, v := range partial {
+					combination[k] = v
+				}
+				combination[name] = value
+				next = append(next, combination)
+			}
+		}
+		product = next
+	}
+
+	var combinations []map[string]interface{}
+	for _, combination := range product {
+		if !m.excluded(combination) {
+			combinations = append(combinations, combination)
+		}
+	}
+	for _, include := range m.Include {
+		if len(include) == 0 {
+			return nil, fmt.Errorf("matrix include entries must not be empty")
+		}
+		duplicate := false
+		for _, combination := range combinations {
+			if MatrixLabel(combination) == MatrixLabel(include) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			combinations = append(combinations, include)
+		}
+	}
+
+	if len(combinations) == 0 {
+		return nil, fmt.Errorf("matrix has no combinations")
+	}
+	return combinations, nil
+}
+
+// excluded reports whether any exclude entry matches the combination
+func (m *MatrixV1) excluded(combination map[string]interface{}) bool {
+	for _, exclude := range m.Exclude {
+		matches := len(exclude) > 0
+		for name, value := range exclude {
+			if fmt.Sprint(combination[name]) != fmt.Sprint(value) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+// MatrixLabel describes a combination as name=value pairs in name order
+func MatrixLabel(values map[string]interface{}) string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s=%v", name, values[name])
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// RunMatrix runs the workflow once per combination of its matrix, at most
+// parallelism at a time, adding each combination's values to data.
+// Combinations not started when ctx is cancelled are reported with status
+// MatrixSkipped.
+func (e *Engine) RunMatrix(ctx context.Context, data map[string]interface{}) ([]MatrixResult, error) {
+	if e.Workflow == nil || e.Workflow.Matrix == nil {
+		return nil, errors.New("no matrix to run")
+	}
+	matrix := e.Workflow.Matrix
+	combinations, err := matrix.Combinations()
+	if err != nil {
+		return nil, fmt.Errorf("invalid matrix: %w", err)
+	}
+
+	parallelism := matrix.Parallelism
+	if parallelism <= 0 {
+		parallelism = 1
+	}
+	e.Logger.Printf("Running %d matrix combination(s), %d at a time %s", len(combinations), parallelism, statusINFO)
+
+	results := make([]MatrixResult, len(combinations))
+	slots := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, values := range combinations {
+		results[i] = MatrixResult{Values: values, Status: MatrixSkipped}
+
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, values map[string]interface{}) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			combined := make(map[string]interface{}, len(data)+len(values))
+			for k, v := range data {
+				combined[k] = v
+			}
+			for k, v := range values {
+				combined[k] = v
+			}
+
+			e.Logger.Printf("Starting matrix combination %d/%d (%s) %s", i+1, len(combinations), MatrixLabel(values), statusINFO)
+			started := time.Now()
+			result, err := e.start(ctx, combined, values)
+
+			results[i].RunID = result.RunID
+			results[i].Status = result.Status
+			results[i].Duration = time.Since(started)
+			results[i].Err = err
+		}(i, values)
+	}
+	wg.Wait()
+
+	return results, nil
+}
@@ -0,0 +1,95 @@
+package engine
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Prometheus metrics, exposed on /metrics in server mode
+var (
+	runsStarted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "octa_runs_started_total",
+		Help: "Workflow runs started.",
+	}, []string{"workflow"})
+
+	runsCompleted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "octa_runs_completed_total",
+		Help: "Workflow runs completed, by final status (succeeded, failed or cancelled).",
+	}, []string{"workflow", "status"})
+
+	nodeDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "octa_node_duration_seconds",
+		Help:    "Duration of node executions, including cache hits.",
+		Buckets: []float64{0.01, 0.05, 0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	}, []string{"action", "status"})
+
+	nodesRunning = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "octa_nodes_running",
+		Help: "Nodes currently executing.",
+	}, []string{"action"})
+
+	cacheHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "octa_cache_hits_total",
+		Help: "Node executions served from the cache.",
+	}, []string{"action"})
+
+	cacheMisses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "octa_cache_misses_total",
+		Help: "Node executions with caching enabled that had to run the action.",
+	}, []string{"action"})
+
+	// Exported ahead of node retries so that dashboards can use it; nothing
+	// increments it yet, and its series are created as actions run
+	nodeRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "octa_node_retries_total",
+		Help: "Node executions retried after a failure.",
+	}, []string{"action"})
+
+	claudeTokens = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "octa_claude_tokens_total",
+		Help: "Tokens used by claude-api nodes, by model and direction (input or output).",
+	}, []string{"model", "direction"})
+)
+
+// observeNode records the metrics of a finished node execution
+func observeNode(node NodeV1, status string, started time.Time, cached bool, output map[string]interface{}) {
+	nodeDuration.WithLabelValues(node.Type, status).Observe(time.Since(started).Seconds())
+	// Exports the action's retry series at 0
+	nodeRetries.WithLabelValues(node.Type)
+
+	// The items of for_each nodes are observed as they complete, since only
+	// some of them may have come from the cache
+	if status == NodeSucceeded && node.ForEach == "" {
+		observeUsage(node, cached, output)
+	}
+}
+
+// observeUsage records the resources an action execution reported using.
+// Cached outputs did not use any.
+func observeUsage(node NodeV1, cached bool, output map[string]interface{}) {
+	if node.Type == "claude-api" && !cached {
+		observeClaudeUsage(output)
+	}
+}
+
+// observeClaudeUsage adds the token usage a claude-api node reported
+func observeClaudeUsage(output map[string]interface{}) {
+	usage, ok := output["usage"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	model, _ := output["model"].(string)
+
+	for _, direction := range []string{"input", "output"} {
+		// Older claude-api binaries name the keys inputtokens and outputtokens
+		tokens, ok := usage[direction+"_tokens"].(int)
+		if !ok {
+			tokens, ok = usage[direction+"tokens"].(int)
+		}
+		if ok && tokens > 0 {
+			claudeTokens.WithLabelValues(model, direction).Add(float64(tokens))
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObserveClaudeUsage(t *testing.T) {
+	tests := []struct {
+		name         string
+		output       map[string]interface{}
+		inputTokens  float64
+		outputTokens float64
+	}{
+		{"current keys", map[string]interface{}{"usage": map[string]interface{}{"input_tokens": 3, "output_tokens": 5}}, 3, 5},
+		{"older keys", map[string]interface{}{"usage": map[string]interface{}{"inputtokens": 7, "outputtokens": 11}}, 7, 11},
+		{"no usage", map[string]interface{}{"response": "hi"}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := "test-" + tt.name
+			tt.output["model"] = model
+			observeClaudeUsage(tt.output)
+
+			if got := testutil.ToFloat64(claudeTokens.WithLabelValues(model, "input")); got != tt.inputTokens {
+				t.Errorf("input tokens = %v, want %v", got, tt.inputTokens)
+			}
+			if got := testutil.ToFloat64(claudeTokens.WithLabelValues(model, "output")); got != tt.outputTokens {
+				t.Errorf("output tokens = %v, want %v", got, tt.outputTokens)
+			}
+		})
+	}
+}
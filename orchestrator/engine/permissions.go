@@ -0,0 +1,69 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PermissionsV1 declares what a workflow's actions may do. Without it actions
+// are unrestricted; once declared, anything not granted is refused by the
+// bundled actions.
+type PermissionsV1 struct {
+	WriteRoots     []string `yaml:"write_roots,omitempty" json:"write_roots"`         // Directories files may be written beneath
+	URLHosts       []string `yaml:"url_hosts,omitempty" json:"url_hosts"`             // Host names, or *.domain patterns, actions may contact
+	GitCredentials bool     `yaml:"git_credentials,omitempty" json:"git_credentials"` // Whether git actions may use credentials
+}
+
+// permissionsEnvVar carries a workflow's permissions to its actions
+const permissionsEnvVar = "OCTA_PERMISSIONS"
+
+// resolvePermissions makes write roots absolute and checks host patterns
+func resolvePermissions(permissions *PermissionsV1) (*PermissionsV1, error) {
+	if permissions == nil {
+		return nil, nil
+	}
+
+	resolved := &PermissionsV1{GitCredentials: permissions.GitCredentials}
+	for _, root := range permissions.WriteRoots {
+		if strings.TrimSpace(root) == "" {
+			return nil, fmt.Errorf("write_roots entries must not be empty")
+		}
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return nil, fmt.Errorf("invalid write root %s: %w", root, err)
+		}
+		resolved.WriteRoots = append(resolved.WriteRoots, abs)
+	}
+	for _, host := range permissions.URLHosts {
+		pattern := strings.ToLower(strings.TrimSpace(host))
+		if pattern == "" || strings.Contains(strings.TrimPrefix(pattern, "*."), "*") || strings.ContainsAny(pattern, "/:") {
+			return nil, fmt.Errorf("invalid url_hosts entry %q (must be a host name or *.domain)", host)
+		}
+		resolved.URLHosts = append(resolved.URLHosts, pattern)
+	}
+	return resolved, nil
+}
+
+// withPermissionsEnv returns env with the permissions variable set, replacing
+// any inherited or node-provided value so that nodes cannot widen their scope.
+// A nil env stands for the orchestrator's environment.
+func withPermissionsEnv(env []string, permissions *PermissionsV1) ([]string, error) {
+	encoded, err := json.Marshal(permissions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode permissions: %w", err)
+	}
+
+	if env == nil {
+		env = os.Environ()
+	}
+	result := make([]string, 0, len(env)+1)
+	for _, entry := range env {
+		if !strings.HasPrefix(entry, permissionsEnvVar+"=") {
+			result = append(result, entry)
+		}
+	}
+	return append(result, permissionsEnvVar+"="+string(encoded)), nil
+}
@@ -0,0 +1,31 @@
+//go:build !unix
+
+package engine
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// setProcessGroup is a no-op where process groups are not supported
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// signalProcessGroup kills the process; other signals cannot be delivered here
+func signalProcessGroup(cmd *exec.Cmd, sig os.Signal) error {
+	return cmd.Process.Kill()
+}
+
+// lockFile takes an exclusive lock on path by creating it; a lock left behind
+// by a crashed process has to be removed by hand
+func lockFile(path string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	return func() { os.Remove(path) }, nil
+}
@@ -0,0 +1,436 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"text/template"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/yaml.v3"
+)
+
+// run executes the workflow's nodes from index start on, followed by its
+// finally nodes. A run reaching a wait node that cannot complete now is
+// suspended instead: its state is saved for Resume and the finally nodes do
+// not run yet.
+func (e *Engine) run(ctx context.Context, workflow *WorkflowV1, record *RunRecord, templateCtx *TemplateContext, start int) (runErr error) {
+	resumed := templateCtx.resumed != nil
+	ctx, span := tracer.Start(ctx, "workflow "+workflow.Name, trace.WithAttributes(
+		attrWorkflowName.String(workflow.Name),
+		attrRunID.String(record.ID),
+		attrRunResumed.Bool(resumed),
+	))
+	defer endRunSpan(span, record)
+
+	// A resumed run was counted when it started, and a suspended one has not
+	// completed
+	if !resumed {
+		runsStarted.WithLabelValues(workflow.Name).Inc()
+	}
+	defer func() {
+		if record.Status != RunWaiting {
+			runsCompleted.WithLabelValues(workflow.Name, record.Status).Inc()
+		}
+		if runErr != nil && record.Status != RunWaiting && e.Hooks.OnError != nil {
+			e.Hooks.OnError(ctx, record.ID, runErr)
+		}
+	}()
+
+	if templateCtx.Run.Workspace == "" {
+		workspace, err := e.createWorkspace(record.ID)
+		if err != nil {
+			record.finish(RunFailed, err)
+			return err
+		}
+		templateCtx.Run.Workspace = workspace
+	}
+
+	permissions, err := resolvePermissions(workflow.Permissions)
+	if err != nil {
+		err = fmt.Errorf("invalid permissions: %w", err)
+		record.finish(RunFailed, err)
+		return err
+	}
+	if permissions != nil {
+		// Actions may always write to the run's own workspace
+		permissions.WriteRoots = append(permissions.WriteRoots, templateCtx.Run.Workspace)
+	}
+
+	nodeIDs := make(map[string]bool)
+	for _, node := range append(append([]NodeV1{}, workflow.Nodes...), workflow.Finally...) {
+		nodeIDs[node.ID] = true
+	}
+	templateCtx.vars, err = newVarResolver(workflow.Vars, nodeIDs)
+	if err == nil {
+		// Vars evaluated before the run was suspended keep their values
+		templateCtx.vars.markResolved(templateCtx.Vars)
+		err = templateCtx.resolveVars()
+	}
+	if err != nil {
+		err = fmt.Errorf("invalid vars: %w", err)
+		record.finish(RunFailed, err)
+		return err
+	}
+
+	for _, node := range workflow.Finally {
+		if isWaitNode(node) {
+			err := fmt.Errorf("finally node %s: %s nodes cannot be used in finally", node.ID, node.Type)
+			record.finish(RunFailed, err)
+			return err
+		}
+	}
+
+	if err := checkCompensations(workflow); err != nil {
+		record.finish(RunFailed, err)
+		return err
+	}
+
+	if err := checkForEach(workflow); err != nil {
+		record.finish(RunFailed, err)
+		return err
+	}
+
+	if templateCtx.routes, err = newRoutes(workflow); err != nil {
+		record.finish(RunFailed, err)
+		return err
+	}
+
+	runErr = e.executeNodes(ctx, workflow.Nodes[start:], templateCtx, record, permissions)
+
+	var suspended *suspension
+	if errors.As(runErr, &suspended) {
+		suspended.index += start
+		if err := e.suspendRun(workflow, record, templateCtx, suspended); err != nil {
+			record.finish(RunFailed, err)
+			return err
+		}
+		return runErr
+	}
+
+	status := RunSucceeded
+	if runErr != nil {
+		status = RunFailed
+		if ctx.Err() != nil {
+			status = RunCancelled
+		}
+	}
+
+	// Compensations and finally nodes run on a fresh context so that a
+	// cancelled run can still clean up within the grace period
+	cleanupCtx := trace.ContextWithSpan(context.Background(), span)
+	if status == RunCancelled {
+		var cancel context.CancelFunc
+		cleanupCtx, cancel = context.WithTimeout(cleanupCtx, e.GracePeriod)
+		defer cancel()
+	}
+
+	// A failed run undoes what its completed nodes did
+	if runErr != nil {
+		e.compensate(cleanupCtx, workflow, templateCtx, record, permissions)
+	}
+
+	// Finally nodes always run
+	if len(workflow.Finally) > 0 {
+		templateCtx.Run.Status = status
+		if runErr != nil {
+			templateCtx.Run.Error = runErr.Error()
+		}
+
+		e.Logger.Printf("Running %d finally node(s) after run %s %s", len(workflow.Finally), status, statusINFO)
+
+		for _, node := range workflow.Finally {
+			if err := e.executeNodes(cleanupCtx, []NodeV1{node}, templateCtx, record, permissions); err != nil && runErr == nil {
+				runErr = err
+				status = RunFailed
+			}
+		}
+	}
+
+	e.collectArtifacts(workflow.Nodes, templateCtx, record, permissions)
+	e.collectArtifacts(workflow.Finally, templateCtx, record, permissions)
+
+	if resumed {
+		e.removeSuspendedRun(record.ID)
+	}
+
+	record.finish(status, runErr)
+	return runErr
+}
+
+// executeNodes executes nodes sequentially, stopping at the first failure
+func (e *Engine) executeNodes(ctx context.Context, nodes []NodeV1, templateCtx *TemplateContext, record *RunRecord, permissions *PermissionsV1) error {
+	for i, node := range nodes {
+		if ctx.Err() != nil {
+			return fmt.Errorf("run cancelled before node %s: %w", node.ID, context.Cause(ctx))
+		}
+
+		// Nodes on branches not taken by their switch or whose when condition
+		// is false are skipped
+		reason := templateCtx.routes.skipReason(node, templateCtx)
+		if reason == "" && node.When != "" {
+			run, err := evalCondition(node.When, templateCtx)
+			if err != nil {
+				started := time.Now()
+				observeNode(node, NodeFailed, started, false, nil)
+				record.recordNode(node, NodeFailed, started, false, err)
+				e.afterNode(ctx, NodeEvent{RunID: record.ID, Node: node, Status: NodeFailed, Err: err})
+				e.Logger.Printf("Node %s when condition failed %s", node.ID, statusFAILED)
+				return fmt.Errorf("error executing node %s: when: %w", node.ID, err)
+			}
+			if !run {
+				reason = fmt.Sprintf("when %s is false", bareExpression(node.When))
+			}
+		}
+		if reason != "" {
+			templateCtx.Nodes[node.ID] = NodeOutput{Skipped: true}
+			record.recordNode(node, NodeSkipped, time.Now(), false, nil)
+			e.afterNode(ctx, NodeEvent{RunID: record.ID, Node: node, Status: NodeSkipped})
+			e.Logger.Printf("Skipping node %s: %s %s", node.ID, reason, statusINFO)
+			if err := templateCtx.resolveVars(); err != nil {
+				return fmt.Errorf("after node %s: %w", node.ID, err)
+			}
+			continue
+		}
+
+		// Update node execution messages
+		e.Logger.Printf("Executing node: %s (%s) %s", node.ID, node.Type, statusINFO)
+		started := time.Now()
+
+		nodeCtx, span := tracer.Start(ctx, "node "+node.ID, trace.WithAttributes(
+			attrNodeID.String(node.ID),
+			attrActionType.String(node.Type),
+		))
+		var output map[string]interface{}
+		var cached bool
+		err := e.beforeNode(nodeCtx, NodeEvent{RunID: record.ID, Node: node})
+		if err == nil {
+			nodesRunning.WithLabelValues(node.Type).Inc()
+			if node.ForEach != "" {
+				output, cached, err = e.executeForEach(nodeCtx, node, templateCtx, permissions)
+			} else {
+				output, cached, err = e.executeNode(nodeCtx, node, templateCtx, permissions)
+			}
+			nodesRunning.WithLabelValues(node.Type).Dec()
+		}
+		span.SetAttributes(attrNodeCached.Bool(cached))
+
+		// A wait node that cannot complete now suspends the run
+		var suspended *suspension
+		if errors.As(err, &suspended) {
+			span.End()
+			suspended.index = i
+			record.recordNode(node, NodeWaiting, started, false, nil)
+			e.afterNode(nodeCtx, NodeEvent{RunID: record.ID, Node: node, Status: NodeWaiting, Duration: time.Since(started)})
+			e.Logger.Printf("Node %s is waiting %s %s", node.ID, suspended.wait.describe(), statusWARN)
+			return suspended
+		}
+
+		endSpan(span, err)
+		if err != nil {
+			status := NodeFailed
+			if ctx.Err() != nil {
+				status = NodeCancelled
+			}
+			observeNode(node, status, started, false, nil)
+			record.recordNode(node, status, started, false, err)
+			e.afterNode(nodeCtx, NodeEvent{RunID: record.ID, Node: node, Status: status, Duration: time.Since(started), Err: err})
+			e.Logger.Printf("Node %s execution %s %s", node.ID, status, statusFAILED)
+			return fmt.Errorf("error executing node %s: %w", node.ID, err)
+		}
+
+		// Store the output for future template resolution
+		templateCtx.Nodes[node.ID] = NodeOutput{
+			Output: output,
+		}
+		observeNode(node, NodeSucceeded, started, cached, output)
+		record.recordNode(node, NodeSucceeded, started, cached, nil)
+		e.afterNode(nodeCtx, NodeEvent{RunID: record.ID, Node: node, Status: NodeSucceeded, Output: output, Cached: cached, Duration: time.Since(started)})
+
+		// Vars referring to this node can be evaluated now
+		if err := templateCtx.resolveVars(); err != nil {
+			e.Logger.Printf("Node %s completed but its vars failed %s", node.ID, statusFAILED)
+			return fmt.Errorf("after node %s: %w", node.ID, err)
+		}
+
+		// Update node completion message
+		e.Logger.Printf("Node %s completed successfully %s", node.ID, statusOK)
+	}
+
+	return nil
+}
+
+// beforeNode calls the BeforeNode hook, if any
+func (e *Engine) beforeNode(ctx context.Context, event NodeEvent) error {
+	if e.Hooks.BeforeNode == nil {
+		return nil
+	}
+	if err := e.Hooks.BeforeNode(ctx, event); err != nil {
+		return fmt.Errorf("before node hook: %w", err)
+	}
+	return nil
+}
+
+// afterNode calls the AfterNode hook, if any
+func (e *Engine) afterNode(ctx context.Context, event NodeEvent) {
+	if e.Hooks.AfterNode != nil {
+		e.Hooks.AfterNode(ctx, event)
+	}
+}
+
+// executeNode executes a single V1 node under the workflow's permissions.
+// It reports whether the output was served from the cache.
+func (e *Engine) executeNode(ctx context.Context, node NodeV1, templateCtx *TemplateContext, permissions *PermissionsV1) (map[string]interface{}, bool, error) {
+	// Approval nodes are built in and wait for a person instead of an action.
+	// They are waits too, so they are dispatched before the other wait nodes.
+	if node.Type == approvalNodeType {
+		output, err := e.executeApproval(ctx, node, templateCtx)
+		return output, false, err
+	}
+	if isWaitNode(node) {
+		output, err := e.executeWait(ctx, node, templateCtx)
+		return output, false, err
+	}
+	if node.Type == switchNodeType {
+		output, err := executeSwitch(node, templateCtx)
+		return output, false, err
+	}
+	if node.Type == scriptNodeType {
+		output, err := e.executeScript(ctx, node, templateCtx)
+		return output, false, err
+	}
+
+	manifest, err := e.LoadActionManifest(node.Type)
+	if err != nil {
+		return nil, false, err
+	}
+	inputYAML, err := renderNodeInput(ctx, node, templateCtx, manifest.Input)
+	if err != nil {
+		return nil, false, err
+	}
+
+	maxInputBytes := node.MaxInputBytes
+	if maxInputBytes <= 0 {
+		maxInputBytes = defaultMaxInputBytes
+	}
+	if int64(len(inputYAML)) > maxInputBytes {
+		return nil, false, fmt.Errorf("rendered input is %d bytes, exceeding max_input_bytes of %d", len(inputYAML), maxInputBytes)
+	}
+
+	var cache *nodeCache
+	if node.Cache != nil {
+		if cache, err = e.resolveNodeCache(node, inputYAML, templateCtx); err != nil {
+			return nil, false, err
+		}
+		entry, err := cache.lookup()
+		if err != nil {
+			e.Logger.Printf("Cache lookup for node %s failed: %v %s", node.ID, err, statusWARN)
+		} else if entry != nil {
+			cacheHits.WithLabelValues(node.Type).Inc()
+			e.Logger.Printf("Cache hit for node %s (key %s, stored by run %s, expires %s) %s", node.ID, cache.key[:12], entry.RunID, entry.ExpiresAt, statusINFO)
+			return entry.Output, true, nil
+		}
+		cacheMisses.WithLabelValues(node.Type).Inc()
+		e.Logger.Printf("Cache miss for node %s (key %s) %s", node.ID, cache.key[:12], statusINFO)
+	}
+
+	req, err := e.newActionRequest(node, templateCtx, permissions)
+	if err != nil {
+		return nil, false, err
+	}
+	req.Input = inputYAML
+
+	e.Logger.Printf("Sending to action: %s", string(inputYAML))
+
+	output, err := e.Runner.RunAction(ctx, req)
+	if err != nil {
+		return nil, false, err
+	}
+	if output, err = coerceActionOutput(node.Type, manifest.Output, output); err != nil {
+		return nil, false, err
+	}
+
+	if cache != nil {
+		if err := cache.store(node, templateCtx.Run.ID, output); err != nil {
+			e.Logger.Printf("%v %s", err, statusWARN)
+		}
+	}
+	return output, false, nil
+}
+
+// renderNodeInput resolves templates in a node's input, checks it against
+// the action's input schema, if any, and marshals it to YAML
+func renderNodeInput(ctx context.Context, node NodeV1, templateCtx *TemplateContext, schema *Schema) (inputYAML []byte, err error) {
+	_, span := tracer.Start(ctx, "template.resolve")
+	defer func() { endSpan(span, err) }()
+
+	// Resolve templates in the input
+	resolvedInput, err := resolveTemplates(node.InputsFromWorkflow, templateCtx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve templates: %w", err)
+	}
+
+	// Templated values become the types the action declares
+	if resolvedInput, err = coerceActionInput(node.Type, schema, resolvedInput); err != nil {
+		return nil, err
+	}
+
+	// Convert resolved input to YAML
+	inputYAML, err = yaml.Marshal(resolvedInput)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal input YAML: %w", err)
+	}
+	span.SetAttributes(attribute.Int("octa.input.bytes", len(inputYAML)))
+	return inputYAML, nil
+}
+
+// resolveTemplates processes templates and expressions in the input data
+func resolveTemplates(input map[string]interface{}, templateCtx *TemplateContext) (map[string]interface{}, error) {
+	// Expressions are set aside while the Go templates, which cannot parse
+	// them, are executed
+	extracted, sources, err := extractExpressions(input, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert input to YAML and back to handle nested structures
+	inputYAML, err := yaml.Marshal(extracted)
+	if err != nil {
+		return nil, err
+	}
+
+	// Apply template processing to the YAML string
+	tmpl, err := template.New("input").Parse(string(inputYAML))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, templateCtx); err != nil {
+		return nil, fmt.Errorf("failed to execute template: %w", err)
+	}
+
+	// Parse the resolved YAML back
+	var resolved map[string]interface{}
+	if err := yaml.Unmarshal(buf.Bytes(), &resolved); err != nil {
+		return nil, fmt.Errorf("failed to parse resolved YAML: %w", err)
+	}
+	if len(sources) == 0 {
+		return resolved, nil
+	}
+
+	values, err := exprValues(templateCtx)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]interface{}, len(sources))
+	for i, source := range sources {
+		if results[i], err = evalExpression(source, values); err != nil {
+			return nil, fmt.Errorf("failed to evaluate ${{ %s }}: %w", source, err)
+		}
+	}
+	return substituteExpressions(resolved, results).(map[string]interface{}), nil
+}
@@ -0,0 +1,246 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/yaml.v3"
+)
+
+// ActionRunner executes action nodes. Replace the engine's runner to run
+// actions elsewhere than in local processes, or to stub them out.
+type ActionRunner interface {
+	// RunAction runs an action with the request's YAML input and returns its
+	// parsed YAML output. It must stop the action once ctx is done.
+	RunAction(ctx context.Context, req ActionRequest) (map[string]interface{}, error)
+}
+
+// ActionRequest is one invocation of an action
+type ActionRequest struct {
+	RunID          string // Empty outside of runs, e.g. for triggers
+	NodeID         string
+	Type           string   // Action type, e.g. echo-json
+	Path           string   // Action binary, in the engine's ActionDir
+	Input          []byte   // Rendered YAML input
+	Env            []string // nil inherits the engine's environment
+	Dir            string   // empty uses the engine's working directory
+	MaxOutputBytes int64
+	TruncateOutput bool             // truncate instead of failing when stdout exceeds the limit
+	SandboxPolicy  *SandboxPolicyV1 // nil runs the action unsandboxed
+	Worker         *WorkerV1        // From the action's manifest; nil starts a process per request
+	Logger         Logger           // The engine's Logger; nil uses the runner's
+	GracePeriod    time.Duration    // The engine's GracePeriod; zero uses the runner's
+
+	sandbox *sandboxSpec // SandboxPolicy resolved for this invocation
+}
+
+// logger returns the logger for the request's messages. The engine sets it
+// on every request, so that changing its Logger after New reaches the runners.
+func (req ActionRequest) logger(fallback Logger) Logger {
+	switch {
+	case req.Logger != nil:
+		return req.Logger
+	case fallback != nil:
+		return fallback
+	}
+	return log.Default()
+}
+
+// gracePeriod returns how long the action may take to exit once signalled
+func (req ActionRequest) gracePeriod(fallback time.Duration) time.Duration {
+	if req.GracePeriod > 0 {
+		return req.GracePeriod
+	}
+	return fallback
+}
+
+// ActionError represents an error response from an action
+type ActionError struct {
+	Error           string                 `yaml:"error"`
+	OriginalRequest map[string]interface{} `yaml:"original_request,omitempty"`
+}
+
+// ProcessRunner is the default ActionRunner. It spawns the action binary,
+// feeds it the input YAML on stdin and parses its stdout. Actions whose
+// manifest declares a worker are instead started once and sent their
+// requests as frames; Close stops those workers.
+type ProcessRunner struct {
+	Logger      Logger
+	GracePeriod time.Duration // How long a signalled action may take to exit before it is killed
+
+	workersMu sync.Mutex
+	workers   map[string]*actionWorker
+	starting  map[string]workerStart   // Workers whose hello frame is awaited
+	backoff   map[string]workerBackoff // Actions run per request after their worker failed to start
+}
+
+// RunAction runs the action in its own process group; when ctx is cancelled
+// the received signal is forwarded to the group, which is killed if it is
+// still running after the grace period.
+func (r *ProcessRunner) RunAction(ctx context.Context, req ActionRequest) (map[string]interface{}, error) {
+	logger := req.logger(r.Logger)
+	grace := req.gracePeriod(r.GracePeriod)
+
+	// Sandboxes confine a single invocation, so sandboxed nodes never share
+	// a worker
+	if req.Worker != nil && req.SandboxPolicy == nil {
+		output, err := r.runOnWorker(ctx, logger, req)
+		if !errors.Is(err, errWorkerUnavailable) {
+			return output, err
+		}
+	}
+
+	// The process span covers the action from spawn to exit; its context is
+	// handed to the action as TRACEPARENT
+	spawnCtx, spawnSpan := tracer.Start(ctx, "process.spawn", trace.WithAttributes(
+		attrActionType.String(req.Type),
+		attribute.String("process.executable.path", req.Path),
+	))
+
+	// Execute the action binary
+	cmd := exec.Command(req.Path)
+	cmd.Stdin = bytes.NewReader(req.Input)
+	cmd.Env = withTraceEnv(spawnCtx, req.Env)
+	cmd.Dir = req.Dir
+	setProcessGroup(cmd)
+
+	if req.sandbox != nil {
+		if err := configureSandbox(cmd, req.SandboxPolicy, req.sandbox); err != nil {
+			endSpan(spawnSpan, err)
+			return nil, fmt.Errorf("failed to sandbox action: %w", err)
+		}
+	}
+
+	// Capture stdout and stderr separately, bounded so that a runaway action
+	// cannot exhaust the orchestrator's memory
+	stdout := &limitedBuffer{limit: req.MaxOutputBytes}
+	stderr := &limitedBuffer{limit: maxStderrBytes}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if !req.TruncateOutput {
+		stdout.onExceed = func() {
+			logger.Printf("Action %s exceeded max_output_bytes (%d), killing it %s", req.Type, req.MaxOutputBytes, statusFAILED)
+			signalProcessGroup(cmd, syscall.SIGKILL)
+		}
+	}
+
+	if err := cmd.Start(); err != nil {
+		endSpan(spawnSpan, err)
+		return nil, fmt.Errorf("action failed to start: %w", err)
+	}
+	spawnSpan.SetAttributes(attrPID.Int(cmd.Process.Pid))
+
+	exited := make(chan struct{})
+	go func() {
+		select {
+		case <-exited:
+		case <-ctx.Done():
+			sig := forwardedSignal(ctx)
+			logger.Printf("Forwarding %s to action %s (pid %d) %s", sig, req.Type, cmd.Process.Pid, statusWARN)
+			signalProcessGroup(cmd, sig)
+
+			select {
+			case <-exited:
+			case <-time.After(grace):
+				logger.Printf("Action %s did not exit within %s, killing it %s", req.Type, grace, statusWARN)
+				signalProcessGroup(cmd, syscall.SIGKILL)
+			}
+		}
+	}()
+
+	err := cmd.Wait()
+	close(exited)
+
+	exitCode := cmd.ProcessState.ExitCode()
+	spawnSpan.SetAttributes(attrExitCode.Int(exitCode))
+	trace.SpanFromContext(ctx).SetAttributes(attrExitCode.Int(exitCode))
+	endSpan(spawnSpan, err)
+
+	if ctx.Err() != nil {
+		if stderr.Len() > 0 {
+			logger.Printf("Action stderr output: %s %s", stderr.String(), statusWARN)
+		}
+		return nil, fmt.Errorf("action cancelled: %w", context.Cause(ctx))
+	}
+
+	if stdout.Exceeded() && !req.TruncateOutput {
+		return nil, fmt.Errorf("action output exceeded max_output_bytes of %d bytes", req.MaxOutputBytes)
+	}
+
+	if err != nil {
+		// Log stderr for debugging
+		if stderr.Len() > 0 {
+			// Update the stderr capture message
+			logger.Printf("Action stderr output: %s %s", stderr.String(), statusWARN)
+		}
+
+		// Failing actions usually still report why on stdout
+		var failure ActionError
+		if yaml.Unmarshal(stdout.Bytes(), &failure) == nil && failure.Error != "" {
+			return nil, fmt.Errorf("action failed: %w: %s", err, failure.Error)
+		}
+		return nil, fmt.Errorf("action failed: %w", err)
+	}
+
+	if stderr.Exceeded() {
+		logger.Printf("Action stderr truncated to %d bytes %s", maxStderrBytes, statusWARN)
+	}
+
+	// Log stderr if present (for debugging)
+	if stderr.Len() > 0 {
+		logger.Printf("Action stderr: %s %s", stderr.String(), statusINFO)
+	}
+
+	return parseActionOutput(ctx, logger, req, stdout.Bytes(), stdout.Exceeded())
+}
+
+// limitOutput applies the request's MaxOutputBytes to the output of an
+// action that was not bounded while it was produced, truncating it if the
+// request allows it
+func limitOutput(req ActionRequest, data []byte) ([]byte, bool, error) {
+	if int64(len(data)) <= req.MaxOutputBytes {
+		return data, false, nil
+	}
+	if !req.TruncateOutput {
+		return nil, true, fmt.Errorf("action output exceeded max_output_bytes of %d bytes", req.MaxOutputBytes)
+	}
+	return data[:req.MaxOutputBytes], true, nil
+}
+
+// parseActionOutput parses the YAML output of an action, which was truncated
+// at the request's MaxOutputBytes if exceeded is set
+func parseActionOutput(ctx context.Context, logger Logger, req ActionRequest, data []byte, exceeded bool) (map[string]interface{}, error) {
+	if exceeded {
+		logger.Printf("Action output truncated to max_output_bytes of %d bytes %s", req.MaxOutputBytes, statusWARN)
+	}
+
+	// Parse the output YAML
+	_, parseSpan := tracer.Start(ctx, "output.parse", trace.WithAttributes(attribute.Int("octa.output.bytes", len(data))))
+	var output map[string]interface{}
+	err := yaml.Unmarshal(data, &output)
+	endSpan(parseSpan, err)
+	if err != nil {
+		if exceeded {
+			return nil, fmt.Errorf("action output was truncated at %d bytes and is no longer valid YAML: %w", req.MaxOutputBytes, err)
+		}
+		return nil, fmt.Errorf("failed to parse action output YAML: %w", err)
+	}
+
+	// Check for error in the output
+	if errorMsg, exists := output["error"]; exists {
+		return nil, fmt.Errorf("action returned error: %v", errorMsg)
+	}
+
+	logger.Printf("Action output: %s %s", data, statusINFO)
+	return output, nil
+}
@@ -0,0 +1,169 @@
+package engine
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// Run statuses recorded in run history
+const (
+	RunRunning   = "running"
+	RunSucceeded = "succeeded"
+	RunFailed    = "failed"
+	RunCancelled = "cancelled"
+	RunWaiting   = "waiting" // Suspended at a wait node until resumed
+)
+
+// Node statuses recorded in run history
+const (
+	NodeSucceeded = "succeeded"
+	NodeFailed    = "failed"
+	NodeCancelled = "cancelled"
+	NodeWaiting   = "waiting"
+	NodeSkipped   = "skipped" // On a switch branch not taken
+)
+
+// RunRecord is the persisted history entry of one workflow run
+type RunRecord struct {
+	ID            string                 `yaml:"id"`
+	Workflow      string                 `yaml:"workflow"`
+	Status        string                 `yaml:"status"`
+	StartedAt     string                 `yaml:"started_at"`
+	FinishedAt    string                 `yaml:"finished_at,omitempty"`
+	Error         string                 `yaml:"error,omitempty"`
+	Matrix        map[string]interface{} `yaml:"matrix,omitempty"` // Values of the matrix combination the run belongs to
+	Nodes         []NodeRecord           `yaml:"nodes,omitempty"`
+	Compensations []NodeRecord           `yaml:"compensations,omitempty"` // Run after the run failed, latest node first
+	Artifacts     []ArtifactRecord       `yaml:"artifacts,omitempty"`
+
+	engine *Engine // Persists the record and reports failures to do so
+}
+
+// NodeRecord is the history entry of one executed node
+type NodeRecord struct {
+	ID         string `yaml:"id"`
+	Type       string `yaml:"type"`
+	Status     string `yaml:"status"`
+	StartedAt  string `yaml:"started_at"`
+	DurationMs int64  `yaml:"duration_ms"`
+	Cached     bool   `yaml:"cached,omitempty"` // Output was reused from the cache
+	Error      string `yaml:"error,omitempty"`
+}
+
+// RunInfo exposes the current run to templates as {{.Run}}
+type RunInfo struct {
+	ID        string `yaml:"id"`
+	Status    string `yaml:"status"`
+	Error     string `yaml:"error,omitempty"`
+	Workspace string `yaml:"workspace"` // Scratch directory of the run
+}
+
+// newRunRecord creates and persists the record of a run that is starting.
+// matrix holds the values of the matrix combination the run belongs to, if
+// any.
+func (e *Engine) newRunRecord(workflow *WorkflowV1, matrix map[string]interface{}) (*RunRecord, error) {
+	record := &RunRecord{
+		ID:        newRunID(),
+		Workflow:  workflow.Name,
+		Status:    RunRunning,
+		StartedAt: time.Now().UTC().Format(time.RFC3339),
+		Matrix:    matrix,
+		engine:    e,
+	}
+	return record, record.save()
+}
+
+// newRunID returns a sortable, unique run identifier
+func newRunID() string {
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	return time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(suffix)
+}
+
+// runKey returns the key of a file in a run's history
+func runKey(id, name string) string {
+	return path.Join("runs", id, name)
+}
+
+// runDir returns the directory holding a run's workspace and artifacts
+func (e *Engine) runDir(id string) string {
+	return filepath.Join(e.WorkDir, "runs", id)
+}
+
+// LoadRun reads the history entry of a run; a missing run yields nil
+func (e *Engine) LoadRun(id string) (*RunRecord, error) {
+	var record RunRecord
+	if err := e.Store.Read(runKey(id, "run.yaml"), &record); err != nil {
+		return nil, err
+	}
+	if record.ID == "" {
+		return nil, nil
+	}
+	record.engine = e
+	return &record, nil
+}
+
+// save writes the record to the run's history
+func (r *RunRecord) save() error {
+	if err := r.engine.Store.Write(runKey(r.ID, "run.yaml"), r); err != nil {
+		return fmt.Errorf("failed to save run record: %w", err)
+	}
+	return nil
+}
+
+// recordNode appends a node result and persists the record
+func (r *RunRecord) recordNode(node NodeV1, status string, started time.Time, cached bool, err error) {
+	entry := NodeRecord{
+		ID:         node.ID,
+		Type:       node.Type,
+		Status:     status,
+		StartedAt:  started.UTC().Format(time.RFC3339),
+		DurationMs: time.Since(started).Milliseconds(),
+		Cached:     cached,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	r.Nodes = append(r.Nodes, entry)
+	r.saveOrWarn()
+}
+
+// recordCompensation appends the result of a node's compensation and
+// persists the record
+func (r *RunRecord) recordCompensation(step NodeV1, status string, started time.Time, err error) {
+	entry := NodeRecord{
+		ID:         step.ID,
+		Type:       step.Type,
+		Status:     status,
+		StartedAt:  started.UTC().Format(time.RFC3339),
+		DurationMs: time.Since(started).Milliseconds(),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	r.Compensations = append(r.Compensations, entry)
+	r.saveOrWarn()
+}
+
+// finish marks the run as done and persists the record
+func (r *RunRecord) finish(status string, err error) {
+	r.Status = status
+	r.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+	if err != nil {
+		r.Error = err.Error()
+	}
+	r.saveOrWarn()
+}
+
+// saveOrWarn persists the record; history is best effort and never fails a run
+func (r *RunRecord) saveOrWarn() {
+	if err := r.save(); err != nil {
+		r.engine.Logger.Printf("%v %s", err, statusWARN)
+	}
+}
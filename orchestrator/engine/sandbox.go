@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// SandboxPolicyV1 restricts what an action process may do. It can be set per
+// node or as a default in the action's manifest; a node policy replaces the
+// manifest policy as a whole.
+type SandboxPolicyV1 struct {
+	Filesystem *SandboxFilesystemV1 `yaml:"filesystem,omitempty"` // Omit to leave the filesystem unrestricted
+	Network    *bool                `yaml:"network,omitempty"`    // Default: false (own network namespace)
+	RLimits    SandboxRLimitsV1     `yaml:"rlimits,omitempty"`
+	Seccomp    string               `yaml:"seccomp,omitempty"` // default (default), no-network, or none
+	UID        *int                 `yaml:"uid,omitempty"`     // Run as this uid (requires root)
+	GID        *int                 `yaml:"gid,omitempty"`     // Run as this gid (requires root; default: uid)
+}
+
+// SandboxFilesystemV1 lists the paths an action may access. Everything else
+// is denied. Paths are templated and must exist.
+type SandboxFilesystemV1 struct {
+	Read  []string `yaml:"read,omitempty"`  // Read and execute
+	Write []string `yaml:"write,omitempty"` // Read, write, create and delete
+}
+
+// SandboxRLimitsV1 are resource limits applied to the action process; zero
+// means unlimited
+type SandboxRLimitsV1 struct {
+	CPUSeconds    uint64 `yaml:"cpu_seconds,omitempty"`  // Run time for WebAssembly actions and scripts
+	MemoryBytes   uint64 `yaml:"memory_bytes,omitempty"` // Address space, linear memory for WebAssembly actions, allocations for scripts
+	FileSizeBytes uint64 `yaml:"file_size_bytes,omitempty"`
+	Processes     uint64 `yaml:"processes,omitempty"` // Per uid; not enforced for root
+	OpenFiles     uint64 `yaml:"open_files,omitempty"`
+	Fuel          uint64 `yaml:"fuel,omitempty"` // Function calls of WebAssembly actions, execution steps of scripts
+}
+
+// sandboxSpec is the resolved policy handed to the sandbox helper process
+type sandboxSpec struct {
+	ActionPath string           `yaml:"action_path"`
+	Read       []string         `yaml:"read,omitempty"`
+	Write      []string         `yaml:"write,omitempty"`
+	Restrict   bool             `yaml:"restrict_filesystem"`
+	RLimits    SandboxRLimitsV1 `yaml:"rlimits"`
+	Seccomp    string           `yaml:"seccomp"`
+}
+
+// sandboxEnvVar carries the sandboxSpec from the orchestrator to its helper
+const sandboxEnvVar = "OCTA_SANDBOX_SPEC"
+
+// SandboxHelperArg is the hidden subcommand that applies a sandbox and execs
+// the action. Sandboxed actions are started by re-executing the running
+// binary with it, so programs embedding the engine must call RunSandboxHelper
+// when it is their first argument.
+const SandboxHelperArg = "__sandbox-exec"
+
+// seccompPresets are the accepted seccomp preset names
+var seccompPresets = map[string]bool{"default": true, "no-network": true, "none": true}
+
+// networkAllowed reports whether the policy keeps the host network
+func (p *SandboxPolicyV1) networkAllowed() bool {
+	return p.Network != nil && *p.Network
+}
+
+// resolveSandboxSpec validates a policy and resolves templates in its paths
+func resolveSandboxSpec(policy *SandboxPolicyV1, actionPath string, templateCtx *TemplateContext) (*sandboxSpec, error) {
+	spec := &sandboxSpec{
+		ActionPath: actionPath,
+		RLimits:    policy.RLimits,
+		Seccomp:    policy.Seccomp,
+	}
+	if spec.Seccomp == "" {
+		spec.Seccomp = "default"
+	}
+	if !seccompPresets[spec.Seccomp] {
+		return nil, fmt.Errorf("unknown seccomp preset %q (must be one of: default, no-network, none)", spec.Seccomp)
+	}
+
+	if policy.Filesystem != nil {
+		spec.Restrict = true
+
+		var err error
+		if spec.Read, err = resolveSandboxPaths(policy.Filesystem.Read, templateCtx); err != nil {
+			return nil, err
+		}
+		if spec.Write, err = resolveSandboxPaths(policy.Filesystem.Write, templateCtx); err != nil {
+			return nil, err
+		}
+	}
+
+	return spec, nil
+}
+
+// resolveSandboxPaths resolves templates in paths and makes them absolute
+func resolveSandboxPaths(paths []string, templateCtx *TemplateContext) ([]string, error) {
+	var resolved []string
+	for _, path := range paths {
+		value, err := resolveTemplateString(path, templateCtx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve sandbox path %s: %w", path, err)
+		}
+		abs, err := filepath.Abs(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sandbox path %s: %w", value, err)
+		}
+		resolved = append(resolved, abs)
+	}
+	return resolved, nil
+}
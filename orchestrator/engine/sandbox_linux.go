@@ -0,0 +1,295 @@
+//go:build linux
+
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+	"gopkg.in/yaml.v3"
+)
+
+// configureSandbox rewrites cmd so that it starts the sandbox helper, which
+// applies the spec and then execs the action. Namespaces and credentials are
+// set up by the kernel when the helper is cloned; everything else is applied
+// by the helper itself.
+func configureSandbox(cmd *exec.Cmd, policy *SandboxPolicyV1, spec *sandboxSpec) error {
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate orchestrator for sandbox helper: %w", err)
+	}
+
+	specYAML, err := yaml.Marshal(spec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal sandbox spec: %w", err)
+	}
+
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	cmd.Env = append(env[:len(env):len(env)], sandboxEnvVar+"="+string(specYAML))
+	cmd.Path = self
+	cmd.Args = []string{self, SandboxHelperArg}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	attr := cmd.SysProcAttr
+	attr.Pdeathsig = syscall.SIGKILL
+
+	uid, gid := os.Getuid(), os.Getgid()
+	if policy.UID != nil {
+		if uid != 0 && *policy.UID != uid {
+			return fmt.Errorf("sandbox uid %d requires the orchestrator to run as root", *policy.UID)
+		}
+		targetGID := *policy.UID
+		if policy.GID != nil {
+			targetGID = *policy.GID
+		}
+		attr.Credential = &syscall.Credential{Uid: uint32(*policy.UID), Gid: uint32(targetGID)}
+	} else if policy.GID != nil {
+		return fmt.Errorf("sandbox gid requires uid to be set")
+	}
+
+	if !policy.networkAllowed() {
+		attr.Cloneflags |= syscall.CLONE_NEWNET
+		if uid != 0 {
+			// Unprivileged users may only create a network namespace inside a
+			// user namespace of their own; map them to themselves in it
+			attr.Cloneflags |= syscall.CLONE_NEWUSER
+			attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: uid, HostID: uid, Size: 1}}
+			attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: gid, HostID: gid, Size: 1}}
+			attr.GidMappingsEnableSetgroups = false
+		}
+	}
+
+	return nil
+}
+
+// RunSandboxHelper is the entry point of the sandbox helper process. It reads
+// the spec from the environment, locks itself down and replaces itself with
+// the action. It only returns by exiting.
+func RunSandboxHelper() {
+	log.SetFlags(0)
+	log.SetPrefix("sandbox: ")
+
+	var spec sandboxSpec
+	if err := yaml.Unmarshal([]byte(os.Getenv(sandboxEnvVar)), &spec); err != nil || spec.ActionPath == "" {
+		log.Fatalf("invalid sandbox spec: %v", err)
+	}
+
+	env := make([]string, 0, len(os.Environ()))
+	for _, entry := range os.Environ() {
+		if !strings.HasPrefix(entry, sandboxEnvVar+"=") {
+			env = append(env, entry)
+		}
+	}
+
+	// Landlock and seccomp apply to the calling thread and survive execve, so
+	// everything must happen on the thread that finally calls execve
+	runtime.LockOSThread()
+
+	if err := applyRLimits(spec.RLimits); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		log.Fatalf("failed to set no_new_privs: %v", err)
+	}
+	if spec.Restrict {
+		if err := applyLandlock(spec); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	if spec.Seccomp != "none" {
+		if err := applySeccomp(spec.Seccomp); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+
+	err := syscall.Exec(spec.ActionPath, []string{spec.ActionPath}, env)
+	log.Fatalf("failed to exec %s: %v", spec.ActionPath, err)
+}
+
+// applyRLimits sets the non-zero resource limits on the current process
+func applyRLimits(limits SandboxRLimitsV1) error {
+	for _, limit := range []struct {
+		name     string
+		resource int
+		value    uint64
+	}{
+		{"cpu_seconds", unix.RLIMIT_CPU, limits.CPUSeconds},
+		{"memory_bytes", unix.RLIMIT_AS, limits.MemoryBytes},
+		{"file_size_bytes", unix.RLIMIT_FSIZE, limits.FileSizeBytes},
+		{"processes", unix.RLIMIT_NPROC, limits.Processes},
+		{"open_files", unix.RLIMIT_NOFILE, limits.OpenFiles},
+	} {
+		if limit.value == 0 {
+			continue
+		}
+		rlimit := &unix.Rlimit{Cur: limit.value, Max: limit.value}
+		if err := unix.Setrlimit(limit.resource, rlimit); err != nil {
+			return fmt.Errorf("failed to set rlimit %s: %w", limit.name, err)
+		}
+	}
+	return nil
+}
+
+// Landlock access rights granted on read-only and writable paths (ABI 1)
+const (
+	landlockReadFile = unix.LANDLOCK_ACCESS_FS_EXECUTE | unix.LANDLOCK_ACCESS_FS_READ_FILE
+	landlockRead     = landlockReadFile | unix.LANDLOCK_ACCESS_FS_READ_DIR
+	landlockWrite    = landlockRead | unix.LANDLOCK_ACCESS_FS_WRITE_FILE |
+		unix.LANDLOCK_ACCESS_FS_REMOVE_DIR | unix.LANDLOCK_ACCESS_FS_REMOVE_FILE |
+		unix.LANDLOCK_ACCESS_FS_MAKE_CHAR | unix.LANDLOCK_ACCESS_FS_MAKE_DIR |
+		unix.LANDLOCK_ACCESS_FS_MAKE_REG | unix.LANDLOCK_ACCESS_FS_MAKE_SOCK |
+		unix.LANDLOCK_ACCESS_FS_MAKE_FIFO | unix.LANDLOCK_ACCESS_FS_MAKE_BLOCK |
+		unix.LANDLOCK_ACCESS_FS_MAKE_SYM
+	landlockFileRights = unix.LANDLOCK_ACCESS_FS_EXECUTE | unix.LANDLOCK_ACCESS_FS_READ_FILE |
+		unix.LANDLOCK_ACCESS_FS_WRITE_FILE | unix.LANDLOCK_ACCESS_FS_TRUNCATE
+)
+
+// landlockABI returns the Landlock ABI version supported by the kernel, or 0
+func landlockABI() int {
+	abi, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, 0, 0, unix.LANDLOCK_CREATE_RULESET_VERSION)
+	if errno != 0 {
+		return 0
+	}
+	return int(abi)
+}
+
+// landlockSystemPaths are always readable so that dynamically linked actions
+// can load their interpreter and shared libraries; missing ones are skipped
+var landlockSystemPaths = []string{"/lib", "/lib64", "/usr/lib", "/usr/lib64"}
+
+// applyLandlock restricts filesystem access to the spec's allowlists. The
+// action binary, system libraries and a few device files are always readable.
+func applyLandlock(spec sandboxSpec) error {
+	abi := landlockABI()
+	if abi < 1 {
+		return errors.New("filesystem sandboxing needs Landlock, which this kernel does not provide")
+	}
+
+	handled := uint64(landlockWrite)
+	write := uint64(landlockWrite)
+	if abi >= 2 {
+		handled |= unix.LANDLOCK_ACCESS_FS_REFER
+		write |= unix.LANDLOCK_ACCESS_FS_REFER
+	}
+	if abi >= 3 {
+		handled |= unix.LANDLOCK_ACCESS_FS_TRUNCATE
+		write |= unix.LANDLOCK_ACCESS_FS_TRUNCATE
+	}
+
+	attr := unix.LandlockRulesetAttr{Access_fs: handled}
+	fd, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return fmt.Errorf("failed to create landlock ruleset: %w", errno)
+	}
+	ruleset := int(fd)
+	defer unix.Close(ruleset)
+
+	rules := []struct {
+		path   string
+		access uint64
+	}{
+		{spec.ActionPath, landlockReadFile},
+		{"/dev/null", landlockReadFile | unix.LANDLOCK_ACCESS_FS_WRITE_FILE},
+		{"/dev/urandom", landlockReadFile},
+	}
+	for _, path := range landlockSystemPaths {
+		if _, err := os.Stat(path); err == nil {
+			rules = append(rules, struct {
+				path   string
+				access uint64
+			}{path, landlockRead})
+		}
+	}
+	for _, path := range spec.Read {
+		rules = append(rules, struct {
+			path   string
+			access uint64
+		}{path, landlockRead})
+	}
+	for _, path := range spec.Write {
+		rules = append(rules, struct {
+			path   string
+			access uint64
+		}{path, write})
+	}
+
+	for _, rule := range rules {
+		if err := addLandlockRule(ruleset, rule.path, rule.access&handled); err != nil {
+			return err
+		}
+	}
+
+	if _, _, errno := unix.Syscall(unix.SYS_LANDLOCK_RESTRICT_SELF, uintptr(ruleset), 0, 0); errno != 0 {
+		return fmt.Errorf("failed to enforce landlock ruleset: %w", errno)
+	}
+	return nil
+}
+
+// addLandlockRule allows access beneath path. Rules on regular files may only
+// carry file rights.
+func addLandlockRule(ruleset int, path string, access uint64) error {
+	fd, err := unix.Open(path, unix.O_PATH|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("sandbox path %s is not accessible: %w", path, err)
+	}
+	defer unix.Close(fd)
+
+	var stat unix.Stat_t
+	if err := unix.Fstat(fd, &stat); err != nil {
+		return fmt.Errorf("failed to stat sandbox path %s: %w", path, err)
+	}
+	if stat.Mode&unix.S_IFMT != unix.S_IFDIR {
+		access &= landlockFileRights
+	}
+
+	rule := unix.LandlockPathBeneathAttr{Allowed_access: access, Parent_fd: int32(fd)}
+	if _, _, errno := unix.Syscall6(unix.SYS_LANDLOCK_ADD_RULE, uintptr(ruleset), unix.LANDLOCK_RULE_PATH_BENEATH,
+		uintptr(unsafe.Pointer(&rule)), 0, 0, 0); errno != 0 {
+		return fmt.Errorf("failed to add landlock rule for %s: %w", path, errno)
+	}
+	return nil
+}
+
+// SandboxCheck reports which sandbox features this host supports
+func SandboxCheck() {
+	fmt.Printf("uid: %d\n", os.Getuid())
+
+	if abi := landlockABI(); abi > 0 {
+		fmt.Printf("landlock: available (ABI %d)\n", abi)
+	} else {
+		fmt.Printf("landlock: unavailable (filesystem allowlists cannot be enforced)\n")
+	}
+
+	if _, err := seccompArch(); err != nil {
+		fmt.Printf("seccomp: unavailable (%v)\n", err)
+	} else if mode, err := unix.PrctlRetInt(unix.PR_GET_SECCOMP, 0, 0, 0, 0); err != nil {
+		fmt.Printf("seccomp: unavailable (%v)\n", err)
+	} else {
+		fmt.Printf("seccomp: available (current mode %d)\n", mode)
+	}
+
+	cmd := exec.Command("/bin/true")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Cloneflags: syscall.CLONE_NEWNET}
+	if os.Getuid() != 0 {
+		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWUSER
+		cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}}
+	}
+	if err := cmd.Run(); err != nil {
+		fmt.Printf("network namespaces: unavailable (%v)\n", err)
+	} else {
+		fmt.Printf("network namespaces: available\n")
+	}
+}
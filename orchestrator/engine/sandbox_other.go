@@ -0,0 +1,26 @@
+//go:build !linux
+
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// configureSandbox fails: sandboxing relies on Linux-only kernel features
+func configureSandbox(cmd *exec.Cmd, policy *SandboxPolicyV1, spec *sandboxSpec) error {
+	return errors.New("sandbox policies are only supported on Linux")
+}
+
+// RunSandboxHelper is never used outside Linux
+func RunSandboxHelper() {
+	fmt.Fprintln(os.Stderr, "sandbox: only supported on Linux")
+	os.Exit(1)
+}
+
+// SandboxCheck reports that no sandbox features are available
+func SandboxCheck() {
+	fmt.Println("sandbox: only supported on Linux")
+}
@@ -0,0 +1,281 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Schema is the subset of JSON Schema that action manifests use to document
+// and check their input and output. Values are coerced to the declared types
+// where that is lossless, so that a templated "200" becomes the integer 200,
+// and missing properties take their defaults.
+type Schema struct {
+	Type                 string             `yaml:"type,omitempty" json:"type,omitempty"` // object, array, string, integer, number, boolean or null; empty allows any
+	Description          string             `yaml:"description,omitempty" json:"description,omitempty"`
+	Properties           map[string]*Schema `yaml:"properties,omitempty" json:"properties,omitempty"`
+	Required             []string           `yaml:"required,omitempty" json:"required,omitempty"`
+	AdditionalProperties *bool              `yaml:"additionalProperties,omitempty" json:"additionalProperties,omitempty"` // Unless false, undeclared properties are kept as they are
+	Items                *Schema            `yaml:"items,omitempty" json:"items,omitempty"`
+	Enum                 []interface{}      `yaml:"enum,omitempty" json:"enum,omitempty"`
+	Default              interface{}        `yaml:"default,omitempty" json:"default,omitempty"`
+	Minimum              *float64           `yaml:"minimum,omitempty" json:"minimum,omitempty"`
+	Maximum              *float64           `yaml:"maximum,omitempty" json:"maximum,omitempty"`
+}
+
+// schemaTypes are the types a Schema can declare
+var schemaTypes = []string{"", "object", "array", "string", "integer", "number", "boolean", "null"}
+
+// check reports the mistakes in a schema itself, such as unknown types
+func (s *Schema) check(path string) []string {
+	if s == nil {
+		return nil
+	}
+	var problems []string
+	if !contains(schemaTypes, s.Type) {
+		problems = append(problems, fmt.Sprintf("%s: unknown type %s", path, s.Type))
+	}
+	for _, name := range s.Required {
+		if _, ok := s.Properties[name]; !ok && s.Properties != nil {
+			problems = append(problems, fmt.Sprintf("%s: required property %s is not declared", path, name))
+		}
+	}
+	for _, name := range s.PropertyNames() {
+		problems = append(problems, s.Properties[name].check(joinSchemaPath(path, name))...)
+	}
+	return append(problems, s.Items.check(path+"[]")...)
+}
+
+// Coerce checks a value against the schema and returns it converted to the
+// declared types, with defaults filled in. Every mismatch is reported, with
+// the path of the mismatching value below name.
+func (s *Schema) Coerce(value interface{}, name string) (interface{}, []string) {
+	var problems []string
+	value = s.coerce(value, name, false, &problems)
+	return value, problems
+}
+
+// checkTemplated checks a node's inputs_from_workflow as written. Strings
+// holding templates or expressions are only known at run time and match any
+// type.
+func (s *Schema) checkTemplated(value interface{}, name string) []string {
+	var problems []string
+	s.coerce(value, name, true, &problems)
+	return problems
+}
+
+// coerce converts value to the schema, appending mismatches to problems
+func (s *Schema) coerce(value interface{}, path string, templated bool, problems *[]string) interface{} {
+	if s == nil {
+		return value
+	}
+	report := func(format string, args ...interface{}) {
+		*problems = append(*problems, path+": "+fmt.Sprintf(format, args...))
+	}
+	if text, ok := value.(string); ok && templated && (strings.Contains(text, "{{") || strings.Contains(text, exprOpen)) {
+		return value
+	}
+
+	switch s.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			report("expected object, got %s", describeValue(value))
+			return value
+		}
+		return s.coerceObject(object, path, templated, problems)
+	case "array":
+		list, ok := value.([]interface{})
+		if !ok {
+			report("expected array, got %s", describeValue(value))
+			return value
+		}
+		result := make([]interface{}, len(list))
+		for i, item := range list {
+			result[i] = s.Items.coerce(item, fmt.Sprintf("%s[%d]", path, i), templated, problems)
+		}
+		value = result
+	case "string":
+		switch v := value.(type) {
+		case string:
+		case int, float64, bool:
+			value = fmt.Sprint(v)
+		default:
+			report("expected string, got %s", describeValue(value))
+			return value
+		}
+	case "integer":
+		n, ok := toInteger(value)
+		if !ok {
+			report("expected integer, got %s", describeValue(value))
+			return value
+		}
+		value = n
+	case "number":
+		n, ok := toNumber(value)
+		if !ok {
+			report("expected number, got %s", describeValue(value))
+			return value
+		}
+		value = n
+	case "boolean":
+		switch v := value.(type) {
+		case bool:
+		case string:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				report("expected boolean, got %s", describeValue(value))
+				return value
+			}
+			value = b
+		default:
+			report("expected boolean, got %s", describeValue(value))
+			return value
+		}
+	case "null":
+		if value != nil {
+			report("expected null, got %s", describeValue(value))
+			return value
+		}
+	default:
+		// Untyped objects still check their declared properties
+		if object, ok := value.(map[string]interface{}); ok && s.Properties != nil {
+			return s.coerceObject(object, path, templated, problems)
+		}
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, allowed := range s.Enum {
+			if fmt.Sprint(allowed) == fmt.Sprint(value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			report("%v is not one of %v", value, s.Enum)
+		}
+	}
+	if n, ok := toNumber(value); ok && s.Type != "string" {
+		f, _ := n.(float64)
+		if i, ok := n.(int); ok {
+			f = float64(i)
+		}
+		if s.Minimum != nil && f < *s.Minimum {
+			report("%v is less than the minimum of %v", value, *s.Minimum)
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			report("%v is greater than the maximum of %v", value, *s.Maximum)
+		}
+	}
+	return value
+}
+
+// coerceObject coerces the properties of an object and fills in defaults
+func (s *Schema) coerceObject(object map[string]interface{}, path string, templated bool, problems *[]string) map[string]interface{} {
+	result := make(map[string]interface{}, len(object))
+	for _, name := range s.Required {
+		if _, ok := object[name]; !ok {
+			*problems = append(*problems, fmt.Sprintf("%s: missing required property %s", path, name))
+		}
+	}
+
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		property, declared := s.Properties[key]
+		if !declared && s.AdditionalProperties != nil && !*s.AdditionalProperties {
+			*problems = append(*problems, fmt.Sprintf("%s: unknown property %s", path, key))
+		}
+		result[key] = property.coerce(object[key], joinSchemaPath(path, key), templated, problems)
+	}
+
+	for _, name := range s.PropertyNames() {
+		if _, ok := result[name]; !ok && s.Properties[name].Default != nil && !templated {
+			result[name] = s.Properties[name].Default
+		}
+	}
+	return result
+}
+
+// PropertyNames returns the declared properties, sorted
+func (s *Schema) PropertyNames() []string {
+	names := make([]string, 0, len(s.Properties))
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Fields returns the properties an object conforming to the schema can have,
+// or nil when it may have others
+func (s *Schema) Fields() []string {
+	if s == nil || len(s.Properties) == 0 || (s.AdditionalProperties != nil && *s.AdditionalProperties) {
+		return nil
+	}
+	return s.PropertyNames()
+}
+
+// toInteger converts numbers without a fraction and numeric strings
+func toInteger(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) <= math.MaxInt64 {
+			return int(v), true
+		}
+	case string:
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// toNumber converts numeric strings, keeping integers as int
+func toNumber(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case int, float64:
+		return v, true
+	case string:
+		if n, ok := toInteger(v); ok {
+			return n, true
+		}
+		if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// describeValue names the type of a value for mismatch reports
+func describeValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return fmt.Sprintf("string %q", v)
+	case bool:
+		return fmt.Sprintf("boolean %v", v)
+	case int, float64:
+		return fmt.Sprintf("number %v", v)
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// joinSchemaPath appends a property name to a path
+func joinSchemaPath(path, name string) string {
+	return path + "." + name
+}
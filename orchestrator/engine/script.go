@@ -0,0 +1,416 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/metrics"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	starjson "go.starlark.net/lib/json"
+	starmath "go.starlark.net/lib/math"
+	startime "go.starlark.net/lib/time"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// scriptNodeType is the built-in node that runs inline Starlark code. The
+// script reads the run through the predeclared inputs (its node's resolved
+// inputs_from_workflow), workflow_data, nodes, vars and run, and item and
+// index in for_each nodes, which are the values expressions see and are
+// frozen, and sets output to a dict that becomes the node's output. The json,
+// math and time modules are available.
+//
+// Scripts have no network access. With a sandbox filesystem policy they can
+// read files under its paths with read_file; otherwise they cannot access the
+// filesystem at all. The sandbox rlimits bound the script: cpu_seconds its
+// run time, memory_bytes the memory it holds and fuel the Starlark
+// execution steps.
+const scriptNodeType = "script"
+
+// Limits of scripts whose sandbox does not set their own
+const (
+	defaultScriptTimeout     = 10 * time.Second
+	defaultScriptMemoryBytes = 256 << 20 // 256 MiB
+)
+
+// scriptHeapInterval is how often the memory a script holds is checked
+const scriptHeapInterval = 5 * time.Millisecond
+
+// scriptFileOptions allows the statements people expect from Python
+var scriptFileOptions = &syntax.FileOptions{
+	Set:             true,
+	While:           true,
+	TopLevelControl: true,
+	GlobalReassign:  true,
+	Recursion:       true,
+}
+
+// scriptGlobals are the names predeclared for every script
+var scriptGlobals = []string{"inputs", "workflow_data", "nodes", "vars", "run", "item", "index", "json", "math", "time", "read_file"}
+
+// compileScript checks a script's syntax and names without running it
+func compileScript(name, src string) error {
+	isPredeclared := func(name string) bool {
+		for _, global := range scriptGlobals {
+			if name == global {
+				return true
+			}
+		}
+		return false
+	}
+	_, _, err := starlark.SourceProgramOptions(scriptFileOptions, name, src, isPredeclared)
+	return err
+}
+
+// executeScript runs a script node and returns the dict it set as output
+func (e *Engine) executeScript(ctx context.Context, node NodeV1, templateCtx *TemplateContext) (output map[string]interface{}, err error) {
+	ctx, span := tracer.Start(ctx, "script.run", trace.WithAttributes(attrNodeID.String(node.ID)))
+	defer func() { endSpan(span, err) }()
+
+	inputs, err := resolveTemplates(node.InputsFromWorkflow, templateCtx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve templates: %w", err)
+	}
+
+	// The script sees the run's data as expressions do
+	values, err := exprValues(templateCtx)
+	if err != nil {
+		return nil, err
+	}
+	values["inputs"] = inputs
+
+	predeclared := starlark.StringDict{
+		"json": starjson.Module,
+		"math": starmath.Module,
+		"time": startime.Module,
+	}
+	for _, name := range []string{"inputs", "workflow_data", "nodes", "vars", "run", "item", "index"} {
+		value, err := toStarlark(values[name])
+		if err != nil {
+			return nil, fmt.Errorf("failed to pass %s to the script: %w", name, err)
+		}
+		value.Freeze()
+		predeclared[name] = value
+	}
+
+	limits := SandboxRLimitsV1{CPUSeconds: uint64(defaultScriptTimeout / time.Second), MemoryBytes: defaultScriptMemoryBytes}
+	if node.Sandbox != nil {
+		if node.Sandbox.RLimits.CPUSeconds > 0 {
+			limits.CPUSeconds = node.Sandbox.RLimits.CPUSeconds
+		}
+		if node.Sandbox.RLimits.MemoryBytes > 0 {
+			limits.MemoryBytes = node.Sandbox.RLimits.MemoryBytes
+		}
+		limits.Fuel = node.Sandbox.RLimits.Fuel
+
+		if node.Sandbox.Filesystem != nil {
+			readFile, err := scriptReadFile(node.Sandbox.Filesystem, templateCtx)
+			if err != nil {
+				return nil, err
+			}
+			predeclared["read_file"] = readFile
+		}
+	}
+	if _, ok := predeclared["read_file"]; !ok {
+		predeclared["read_file"] = starlark.NewBuiltin("read_file", func(*starlark.Thread, *starlark.Builtin, starlark.Tuple, []starlark.Tuple) (starlark.Value, error) {
+			return nil, errors.New("read_file requires a sandbox filesystem policy on the node")
+		})
+	}
+
+	thread := &starlark.Thread{
+		Name: node.ID,
+		Print: func(_ *starlark.Thread, msg string) {
+			e.Logger.Printf("Script %s: %s %s", node.ID, msg, statusINFO)
+		},
+	}
+	if limits.Fuel > 0 {
+		thread.SetMaxExecutionSteps(limits.Fuel)
+	}
+
+	// The first limit hit cancels the script and names the failure
+	var (
+		stopMu  sync.Mutex
+		stopErr error
+	)
+	stop := func(err error) {
+		stopMu.Lock()
+		defer stopMu.Unlock()
+		if stopErr == nil {
+			stopErr = err
+			thread.Cancel(err.Error())
+		}
+	}
+	timer := time.AfterFunc(time.Duration(limits.CPUSeconds)*time.Second, func() {
+		stop(fmt.Errorf("script exceeded cpu_seconds (%d seconds)", limits.CPUSeconds))
+	})
+	defer timer.Stop()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			stop(fmt.Errorf("script cancelled: %w", context.Cause(ctx)))
+		case <-done:
+		}
+	}()
+	go watchScriptMemory(limits.MemoryBytes, done, func() {
+		stop(fmt.Errorf("script exceeded memory_bytes (%d bytes)", limits.MemoryBytes))
+	})
+
+	globals, err := starlark.ExecFileOptions(scriptFileOptions, thread, node.ID+".star", node.Script, predeclared)
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("script cancelled: %w", context.Cause(ctx))
+	}
+	stopMu.Lock()
+	defer stopMu.Unlock()
+	if stopErr != nil {
+		return nil, stopErr
+	}
+	if err != nil && limits.Fuel > 0 && thread.ExecutionSteps() >= limits.Fuel {
+		return nil, fmt.Errorf("script ran out of fuel (fuel %d)", limits.Fuel)
+	}
+	if err != nil {
+		// Name where the script failed rather than its whole backtrace
+		var evalErr *starlark.EvalError
+		if errors.As(err, &evalErr) {
+			for i := range evalErr.CallStack {
+				if pos := evalErr.CallStack.At(i).Pos; pos.Filename() != "<builtin>" {
+					return nil, fmt.Errorf("script failed at %s: %s", pos, evalErr.Msg)
+				}
+			}
+		}
+		return nil, fmt.Errorf("script failed: %w", err)
+	}
+
+	result, ok := globals["output"]
+	if !ok {
+		return nil, errors.New("script did not set output")
+	}
+	if _, ok := result.(*starlark.Dict); !ok {
+		return nil, fmt.Errorf("script output must be a dict, got %s", result.Type())
+	}
+	value, err := fromStarlark(result)
+	if err != nil {
+		return nil, fmt.Errorf("invalid script output: %w", err)
+	}
+	output = value.(map[string]interface{})
+
+	e.Logger.Printf("Script output: %v %s", output, statusINFO)
+	return output, nil
+}
+
+// watchScriptMemory calls exceeded once the heap holds more than limit
+// bytes beyond the live heap of the process when the script started, until
+// done is closed. The heap is sampled including garbage, so when it is over
+// the limit a collection decides whether the memory is still in use. Memory
+// held by concurrent runs counts too, so the limit is approximate.
+func watchScriptMemory(limit uint64, done <-chan struct{}, exceeded func()) {
+	live := []metrics.Sample{{Name: "/gc/heap/live:bytes"}}
+	metrics.Read(live)
+	start := live[0].Value.Uint64()
+
+	heap := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	over := func() bool {
+		metrics.Read(heap)
+		return heap[0].Value.Uint64() > start+limit
+	}
+
+	ticker := time.NewTicker(scriptHeapInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if !over() {
+				continue
+			}
+			runtime.GC()
+			if over() {
+				exceeded()
+				return
+			}
+		}
+	}
+}
+
+// scriptReadFile returns the read_file builtin, reading files under the
+// paths of a sandbox filesystem policy
+func scriptReadFile(policy *SandboxFilesystemV1, templateCtx *TemplateContext) (*starlark.Builtin, error) {
+	var roots []string
+	for _, paths := range [][]string{policy.Read, policy.Write} {
+		resolved, err := resolveSandboxPaths(paths, templateCtx)
+		if err != nil {
+			return nil, err
+		}
+		for _, root := range resolved {
+			// Symlinks are followed before comparing paths
+			if real, err := filepath.EvalSymlinks(root); err == nil {
+				root = real
+			}
+			roots = append(roots, root)
+		}
+	}
+
+	return starlark.NewBuiltin("read_file", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var path string
+		if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "path", &path); err != nil {
+			return nil, err
+		}
+		real, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return nil, fmt.Errorf("read_file: %w", err)
+		}
+		if real, err = filepath.Abs(real); err != nil {
+			return nil, fmt.Errorf("read_file: %w", err)
+		}
+		allowed := false
+		for _, root := range roots {
+			if rel, err := filepath.Rel(root, real); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return nil, fmt.Errorf("read_file: %s is outside the sandbox filesystem policy", path)
+		}
+
+		file, err := os.Open(real)
+		if err != nil {
+			return nil, fmt.Errorf("read_file: %w", err)
+		}
+		defer file.Close()
+		data, err := io.ReadAll(io.LimitReader(file, defaultMaxInputBytes+1))
+		if err != nil {
+			return nil, fmt.Errorf("read_file: %w", err)
+		}
+		if len(data) > defaultMaxInputBytes {
+			return nil, fmt.Errorf("read_file: %s is larger than %d bytes", path, defaultMaxInputBytes)
+		}
+		return starlark.String(data), nil
+	}), nil
+}
+
+// toStarlark converts a value decoded from YAML to a Starlark value
+func toStarlark(value interface{}) (starlark.Value, error) {
+	switch v := value.(type) {
+	case nil:
+		return starlark.None, nil
+	case bool:
+		return starlark.Bool(v), nil
+	case int:
+		return starlark.MakeInt(v), nil
+	case int64:
+		return starlark.MakeInt64(v), nil
+	case uint64:
+		return starlark.MakeUint64(v), nil
+	case float64:
+		return starlark.Float(v), nil
+	case string:
+		return starlark.String(v), nil
+	case []interface{}:
+		elems := make([]starlark.Value, len(v))
+		for i, elem := range v {
+			converted, err := toStarlark(elem)
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = converted
+		}
+		return starlark.NewList(elems), nil
+	case map[string]interface{}:
+		dict := starlark.NewDict(len(v))
+		for key, elem := range v {
+			converted, err := toStarlark(elem)
+			if err != nil {
+				return nil, err
+			}
+			if err := dict.SetKey(starlark.String(key), converted); err != nil {
+				return nil, err
+			}
+		}
+		return dict, nil
+	default:
+		return starlark.String(fmt.Sprint(v)), nil
+	}
+}
+
+// errScriptOutputCycle is returned for an output holding a list or dict that
+// contains itself
+var errScriptOutputCycle = errors.New("script output contains a cycle")
+
+// fromStarlark converts a Starlark value to one that encodes to YAML
+func fromStarlark(value starlark.Value) (interface{}, error) {
+	return fromStarlarkValue(value, make(map[starlark.Value]bool))
+}
+
+// fromStarlarkValue converts a value nested in the lists and dicts of path,
+// which are being converted
+func fromStarlarkValue(value starlark.Value, path map[starlark.Value]bool) (interface{}, error) {
+	switch v := value.(type) {
+	case *starlark.List, *starlark.Dict:
+		if path[v] {
+			return nil, errScriptOutputCycle
+		}
+		path[v] = true
+		defer delete(path, v)
+	}
+
+	switch v := value.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.Bool:
+		return bool(v), nil
+	case starlark.Int:
+		if n, ok := v.Int64(); ok && n >= math.MinInt && n <= math.MaxInt {
+			return int(n), nil
+		}
+		return nil, fmt.Errorf("integer %s is out of range", v)
+	case starlark.Float:
+		return float64(v), nil
+	case starlark.String:
+		return string(v), nil
+	case *starlark.List:
+		return fromStarlarkIterable(v, path)
+	case starlark.Tuple:
+		return fromStarlarkIterable(v, path)
+	case *starlark.Dict:
+		result := make(map[string]interface{}, v.Len())
+		for _, item := range v.Items() {
+			key, ok := item[0].(starlark.String)
+			if !ok {
+				return nil, fmt.Errorf("dict keys must be strings, got %s", item[0].Type())
+			}
+			converted, err := fromStarlarkValue(item[1], path)
+			if err != nil {
+				return nil, err
+			}
+			result[string(key)] = converted
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("unsupported value of type %s", value.Type())
+	}
+}
+
+// fromStarlarkIterable converts a list or tuple
+func fromStarlarkIterable(iterable starlark.Indexable, path map[starlark.Value]bool) ([]interface{}, error) {
+	result := make([]interface{}, iterable.Len())
+	for i := range result {
+		converted, err := fromStarlarkValue(iterable.Index(i), path)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = converted
+	}
+	return result, nil
+}
@@ -0,0 +1,126 @@
+//go:build linux
+
+package engine
+
+import (
+	"fmt"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Seccomp filter return actions (linux/seccomp.h)
+const (
+	seccompRetKillProcess = 0x80000000
+	seccompRetErrno       = 0x00050000
+	seccompRetAllow       = 0x7fff0000
+)
+
+// seccompDenied are syscalls refused by every seccomp preset: kernel and
+// mount administration, namespace games, tracing other processes and the
+// keyring. None of them are needed by ordinary actions.
+var seccompDenied = []uintptr{
+	unix.SYS_ACCT,
+	unix.SYS_ADD_KEY,
+	unix.SYS_BPF,
+	unix.SYS_CLOCK_SETTIME,
+	unix.SYS_DELETE_MODULE,
+	unix.SYS_FINIT_MODULE,
+	unix.SYS_INIT_MODULE,
+	unix.SYS_KEXEC_FILE_LOAD,
+	unix.SYS_KEXEC_LOAD,
+	unix.SYS_KEYCTL,
+	unix.SYS_MOUNT,
+	unix.SYS_OPEN_BY_HANDLE_AT,
+	unix.SYS_PERF_EVENT_OPEN,
+	unix.SYS_PIVOT_ROOT,
+	unix.SYS_PROCESS_VM_READV,
+	unix.SYS_PROCESS_VM_WRITEV,
+	unix.SYS_PTRACE,
+	unix.SYS_QUOTACTL,
+	unix.SYS_REBOOT,
+	unix.SYS_REQUEST_KEY,
+	unix.SYS_SETNS,
+	unix.SYS_SETTIMEOFDAY,
+	unix.SYS_SWAPOFF,
+	unix.SYS_SWAPON,
+	unix.SYS_UMOUNT2,
+	unix.SYS_UNSHARE,
+	unix.SYS_USERFAULTFD,
+}
+
+// seccompArch returns the audit architecture seccomp filters are built for
+func seccompArch() (uint32, error) {
+	switch runtime.GOARCH {
+	case "amd64":
+		return unix.AUDIT_ARCH_X86_64, nil
+	case "arm64":
+		return unix.AUDIT_ARCH_AARCH64, nil
+	default:
+		return 0, fmt.Errorf("seccomp presets are not available on %s", runtime.GOARCH)
+	}
+}
+
+// applySeccomp installs the filter of a preset on the calling thread. Denied
+// syscalls fail with EPERM; the no-network preset additionally refuses to
+// create sockets other than Unix domain sockets.
+func applySeccomp(preset string) error {
+	arch, err := seccompArch()
+	if err != nil {
+		return err
+	}
+
+	const (
+		offsetNr   = 0
+		offsetArch = 4
+		offsetArg0 = 16 // Low 32 bits of args[0] on little-endian architectures
+		retErrno   = seccompRetErrno | uint32(unix.EPERM)
+	)
+
+	stmt := func(code uint16, k uint32) unix.SockFilter {
+		return unix.SockFilter{Code: code, K: k}
+	}
+	jump := func(code uint16, k uint32, jt, jf uint8) unix.SockFilter {
+		return unix.SockFilter{Code: code, K: k, Jt: jt, Jf: jf}
+	}
+
+	program := []unix.SockFilter{
+		// Kill anything not using the native syscall ABI
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offsetArch),
+		jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, arch, 1, 0),
+		stmt(unix.BPF_RET|unix.BPF_K, seccompRetKillProcess),
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offsetNr),
+	}
+	if runtime.GOARCH == "amd64" {
+		// The x32 ABI shares the x86_64 audit arch but sets this bit
+		program = append(program,
+			jump(unix.BPF_JMP|unix.BPF_JGE|unix.BPF_K, 0x40000000, 0, 1),
+			stmt(unix.BPF_RET|unix.BPF_K, seccompRetKillProcess),
+		)
+	}
+
+	for _, nr := range seccompDenied {
+		program = append(program,
+			jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, uint32(nr), 0, 1),
+			stmt(unix.BPF_RET|unix.BPF_K, retErrno),
+		)
+	}
+
+	if preset == "no-network" {
+		program = append(program,
+			jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, uint32(unix.SYS_SOCKET), 0, 3),
+			stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offsetArg0),
+			jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, unix.AF_UNIX, 1, 0),
+			stmt(unix.BPF_RET|unix.BPF_K, retErrno),
+		)
+	}
+
+	program = append(program, stmt(unix.BPF_RET|unix.BPF_K, seccompRetAllow))
+
+	fprog := unix.SockFprog{Len: uint16(len(program)), Filter: &program[0]}
+	if err := unix.Prctl(unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER, uintptr(unsafe.Pointer(&fprog)), 0, 0); err != nil {
+		return fmt.Errorf("failed to install seccomp filter: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// StateStore persists the state of runs: run history, approvals, suspended
+// runs, delivered events and cached node outputs. Keys are slash-separated
+// paths such as runs/<run-id>/run.yaml; values are stored as YAML.
+type StateStore interface {
+	// Read loads the value stored under key into v. A missing key is not an
+	// error and leaves v untouched.
+	Read(key string, v interface{}) error
+
+	// Write stores v under key, replacing any previous value atomically
+	Write(key string, v interface{}) error
+
+	// Create stores v under key unless the key exists, in which case it fails
+	// with an error matching fs.ErrExist. Of concurrent calls only one succeeds.
+	Create(key string, v interface{}) error
+
+	// Delete removes key; a missing key is not an error
+	Delete(key string) error
+
+	// List returns the keys matching a path.Match pattern, in lexical order
+	List(pattern string) ([]string, error)
+
+	// Lock takes an exclusive lock named key without waiting. The lock is
+	// released by the returned function.
+	Lock(key string) (func(), error)
+}
+
+// FileStore is the StateStore keeping each key in a YAML file under Dir. It is
+// shared safely by concurrent processes, so runs can be resumed and approved
+// from other processes than the one that started them.
+type FileStore struct {
+	Dir string
+}
+
+// DefaultStateDir returns the directory used for persistent orchestrator
+// state. It can be overridden with the OCTA_STATE_DIR environment variable.
+func DefaultStateDir() string {
+	if dir := os.Getenv("OCTA_STATE_DIR"); dir != "" {
+		return dir
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".octa"
+	}
+	return filepath.Join(home, ".octa")
+}
+
+// path returns the file holding a key
+func (s *FileStore) path(key string) string {
+	return filepath.Join(s.Dir, filepath.FromSlash(key))
+}
+
+// Read loads a YAML state file into v
+func (s *FileStore) Read(key string, v interface{}) error {
+	return readYAMLFile(s.path(key), v)
+}
+
+// Write atomically writes v as YAML, creating parent directories as needed
+func (s *FileStore) Write(key string, v interface{}) error {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a torn file. Its
+	// name is unique, so concurrent writers of a key do not share it.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".write-*")
+	if err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Create writes v to a temporary file and links it into place, so readers
+// never see a partial file and concurrent writers cannot both succeed
+func (s *FileStore) Create(key string, v interface{}) error {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".link-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Link(tmp.Name(), path)
+}
+
+// Delete removes a state file
+func (s *FileStore) Delete(key string) error {
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// List globs the state directory
+func (s *FileStore) List(pattern string) ([]string, error) {
+	matches, err := filepath.Glob(s.path(pattern))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(matches))
+	for _, match := range matches {
+		rel, err := filepath.Rel(s.Dir, match)
+		if err != nil {
+			continue
+		}
+		key := filepath.ToSlash(rel)
+		if strings.HasSuffix(key, ".tmp") || strings.HasPrefix(path.Base(key), ".") {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Lock locks a lock file, which is created if needed
+func (s *FileStore) Lock(key string) (func(), error) {
+	return lockFile(s.path(key))
+}
+
+// readYAMLFile loads a YAML file into v. A missing file is not an error and
+// leaves v untouched.
+func readYAMLFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	if err := yaml.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+	return nil
+}
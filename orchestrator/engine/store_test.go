@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestFileStoreConcurrentWrites(t *testing.T) {
+	store := &FileStore{Dir: t.TempDir()}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- store.Write("runs/run-1.yaml", map[string]int{"writer": i})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Write: %v", err)
+		}
+	}
+
+	var got map[string]int
+	if err := store.Read("runs/run-1.yaml", &got); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got["writer"]; !ok {
+		t.Errorf("Read = %v, want the value of one writer", got)
+	}
+
+	// No temporary file is left behind
+	entries, err := os.ReadDir(store.path("runs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Errorf("state directory holds %v, want only run-1.yaml", names)
+	}
+
+	info, err := os.Stat(store.path("runs/run-1.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0644 {
+		t.Errorf("mode = %v, want %v", mode, os.FileMode(0644))
+	}
+}
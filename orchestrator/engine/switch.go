@@ -0,0 +1,189 @@
+package engine
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// switchNodeType is the built-in node that routes a run to one of several
+// branches. Its on template is matched against the keys of cases, each
+// listing the IDs of the nodes to run for it; default lists the nodes to run
+// when no case matches. Keys containing *, ? or [ are path.Match patterns.
+// An exact match wins over patterns; otherwise every matching pattern is
+// taken.
+//
+// Nodes listed in a switch run only when one of their switches took their
+// branch and are skipped otherwise. A node with needs is skipped when all of
+// the nodes it needs were skipped, so a fan-in node after a switch runs if
+// any of its branches ran.
+const switchNodeType = "switch"
+
+// routes maps the ID of every node on a switch branch to the switches listing
+// it
+type routes map[string][]string
+
+// newRoutes checks the switches and needs of the workflow and collects its
+// branches. Branches must come after their switch in the same node list, and
+// needs must refer to nodes that run earlier.
+func newRoutes(workflow *WorkflowV1) (routes, error) {
+	r := make(routes)
+	seen := make(map[string]bool)
+
+	for _, nodes := range [][]NodeV1{workflow.Nodes, workflow.Finally} {
+		later := make(map[string]bool)
+		for _, node := range nodes {
+			later[node.ID] = true
+		}
+
+		for _, node := range nodes {
+			delete(later, node.ID)
+
+			for _, id := range node.Needs {
+				if !seen[id] {
+					return nil, fmt.Errorf("node %s needs %s, which is not an earlier node", node.ID, id)
+				}
+			}
+			seen[node.ID] = true
+
+			if node.Type != switchNodeType {
+				if node.On != "" || len(node.Cases) > 0 || len(node.Default) > 0 {
+					return nil, fmt.Errorf("node %s: on, cases and default are only valid on switch nodes", node.ID)
+				}
+				continue
+			}
+			if node.On == "" {
+				return nil, fmt.Errorf("switch %s requires on", node.ID)
+			}
+			for key := range node.Cases {
+				if _, err := path.Match(key, ""); err != nil {
+					return nil, fmt.Errorf("switch %s: invalid case pattern %q", node.ID, key)
+				}
+			}
+			for _, branch := range node.branches() {
+				for _, id := range branch {
+					if !later[id] {
+						return nil, fmt.Errorf("switch %s: branch node %s must be a later node in the same list", node.ID, id)
+					}
+					if !contains(r[id], node.ID) {
+						r[id] = append(r[id], node.ID)
+					}
+				}
+			}
+		}
+	}
+	return r, nil
+}
+
+// skipReason reports why a node does not run, or "" if it does
+func (r routes) skipReason(node NodeV1, templateCtx *TemplateContext) string {
+	if switches := r[node.ID]; len(switches) > 0 {
+		taken := false
+		for _, id := range switches {
+			if switchTook(templateCtx.Nodes[id], node.ID) {
+				taken = true
+				break
+			}
+		}
+		if !taken {
+			return fmt.Sprintf("branch of %s not taken", strings.Join(switches, ", "))
+		}
+	}
+
+	if len(node.Needs) > 0 {
+		for _, id := range node.Needs {
+			if output, ok := templateCtx.Nodes[id]; ok && !output.Skipped {
+				return ""
+			}
+		}
+		return fmt.Sprintf("all of %s skipped", strings.Join(node.Needs, ", "))
+	}
+	return ""
+}
+
+// branches returns the node lists of the switch's cases and default
+func (node NodeV1) branches() [][]string {
+	branches := [][]string{node.Default}
+	for _, ids := range node.Cases {
+		branches = append(branches, ids)
+	}
+	return branches
+}
+
+// executeSwitch evaluates the switch and returns the branches it takes:
+// value, the matched cases and branches, the node IDs to run
+func executeSwitch(node NodeV1, templateCtx *TemplateContext) (map[string]interface{}, error) {
+	value, err := resolveTemplateString(node.On, templateCtx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve on: %w", err)
+	}
+	value = strings.TrimSpace(value)
+
+	var matched []string
+	if _, ok := node.Cases[value]; ok {
+		matched = []string{value}
+	} else {
+		for key := range node.Cases {
+			if !strings.ContainsAny(key, "*?[") {
+				continue
+			}
+			if ok, _ := path.Match(key, value); ok {
+				matched = append(matched, key)
+			}
+		}
+		sort.Strings(matched)
+	}
+
+	var ids []string
+	if len(matched) == 0 {
+		ids = node.Default
+	}
+	for _, key := range matched {
+		ids = append(ids, node.Cases[key]...)
+	}
+
+	cases := make([]interface{}, len(matched))
+	for i, key := range matched {
+		cases[i] = key
+	}
+	branches := []interface{}{}
+	taken := make(map[string]bool)
+	for _, id := range ids {
+		if !taken[id] {
+			taken[id] = true
+			branches = append(branches, id)
+		}
+	}
+
+	return map[string]interface{}{
+		"value":    value,
+		"cases":    cases,
+		"default":  len(matched) == 0,
+		"branches": branches,
+	}, nil
+}
+
+// switchTook reports whether a switch that ran took the node's branch
+func switchTook(output NodeOutput, id string) bool {
+	if output.Skipped {
+		return false
+	}
+	branches, _ := output.Output["branches"].([]interface{})
+	for _, branch := range branches {
+		if branch == id {
+			return true
+		}
+	}
+	return false
+}
+
+// contains reports whether list holds s
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Span attributes set by the engine
+const (
+	attrWorkflowName = attribute.Key("octa.workflow.name")
+	attrRunID        = attribute.Key("octa.run.id")
+	attrRunStatus    = attribute.Key("octa.run.status")
+	attrRunResumed   = attribute.Key("octa.run.resumed")
+	attrNodeID       = attribute.Key("octa.node.id")
+	attrActionType   = attribute.Key("octa.action.type")
+	attrNodeCached   = attribute.Key("octa.node.cached")
+	attrExitCode     = attribute.Key("process.exit.code")
+	attrPID          = attribute.Key("process.pid")
+)
+
+// tracer creates the engine's spans from the global trace provider. Until a
+// provider is installed it produces non-recording spans that still propagate
+// trace context.
+var tracer = otel.Tracer("github.com/octo-agent/go-ai-agent-v1/orchestrator/engine")
+
+// traceContext propagates W3C trace context to actions
+var traceContext = propagation.TraceContext{}
+
+// withTraceEnv returns env with TRACEPARENT and TRACESTATE describing the span
+// in ctx, replacing inherited values. A nil env stands for the process
+// environment; it is returned unchanged when ctx carries no trace.
+func withTraceEnv(ctx context.Context, env []string) []string {
+	carrier := propagation.MapCarrier{}
+	traceContext.Inject(ctx, carrier)
+	if carrier.Get("traceparent") == "" {
+		return env
+	}
+
+	if env == nil {
+		env = os.Environ()
+	}
+	result := make([]string, 0, len(env)+2)
+	for _, entry := range env {
+		if !strings.HasPrefix(entry, "TRACEPARENT=") && !strings.HasPrefix(entry, "TRACESTATE=") {
+			result = append(result, entry)
+		}
+	}
+	result = append(result, "TRACEPARENT="+carrier.Get("traceparent"))
+	if state := carrier.Get("tracestate"); state != "" {
+		result = append(result, "TRACESTATE="+state)
+	}
+	return result
+}
+
+// endRunSpan marks the workflow span with the run's final status and ends it
+func endRunSpan(span trace.Span, record *RunRecord) {
+	span.SetAttributes(attrRunStatus.String(record.Status))
+	if record.Status != RunSucceeded && record.Error != "" {
+		span.SetStatus(codes.Error, record.Error)
+	}
+	span.End()
+}
+
+// endSpan records err on the span, if any, and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
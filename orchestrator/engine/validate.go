@@ -0,0 +1,749 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ValidationError lists every problem found in a workflow
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "workflow validation failed:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate checks the loaded workflow without running it. All the problems
+// found are reported together in a *ValidationError.
+func (e *Engine) Validate() error {
+	if e.Workflow == nil {
+		return errors.New("no workflow loaded")
+	}
+
+	// Validate the document as written where possible, so that fields of the
+	// wrong type are reported rather than decoded away
+	workflow := e.source
+	if workflow == nil {
+		data, err := yaml.Marshal(e.Workflow)
+		if err != nil {
+			return err
+		}
+		if err := yaml.Unmarshal(data, &workflow); err != nil {
+			return err
+		}
+	}
+
+	// Nodes are checked against the manifests of their actions
+	manifests := make(map[string]*ActionManifest)
+	var manifestProblems []string
+	manifest := func(actionType string) *ActionManifest {
+		if m, ok := manifests[actionType]; ok {
+			return m
+		}
+		m, err := e.LoadActionManifest(actionType)
+		if err != nil {
+			message := err.Error()
+			manifestProblems = append(manifestProblems, strings.ToUpper(message[:1])+message[1:])
+		}
+		manifests[actionType] = m
+		return m
+	}
+
+	problems := validateDocument(workflow, manifest)
+	if problems = append(problems, manifestProblems...); len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// validateDocument checks the structure of a decoded workflow document.
+// manifest returns the manifest of an action type, or nil if it is invalid.
+func validateDocument(workflow map[string]interface{}, manifest func(actionType string) *ActionManifest) []string {
+	var errors []string
+
+	// Check required top-level fields
+	requiredFields := []string{"name", "description", "nodes"}
+	for _, field := range requiredFields {
+		if _, exists := workflow[field]; !exists {
+			errors = append(errors, fmt.Sprintf("Missing required field: %s", field))
+		}
+	}
+
+	// Validate nodes array
+	nodeIds := make(map[string]bool)
+	if nodesInterface, exists := workflow["nodes"]; exists {
+		if nodes, ok := nodesInterface.([]interface{}); ok {
+			if len(nodes) == 0 {
+				errors = append(errors, "Nodes array cannot be empty")
+			}
+			errors = append(errors, validateNodeList(nodes, "Node", nodeIds, manifest)...)
+		} else {
+			errors = append(errors, "Nodes must be an array")
+		}
+	}
+
+	// Validate finally nodes, which share the node ID namespace
+	if finallyInterface, exists := workflow["finally"]; exists {
+		if nodes, ok := finallyInterface.([]interface{}); ok {
+			errors = append(errors, validateNodeList(nodes, "Finally node", nodeIds, manifest)...)
+			for i, nodeInterface := range nodes {
+				if node, ok := nodeInterface.(map[string]interface{}); ok && (node["type"] == sleepNodeType || node["type"] == eventNodeType || node["type"] == approvalNodeType) {
+					errors = append(errors, fmt.Sprintf("Finally node %d cannot be a %s node", i, node["type"]))
+				}
+				if node, ok := nodeInterface.(map[string]interface{}); ok && node["compensate"] != nil {
+					errors = append(errors, fmt.Sprintf("Finally node %d cannot have compensate", i))
+				}
+			}
+		} else {
+			errors = append(errors, "Finally must be an array")
+		}
+	}
+
+	// Validate permissions
+	if permissionsInterface, exists := workflow["permissions"]; exists {
+		if permissions, ok := permissionsInterface.(map[string]interface{}); ok {
+			for _, field := range []string{"write_roots", "url_hosts"} {
+				if value, exists := permissions[field]; exists {
+					if list, ok := value.([]interface{}); ok {
+						for _, entry := range list {
+							if s, ok := entry.(string); !ok || strings.TrimSpace(s) == "" {
+								errors = append(errors, fmt.Sprintf("Permissions %s entries must be non-empty strings", field))
+								break
+							}
+						}
+					} else {
+						errors = append(errors, fmt.Sprintf("Permissions %s must be an array", field))
+					}
+				}
+			}
+			if value, exists := permissions["git_credentials"]; exists {
+				if _, ok := value.(bool); !ok {
+					errors = append(errors, "Permissions git_credentials must be true or false")
+				}
+			}
+		} else if permissionsInterface != nil {
+			errors = append(errors, "Permissions must be an object")
+		}
+	}
+
+	// Validate vars
+	if varsInterface, exists := workflow["vars"]; exists {
+		if vars, ok := varsInterface.(map[string]interface{}); ok {
+			if _, err := newVarResolver(vars, nodeIds); err != nil {
+				message := err.Error()
+				errors = append(errors, strings.ToUpper(message[:1])+message[1:])
+			}
+		} else if varsInterface != nil {
+			errors = append(errors, "Vars must be an object")
+		}
+	}
+
+	// Validate expressions against the nodes and vars they refer to
+	errors = append(errors, validateExpressions(workflow, manifest)...)
+
+	// Validate matrix
+	if matrixInterface, exists := workflow["matrix"]; exists {
+		errors = append(errors, validateMatrix(matrixInterface)...)
+	}
+
+	// Validate triggers array
+	if triggersInterface, exists := workflow["triggers"]; exists {
+		if triggers, ok := triggersInterface.([]interface{}); ok {
+			for i, triggerInterface := range triggers {
+				trigger, ok := triggerInterface.(map[string]interface{})
+				if !ok {
+					errors = append(errors, fmt.Sprintf("Trigger %d is not a valid object", i))
+					continue
+				}
+
+				if gitInterface, exists := trigger["git"]; exists {
+					git, ok := gitInterface.(map[string]interface{})
+					if !ok {
+						errors = append(errors, fmt.Sprintf("Trigger %d git must be an object", i))
+					} else if url, _ := git["url"].(string); strings.TrimSpace(url) == "" {
+						errors = append(errors, fmt.Sprintf("Trigger %d git missing required field: url", i))
+					}
+				} else if fsWatchInterface, exists := trigger["fs_watch"]; exists {
+					fsWatch, ok := fsWatchInterface.(map[string]interface{})
+					if !ok {
+						errors = append(errors, fmt.Sprintf("Trigger %d fs_watch must be an object", i))
+					} else if path, _ := fsWatch["path"].(string); strings.TrimSpace(path) == "" {
+						errors = append(errors, fmt.Sprintf("Trigger %d fs_watch missing required field: path", i))
+					}
+				} else {
+					errors = append(errors, fmt.Sprintf("Trigger %d has no known trigger type", i))
+				}
+			}
+		} else {
+			errors = append(errors, "Triggers must be an array")
+		}
+	}
+
+	return errors
+}
+
+// validateMatrix validates a matrix block
+func validateMatrix(matrixInterface interface{}) []string {
+	var errors []string
+
+	matrix, ok := matrixInterface.(map[string]interface{})
+	if !ok {
+		return []string{"Matrix must be an object"}
+	}
+
+	if parametersInterface, exists := matrix["parameters"]; exists {
+		if parameters, ok := parametersInterface.(map[string]interface{}); ok {
+			for name, values := range parameters {
+				if list, ok := values.([]interface{}); !ok || len(list) == 0 {
+					errors = append(errors, fmt.Sprintf("Matrix parameter %s must be a non-empty array", name))
+				}
+			}
+		} else {
+			errors = append(errors, "Matrix parameters must be an object")
+		}
+	}
+
+	for _, field := range []string{"include", "exclude"} {
+		if value, exists := matrix[field]; exists {
+			list, ok := value.([]interface{})
+			if !ok {
+				errors = append(errors, fmt.Sprintf("Matrix %s must be an array", field))
+				continue
+			}
+			for i, entry := range list {
+				if combination, ok := entry.(map[string]interface{}); !ok || len(combination) == 0 {
+					errors = append(errors, fmt.Sprintf("Matrix %s %d must be a non-empty object", field, i))
+				}
+			}
+		}
+	}
+
+	if value, exists := matrix["parallelism"]; exists {
+		if n, ok := value.(int); !ok || n < 1 {
+			errors = append(errors, "Matrix parallelism must be a positive integer")
+		}
+	}
+
+	return errors
+}
+
+// literalSetting returns an input of a built-in node as text, unless it is
+// missing or templated. Only {{ is looked for, which also covers ${{ }}
+// expressions since ${{ contains {{.
+func literalSetting(inputs map[string]interface{}, field string) (string, bool) {
+	value, exists := inputs[field]
+	if !exists || strings.Contains(fmt.Sprint(value), "{{") {
+		return "", false
+	}
+	return fmt.Sprint(value), true
+}
+
+// validateApprovalInputs checks the settings of an approval node; templated
+// values are only known at run time
+func validateApprovalInputs(inputsInterface interface{}, label string) []string {
+	var errors []string
+
+	inputs, _ := inputsInterface.(map[string]interface{})
+
+	if value, ok := literalSetting(inputs, "timeout"); ok {
+		if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+			errors = append(errors, fmt.Sprintf("%s approval timeout must be a positive duration such as 30m or 12h", label))
+		}
+	}
+	if value, ok := literalSetting(inputs, "default"); ok {
+		switch value {
+		case "approve", "approved", "reject", "rejected":
+		default:
+			errors = append(errors, fmt.Sprintf("%s approval default must be approve or reject", label))
+		}
+	}
+	if value, ok := literalSetting(inputs, "on_reject"); ok && value != "fail" && value != "continue" {
+		errors = append(errors, fmt.Sprintf("%s approval on_reject must be fail or continue", label))
+	}
+
+	return errors
+}
+
+// validateSwitch checks the on, cases and default of a switch node; the nodes
+// on its branches must be among the later nodes
+func validateSwitch(node map[string]interface{}, later []interface{}, label string) []string {
+	var errors []string
+
+	if on, ok := node["on"].(string); !ok || strings.TrimSpace(on) == "" {
+		errors = append(errors, fmt.Sprintf("%s switch requires on", label))
+	}
+
+	laterIds := make(map[string]bool)
+	for _, nodeInterface := range later {
+		if laterNode, ok := nodeInterface.(map[string]interface{}); ok {
+			if id, ok := laterNode["id"].(string); ok {
+				laterIds[id] = true
+			}
+		}
+	}
+	checkBranch := func(branchInterface interface{}, name string) {
+		branch, ok := branchInterface.([]interface{})
+		if !ok {
+			errors = append(errors, fmt.Sprintf("%s switch %s must be an array of node IDs", label, name))
+			return
+		}
+		for _, target := range branch {
+			if id, ok := target.(string); !ok || !laterIds[id] {
+				errors = append(errors, fmt.Sprintf("%s switch %s lists %v, which is not a later node", label, name, target))
+			}
+		}
+	}
+
+	switch cases := node["cases"].(type) {
+	case map[string]interface{}:
+		for value, branch := range cases {
+			if strings.ContainsAny(value, "*?[") {
+				if _, err := path.Match(value, ""); err != nil {
+					errors = append(errors, fmt.Sprintf("%s switch case %q is not a valid pattern", label, value))
+				}
+			}
+			checkBranch(branch, fmt.Sprintf("case %q", value))
+		}
+	case map[interface{}]interface{}:
+		for value, branch := range cases {
+			checkBranch(branch, fmt.Sprintf("case %q", fmt.Sprint(value)))
+		}
+	case nil:
+		if _, exists := node["default"]; !exists {
+			errors = append(errors, fmt.Sprintf("%s switch requires cases or default", label))
+		}
+	default:
+		errors = append(errors, fmt.Sprintf("%s switch cases must be an object", label))
+	}
+	if branch, exists := node["default"]; exists {
+		checkBranch(branch, "default")
+	}
+
+	return errors
+}
+
+// validateWaitInputs checks the settings of a sleep or wait_for_event node;
+// templated values are only known at run time
+func validateWaitInputs(nodeType string, inputsInterface interface{}, label string) []string {
+	var errors []string
+
+	inputs, _ := inputsInterface.(map[string]interface{})
+
+	if nodeType == sleepNodeType {
+		_, hasDuration := inputs["duration"]
+		_, hasUntil := inputs["until"]
+		if hasDuration == hasUntil {
+			errors = append(errors, fmt.Sprintf("%s sleep requires either duration or until", label))
+		}
+		if value, ok := literalSetting(inputs, "duration"); ok {
+			if d, err := time.ParseDuration(value); err != nil || d < 0 {
+				errors = append(errors, fmt.Sprintf("%s sleep duration must be a duration such as 90s or 2h", label))
+			}
+		}
+		if value, ok := literalSetting(inputs, "until"); ok {
+			if _, err := time.Parse(time.RFC3339, value); err != nil {
+				errors = append(errors, fmt.Sprintf("%s sleep until must be an RFC 3339 time", label))
+			}
+		}
+		return errors
+	}
+
+	if _, exists := inputs["event"]; !exists {
+		errors = append(errors, fmt.Sprintf("%s wait_for_event requires event", label))
+	}
+	if value, ok := literalSetting(inputs, "timeout"); ok {
+		if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+			errors = append(errors, fmt.Sprintf("%s wait_for_event timeout must be a positive duration such as 30m or 12h", label))
+		}
+	}
+	if value, ok := literalSetting(inputs, "on_timeout"); ok && value != "fail" && value != "continue" {
+		errors = append(errors, fmt.Sprintf("%s wait_for_event on_timeout must be fail or continue", label))
+	}
+
+	return errors
+}
+
+// validateNodeList validates a list of nodes, recording their IDs in nodeIds
+func validateNodeList(nodes []interface{}, label string, nodeIds map[string]bool, manifest func(actionType string) *ActionManifest) []string {
+	var errors []string
+
+	for i, nodeInterface := range nodes {
+		if node, ok := nodeInterface.(map[string]interface{}); ok {
+			// Check required node fields
+			nodeRequiredFields := []string{"id", "type", "inputs_from_workflow"}
+			switch node["type"] {
+			case switchNodeType:
+				// Switches route on their own fields and take no inputs
+				nodeRequiredFields = nodeRequiredFields[:2]
+			case scriptNodeType:
+				// Scripts read the run directly; inputs are optional
+				nodeRequiredFields = []string{"id", "type", "script"}
+			}
+			for _, field := range nodeRequiredFields {
+				if _, exists := node[field]; !exists {
+					errors = append(errors, fmt.Sprintf("%s %d missing required field: %s", label, i, field))
+				}
+			}
+
+			// Check for duplicate node IDs
+			if idInterface, exists := node["id"]; exists {
+				if id, ok := idInterface.(string); ok {
+					if nodeIds[id] {
+						errors = append(errors, fmt.Sprintf("Duplicate node ID: %s", id))
+					}
+					nodeIds[id] = true
+
+					// Validate ID format
+					if strings.TrimSpace(id) == "" {
+						errors = append(errors, fmt.Sprintf("%s %d has empty ID", label, i))
+					}
+				}
+			}
+
+			// Validate type field
+			if typeInterface, exists := node["type"]; exists {
+				if typeStr, ok := typeInterface.(string); ok {
+					if strings.TrimSpace(typeStr) == "" {
+						errors = append(errors, fmt.Sprintf("%s %d has empty type", label, i))
+					}
+				}
+			}
+
+			// Validate process settings
+			if limit, exists := node["on_output_limit"]; exists && limit != "fail" && limit != "truncate" {
+				errors = append(errors, fmt.Sprintf("%s %d on_output_limit must be fail or truncate", label, i))
+			}
+			for _, field := range []string{"max_input_bytes", "max_output_bytes"} {
+				if value, exists := node[field]; exists {
+					if n, ok := value.(int); !ok || n <= 0 {
+						errors = append(errors, fmt.Sprintf("%s %d %s must be a positive integer", label, i, field))
+					}
+				}
+			}
+			if envInterface, exists := node["env"]; exists {
+				if env, ok := envInterface.(map[string]interface{}); ok {
+					if inherit, exists := env["inherit"]; exists && inherit != "all" && inherit != "none" && inherit != "allowlist" {
+						errors = append(errors, fmt.Sprintf("%s %d env inherit must be all, none or allowlist", label, i))
+					}
+				} else {
+					errors = append(errors, fmt.Sprintf("%s %d env must be an object", label, i))
+				}
+			}
+			if sandboxInterface, exists := node["sandbox"]; exists {
+				if sandbox, ok := sandboxInterface.(map[string]interface{}); ok {
+					if seccomp, exists := sandbox["seccomp"]; exists && seccomp != "default" && seccomp != "no-network" && seccomp != "none" {
+						errors = append(errors, fmt.Sprintf("%s %d sandbox seccomp must be default, no-network or none", label, i))
+					}
+					if network, exists := sandbox["network"]; exists {
+						if _, ok := network.(bool); !ok {
+							errors = append(errors, fmt.Sprintf("%s %d sandbox network must be true or false", label, i))
+						}
+					}
+					if _, hasUID := sandbox["uid"]; !hasUID {
+						if _, hasGID := sandbox["gid"]; hasGID {
+							errors = append(errors, fmt.Sprintf("%s %d sandbox gid requires uid", label, i))
+						}
+					}
+				} else if sandboxInterface != nil {
+					errors = append(errors, fmt.Sprintf("%s %d sandbox must be an object", label, i))
+				}
+			}
+			if cacheInterface, exists := node["cache"]; exists {
+				if cache, ok := cacheInterface.(map[string]interface{}); ok {
+					if ttl, exists := cache["ttl"]; exists {
+						if d, err := time.ParseDuration(fmt.Sprint(ttl)); err != nil || d <= 0 {
+							errors = append(errors, fmt.Sprintf("%s %d cache ttl must be a positive duration such as 30m or 12h", label, i))
+						}
+					}
+				} else if cacheInterface != nil {
+					errors = append(errors, fmt.Sprintf("%s %d cache must be an object", label, i))
+				}
+			}
+			if node["type"] == approvalNodeType {
+				errors = append(errors, validateApprovalInputs(node["inputs_from_workflow"], fmt.Sprintf("%s %d", label, i))...)
+			}
+			if actionType, ok := node["type"].(string); ok && actionType != "" && !isBuiltinNodeType(actionType) {
+				if m := manifest(actionType); m != nil && m.Input != nil {
+					inputs := node["inputs_from_workflow"]
+					if inputs == nil {
+						inputs = map[string]interface{}{}
+					}
+					for _, problem := range m.Input.checkTemplated(inputs, "inputs_from_workflow") {
+						errors = append(errors, fmt.Sprintf("%s %d %s", label, i, problem))
+					}
+				}
+			}
+			if needsInterface, exists := node["needs"]; exists {
+				needs, ok := needsInterface.([]interface{})
+				if !ok {
+					errors = append(errors, fmt.Sprintf("%s %d needs must be an array of node IDs", label, i))
+				}
+				for _, need := range needs {
+					if id, ok := need.(string); !ok || !nodeIds[id] || id == node["id"] {
+						errors = append(errors, fmt.Sprintf("%s %d needs %v, which is not an earlier node", label, i, need))
+					}
+				}
+			}
+			if node["type"] == switchNodeType {
+				errors = append(errors, validateSwitch(node, nodes[i+1:], fmt.Sprintf("%s %d", label, i))...)
+			} else {
+				for _, field := range []string{"on", "cases", "default"} {
+					if _, exists := node[field]; exists {
+						errors = append(errors, fmt.Sprintf("%s %d %s is only valid on switch nodes", label, i, field))
+					}
+				}
+			}
+			for _, field := range []string{"when", "for_each"} {
+				if value, exists := node[field]; exists {
+					if s, ok := value.(string); !ok || strings.TrimSpace(s) == "" {
+						errors = append(errors, fmt.Sprintf("%s %d %s must be a non-empty expression", label, i, field))
+					}
+				}
+			}
+			if _, exists := node["for_each"]; exists {
+				switch node["type"] {
+				case approvalNodeType, switchNodeType, sleepNodeType, eventNodeType:
+					errors = append(errors, fmt.Sprintf("%s %d for_each cannot be used on %s nodes", label, i, node["type"]))
+				}
+			}
+			if scriptInterface, exists := node["script"]; exists {
+				if node["type"] != scriptNodeType {
+					errors = append(errors, fmt.Sprintf("%s %d script is only valid on script nodes", label, i))
+				} else if script, ok := scriptInterface.(string); !ok || strings.TrimSpace(script) == "" {
+					errors = append(errors, fmt.Sprintf("%s %d script must be non-empty Starlark code", label, i))
+				} else if err := compileScript(fmt.Sprint(node["id"]), script); err != nil {
+					errors = append(errors, fmt.Sprintf("%s %d script is invalid: %v", label, i, err))
+				}
+			}
+			if compensateInterface, exists := node["compensate"]; exists {
+				if compensate, ok := compensateInterface.(map[string]interface{}); ok {
+					actionType, _ := compensate["type"].(string)
+					switch actionType {
+					case "":
+						errors = append(errors, fmt.Sprintf("%s %d compensate requires type", label, i))
+					case approvalNodeType, switchNodeType, scriptNodeType, sleepNodeType, eventNodeType:
+						errors = append(errors, fmt.Sprintf("%s %d compensate cannot use the built-in %s node type", label, i, actionType))
+					}
+					if _, exists := compensate["inputs_from_workflow"]; !exists {
+						errors = append(errors, fmt.Sprintf("%s %d compensate missing required field: inputs_from_workflow", label, i))
+					}
+					for _, field := range []string{"cache", "compensate", "needs", "when", "for_each"} {
+						if _, exists := compensate[field]; exists {
+							errors = append(errors, fmt.Sprintf("%s %d compensate does not support %s", label, i, field))
+						}
+					}
+				} else {
+					errors = append(errors, fmt.Sprintf("%s %d compensate must be an object", label, i))
+				}
+			}
+			if node["type"] == sleepNodeType || node["type"] == eventNodeType {
+				errors = append(errors, validateWaitInputs(node["type"].(string), node["inputs_from_workflow"], fmt.Sprintf("%s %d", label, i))...)
+			}
+			if artifactsInterface, exists := node["artifacts"]; exists {
+				if artifacts, ok := artifactsInterface.([]interface{}); ok {
+					for _, pattern := range artifacts {
+						if s, ok := pattern.(string); !ok || strings.TrimSpace(s) == "" {
+							errors = append(errors, fmt.Sprintf("%s %d artifacts entries must be non-empty glob strings", label, i))
+							break
+						}
+					}
+				} else {
+					errors = append(errors, fmt.Sprintf("%s %d artifacts must be an array", label, i))
+				}
+			}
+		} else {
+			errors = append(errors, fmt.Sprintf("%s %d is not a valid object", label, i))
+		}
+	}
+
+	return errors
+}
+
+// exprScope is what the expressions of a field can refer to
+type exprScope struct {
+	nodes    map[string]map[string]interface{} // Every node of the workflow by ID
+	manifest func(actionType string) *ActionManifest
+	vars     map[string]interface{}
+	item     bool // In a for_each node
+	output   bool // In a compensation
+	inVars   bool // In a var, whose references to unknown vars and nodes are reported when checking vars
+}
+
+// validateExpressions compiles the expressions of the workflow's nodes and
+// vars and checks the nodes, outputs and vars they refer to
+func validateExpressions(workflow map[string]interface{}, manifest func(actionType string) *ActionManifest) []string {
+	var errors []string
+
+	lists := []struct {
+		field, label string
+	}{{"nodes", "Node"}, {"finally", "Finally node"}}
+	nodes := make(map[string]map[string]interface{})
+	for _, list := range lists {
+		entries, _ := workflow[list.field].([]interface{})
+		for _, entry := range entries {
+			if node, ok := entry.(map[string]interface{}); ok {
+				if id, ok := node["id"].(string); ok {
+					nodes[id] = node
+				}
+			}
+		}
+	}
+	vars, _ := workflow["vars"].(map[string]interface{})
+
+	for _, list := range lists {
+		entries, _ := workflow[list.field].([]interface{})
+		for i, entry := range entries {
+			node, ok := entry.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			label := fmt.Sprintf("%s %d", list.label, i)
+			scope := exprScope{nodes: nodes, manifest: manifest, vars: vars}
+
+			// when and for_each are evaluated before the node has an item
+			if when, ok := node["when"].(string); ok {
+				errors = append(errors, checkExpression(bareExpression(when), true, scope, label+" when")...)
+			}
+			if forEach, ok := node["for_each"].(string); ok {
+				errors = append(errors, checkExpression(bareExpression(forEach), false, scope, label+" for_each")...)
+			}
+
+			scope.item = node["for_each"] != nil
+			for _, field := range sortedKeys(node) {
+				switch field {
+				case "when", "for_each", "script":
+					continue
+				case "compensate":
+					errors = append(errors, checkFieldExpressions(node[field], exprScope{nodes: nodes, manifest: manifest, vars: vars, output: true}, label+" compensate")...)
+				default:
+					errors = append(errors, checkFieldExpressions(node[field], scope, label+" "+field)...)
+				}
+			}
+		}
+	}
+
+	for _, name := range sortedKeys(vars) {
+		errors = append(errors, checkFieldExpressions(vars[name], exprScope{nodes: nodes, manifest: manifest, vars: vars, inVars: true}, "Var "+name)...)
+	}
+
+	return errors
+}
+
+// checkFieldExpressions checks the ${{ }} expressions in a field's value
+func checkFieldExpressions(value interface{}, scope exprScope, label string) []string {
+	_, sources, err := extractExpressions(value, nil)
+	if err != nil {
+		return []string{fmt.Sprintf("%s: %v", label, err)}
+	}
+	var errors []string
+	for _, source := range sources {
+		errors = append(errors, checkExpression(source, false, scope, label)...)
+	}
+	return errors
+}
+
+// checkExpression compiles an expression and checks that the nodes, node
+// outputs and vars it reads exist
+func checkExpression(source string, asBool bool, scope exprScope, label string) []string {
+	label = fmt.Sprintf("%s expression ${{ %s }}", label, source)
+	if _, err := compileExpression(source, asBool); err != nil {
+		// The first line has the message; the rest points at the source
+		message, _, _ := strings.Cut(err.Error(), "\n")
+		return []string{fmt.Sprintf("%s does not compile: %s", label, message)}
+	}
+	paths, err := expressionPaths(source)
+	if err != nil {
+		return []string{fmt.Sprintf("%s does not compile: %v", label, err)}
+	}
+
+	var errors []string
+	seen := make(map[string]bool)
+	report := func(format string, args ...interface{}) {
+		message := fmt.Sprintf("%s "+format, append([]interface{}{label}, args...)...)
+		if !seen[message] {
+			seen[message] = true
+			errors = append(errors, message)
+		}
+	}
+	for _, path := range paths {
+		switch path[0] {
+		case "nodes":
+			if len(path) < 2 {
+				continue
+			}
+			node, ok := scope.nodes[path[1]]
+			if !ok {
+				if !scope.inVars {
+					report("refers to unknown node %s", path[1])
+				}
+				continue
+			}
+			if len(path) < 3 {
+				continue
+			}
+			if path[2] != "output" && path[2] != "error" && path[2] != "skipped" {
+				report("reads nodes.%s.%s; nodes have output, error and skipped", path[1], path[2])
+				continue
+			}
+			if fields := nodeOutputFields(node, scope.manifest); len(path) > 3 && path[2] == "output" && fields != nil && !contains(fields, path[3]) {
+				report("reads output %s of node %s, which outputs %s", path[3], path[1], strings.Join(fields, ", "))
+			}
+		case "vars":
+			if len(path) > 1 {
+				if _, ok := scope.vars[path[1]]; !ok && !scope.inVars {
+					report("refers to unknown var %s", path[1])
+				}
+			}
+		case "item", "index":
+			if !scope.item {
+				report("reads %s, which is only set in for_each nodes", path[0])
+			}
+		case "output":
+			if !scope.output {
+				report("reads output, which is only set in compensations")
+			}
+		}
+	}
+	return errors
+}
+
+// nodeOutputFields returns the fields of a node's output when they are known
+// before it runs, from its action's output schema for action nodes, or nil
+func nodeOutputFields(node map[string]interface{}, manifest func(actionType string) *ActionManifest) []string {
+	if node["for_each"] != nil {
+		return []string{"results"}
+	}
+	switch node["type"] {
+	case switchNodeType:
+		return []string{"value", "cases", "default", "branches"}
+	case approvalNodeType:
+		return []string{"approved", "decision", "approver", "comment", "decided_at", "timed_out"}
+	case sleepNodeType:
+		return []string{"slept_until", "woke_at"}
+	case eventNodeType:
+		return []string{"event", "correlation_id", "payload", "received_at", "timed_out"}
+	}
+	if actionType, ok := node["type"].(string); ok && actionType != "" && !isBuiltinNodeType(actionType) {
+		if m := manifest(actionType); m != nil {
+			return m.Output.Fields()
+		}
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of a map in order, for stable reports
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,182 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestValidateDocument(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		want     []string
+	}{
+		{
+			name: "valid",
+			document: `
+name: valid
+description: A valid workflow
+nodes:
+  - id: greet
+    type: echo-json
+    inputs_from_workflow:
+      message: "hello"
+  - id: wait
+    type: sleep
+    needs: [greet]
+    inputs_from_workflow:
+      duration: "{{.WorkflowData.delay}}"
+`,
+		},
+		{
+			name:     "missing top-level fields",
+			document: `nodes: []`,
+			want:     []string{"Missing required field: name", "Missing required field: description", "Nodes array cannot be empty"},
+		},
+		{
+			name: "nodes not an array",
+			document: `
+name: n
+description: d
+nodes: {}
+`,
+			want: []string{"Nodes must be an array"},
+		},
+		{
+			name: "needs a later node",
+			document: `
+name: n
+description: d
+nodes:
+  - id: first
+    type: echo-json
+    needs: [second]
+    inputs_from_workflow: {}
+  - id: second
+    type: echo-json
+    inputs_from_workflow: {}
+`,
+			want: []string{"Node 0 needs second, which is not an earlier node"},
+		},
+		{
+			name: "literal wait settings are checked",
+			document: `
+name: n
+description: d
+nodes:
+  - id: wait
+    type: sleep
+    inputs_from_workflow:
+      duration: "soon"
+  - id: signed
+    type: wait_for_event
+    inputs_from_workflow:
+      event: signed
+      timeout: "-1h"
+`,
+			want: []string{
+				"Node 0 sleep duration must be a duration such as 90s or 2h",
+				"Node 1 wait_for_event timeout must be a positive duration such as 30m or 12h",
+			},
+		},
+		{
+			name: "templated and expression settings are left to run time",
+			document: `
+name: n
+description: d
+nodes:
+  - id: approve
+    type: approval
+    inputs_from_workflow:
+      timeout: "{{.WorkflowData.timeout}}"
+      default: "${{ workflow_data.default }}"
+`,
+		},
+		{
+			name: "literal approval settings are checked",
+			document: `
+name: n
+description: d
+nodes:
+  - id: approve
+    type: approval
+    inputs_from_workflow:
+      timeout: "0s"
+      default: "maybe"
+`,
+			want: []string{
+				"Node 0 approval timeout must be a positive duration such as 30m or 12h",
+				"Node 0 approval default must be approve or reject",
+			},
+		},
+		{
+			name: "wait node in finally",
+			document: `
+name: n
+description: d
+nodes:
+  - id: greet
+    type: echo-json
+    inputs_from_workflow: {}
+finally:
+  - id: wait
+    type: sleep
+    inputs_from_workflow:
+      duration: "1s"
+`,
+			want: []string{"Finally node 0 cannot be a sleep node"},
+		},
+		{
+			name: "permissions",
+			document: `
+name: n
+description: d
+nodes:
+  - id: greet
+    type: echo-json
+    inputs_from_workflow: {}
+permissions:
+  url_hosts: [""]
+  write_roots: "/tmp"
+  git_credentials: "yes"
+`,
+			want: []string{
+				"Permissions write_roots must be an array",
+				"Permissions url_hosts entries must be non-empty strings",
+				"Permissions git_credentials must be true or false",
+			},
+		},
+		{
+			name: "triggers",
+			document: `
+name: n
+description: d
+nodes:
+  - id: greet
+    type: echo-json
+    inputs_from_workflow: {}
+triggers:
+  - git: {}
+  - fs_watch:
+      path: "/data"
+  - cron: "* * * * *"
+`,
+			want: []string{"Trigger 0 git missing required field: url", "Trigger 2 has no known trigger type"},
+		},
+	}
+
+	noManifest := func(string) *ActionManifest { return nil }
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var document map[string]interface{}
+			if err := yaml.Unmarshal([]byte(tt.document), &document); err != nil {
+				t.Fatal(err)
+			}
+			if got := validateDocument(document, noManifest); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateDocument =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,292 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Workflow vars are templated once per run and exposed as {{.Vars.name}}.
+// A var is evaluated at run start unless it refers to node outputs, directly
+// or through other vars; then it is evaluated as soon as all of those nodes
+// have completed. Until then templates see no value for it.
+
+// varResolver evaluates a workflow's vars in dependency order
+type varResolver struct {
+	defs     map[string]interface{}
+	varDeps  map[string][]string // Vars each var refers to
+	nodeDeps map[string][]string // Nodes each var refers to
+	pending  []string            // Vars not evaluated yet, sorted by name
+}
+
+// newVarResolver analyses the references between vars and from vars to
+// nodes, rejecting cycles and references to unknown vars or nodes
+func newVarResolver(vars map[string]interface{}, nodeIDs map[string]bool) (*varResolver, error) {
+	r := &varResolver{
+		defs:     vars,
+		varDeps:  make(map[string][]string),
+		nodeDeps: make(map[string][]string),
+	}
+
+	for name, def := range vars {
+		refs, err := templateReferences(def)
+		if err != nil {
+			return nil, fmt.Errorf("var %s: %w", name, err)
+		}
+
+		for _, ref := range refs.vars {
+			if ref == "" {
+				// {{.Vars}} as a whole depends on every other var
+				for other := range vars {
+					if other != name {
+						r.varDeps[name] = append(r.varDeps[name], other)
+					}
+				}
+				continue
+			}
+			if _, exists := vars[ref]; !exists {
+				return nil, fmt.Errorf("var %s refers to unknown var %s", name, ref)
+			}
+			r.varDeps[name] = append(r.varDeps[name], ref)
+		}
+		for _, ref := range refs.nodes {
+			if !nodeIDs[ref] {
+				return nil, fmt.Errorf("var %s refers to unknown node %s", name, ref)
+			}
+			r.nodeDeps[name] = append(r.nodeDeps[name], ref)
+		}
+		r.pending = append(r.pending, name)
+	}
+	sort.Strings(r.pending)
+
+	if cycle := r.findCycle(); cycle != nil {
+		return nil, fmt.Errorf("vars form a cycle: %s", strings.Join(cycle, " -> "))
+	}
+	return r, nil
+}
+
+// findCycle returns a chain of vars that refers back to its start, or nil
+func (r *varResolver) findCycle() []string {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int)
+
+	var path []string
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		switch state[name] {
+		case visiting:
+			for i, entry := range path {
+				if entry == name {
+					return append(append([]string{}, path[i:]...), name)
+				}
+			}
+		case done:
+			return nil
+		}
+
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range r.varDeps[name] {
+			if cycle := visit(dep); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = done
+		return nil
+	}
+
+	for _, name := range r.pending {
+		if cycle := visit(name); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// resolveReady evaluates every pending var whose nodes have completed and
+// whose vars have been evaluated, storing the results in templateCtx.Vars
+func (r *varResolver) resolveReady(templateCtx *TemplateContext) error {
+	for progress := true; progress; {
+		progress = false
+		remaining := r.pending[:0]
+		for _, name := range r.pending {
+			if !r.ready(name, templateCtx) {
+				remaining = append(remaining, name)
+				continue
+			}
+
+			resolved, err := resolveTemplates(map[string]interface{}{name: r.defs[name]}, templateCtx)
+			if err != nil {
+				return fmt.Errorf("failed to resolve var %s: %w", name, err)
+			}
+			templateCtx.Vars[name] = resolved[name]
+			progress = true
+		}
+		r.pending = remaining
+	}
+	return nil
+}
+
+// markResolved removes vars that already have values from the pending ones
+func (r *varResolver) markResolved(values map[string]interface{}) {
+	remaining := r.pending[:0]
+	for _, name := range r.pending {
+		if _, ok := values[name]; !ok {
+			remaining = append(remaining, name)
+		}
+	}
+	r.pending = remaining
+}
+
+// resolveVars evaluates the vars that have become available
+func (c *TemplateContext) resolveVars() error {
+	if c.vars == nil {
+		return nil
+	}
+	return c.vars.resolveReady(c)
+}
+
+// ready reports whether everything a var refers to is available
+func (r *varResolver) ready(name string, templateCtx *TemplateContext) bool {
+	for _, node := range r.nodeDeps[name] {
+		if _, ok := templateCtx.Nodes[node]; !ok {
+			return false
+		}
+	}
+	for _, dep := range r.varDeps[name] {
+		if _, ok := templateCtx.Vars[dep]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// templateRefs lists the vars and nodes a template refers to. An empty var
+// name stands for a reference to .Vars as a whole.
+type templateRefs struct {
+	vars  []string
+	nodes []string
+}
+
+// templateReferences finds the .Vars.<name> and .Nodes.<id> references in a
+// value, templated the same way node inputs are, and the vars.<name> and
+// nodes.<id> references of its expressions
+func templateReferences(value interface{}) (templateRefs, error) {
+	var refs templateRefs
+
+	value, sources, err := extractExpressions(value, nil)
+	if err != nil {
+		return refs, err
+	}
+	for _, source := range sources {
+		paths, err := expressionPaths(source)
+		if err != nil {
+			return refs, fmt.Errorf("failed to parse expression: %w", err)
+		}
+		for _, path := range paths {
+			switch path[0] {
+			case "vars":
+				addReference(append([]string{"Vars"}, path[1:]...), &refs)
+			case "nodes":
+				addReference(append([]string{"Nodes"}, path[1:]...), &refs)
+			}
+		}
+	}
+
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return refs, err
+	}
+	tmpl, err := template.New("var").Parse(string(data))
+	if err != nil {
+		return refs, fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			walkTemplate(t.Tree.Root, &refs)
+		}
+	}
+	return refs, nil
+}
+
+// walkTemplate collects the references in a template parse tree
+func walkTemplate(node parse.Node, refs *templateRefs) {
+	if node == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			walkTemplate(child, refs)
+		}
+	case *parse.ActionNode:
+		walkTemplate(n.Pipe, refs)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			walkTemplate(cmd, refs)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			walkTemplate(arg, refs)
+		}
+	case *parse.IfNode:
+		walkBranch(&n.BranchNode, refs)
+	case *parse.RangeNode:
+		walkBranch(&n.BranchNode, refs)
+	case *parse.WithNode:
+		walkBranch(&n.BranchNode, refs)
+	case *parse.TemplateNode:
+		walkTemplate(n.Pipe, refs)
+	case *parse.ChainNode:
+		walkTemplate(n.Node, refs)
+	case *parse.FieldNode:
+		addReference(n.Ident, refs)
+	case *parse.VariableNode:
+		// $.Vars.name refers to the root context
+		if len(n.Ident) > 0 && n.Ident[0] == "$" {
+			addReference(n.Ident[1:], refs)
+		}
+	}
+}
+
+func walkBranch(n *parse.BranchNode, refs *templateRefs) {
+	walkTemplate(n.Pipe, refs)
+	walkTemplate(n.List, refs)
+	walkTemplate(n.ElseList, refs)
+}
+
+// addReference records a field chain such as Vars.name or Nodes.id.Output
+func addReference(ident []string, refs *templateRefs) {
+	if len(ident) == 0 {
+		return
+	}
+	switch ident[0] {
+	case "Vars":
+		if len(ident) > 1 {
+			refs.vars = append(refs.vars, ident[1])
+		} else {
+			refs.vars = append(refs.vars, "")
+		}
+	case "Nodes":
+		if len(ident) > 1 {
+			refs.nodes = append(refs.nodes, ident[1])
+		}
+	}
+}
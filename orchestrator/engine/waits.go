@@ -0,0 +1,577 @@
+package engine
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"time"
+)
+
+// Built-in nodes that wait without running an action:
+//
+//	sleep:          duration (e.g. 2h) or until (RFC 3339 time)
+//	wait_for_event: event name, optional correlation_id, timeout and
+//	                on_timeout (fail, the default, or continue)
+//
+// Sleeps ending within maxInProcessWait are waited out in process. Longer
+// sleeps, events and approvals (see approvalNodeType) suspend the run: its
+// state is saved in the state store and the process is free to exit. The run
+// continues with Resume, which the orchestrator's `resume` command and server
+// call once the wait is over.
+const (
+	sleepNodeType = "sleep"
+	eventNodeType = "wait_for_event"
+)
+
+// maxInProcessWait is the longest sleep that does not suspend the run
+const maxInProcessWait = time.Minute
+
+// pendingEventTTL is how long an event with a correlation ID that no run was
+// waiting for is kept for a run that starts waiting for it later
+const pendingEventTTL = 24 * time.Hour
+
+// WaitState describes what a suspended run is waiting for
+type WaitState struct {
+	Node          string `yaml:"node" json:"node"`
+	Type          string `yaml:"type" json:"type"`
+	WakeAt        string `yaml:"wake_at,omitempty" json:"wake_at,omitempty"` // Sleeps
+	Event         string `yaml:"event,omitempty" json:"event,omitempty"`
+	CorrelationID string `yaml:"correlation_id,omitempty" json:"correlation_id,omitempty"`
+	TimeoutAt     string `yaml:"timeout_at,omitempty" json:"timeout_at,omitempty"`
+	OnTimeout     string `yaml:"on_timeout,omitempty" json:"on_timeout,omitempty"`
+	Default       string `yaml:"default,omitempty" json:"default,omitempty"`     // Approvals: decision taken on timeout
+	OnReject      string `yaml:"on_reject,omitempty" json:"on_reject,omitempty"` // Approvals
+}
+
+// SuspendedRun is the saved state of a run waiting at a wait node
+type SuspendedRun struct {
+	RunID       string                 `yaml:"run_id"`
+	Workflow    string                 `yaml:"workflow"`
+	SuspendedAt string                 `yaml:"suspended_at"`
+	NodeIndex   int                    `yaml:"node_index"` // Index of the wait node in the workflow's nodes
+	Wait        WaitState              `yaml:"wait"`
+	Data        map[string]interface{} `yaml:"workflow_data"`
+	Nodes       map[string]NodeOutput  `yaml:"nodes"`
+	Vars        map[string]interface{} `yaml:"vars"`
+	Workspace   string                 `yaml:"workspace"`
+}
+
+// EventDelivery is an event received for a waiting node
+type EventDelivery struct {
+	Event         string      `yaml:"event"`
+	CorrelationID string      `yaml:"correlation_id,omitempty"`
+	Payload       interface{} `yaml:"payload,omitempty"`
+	ReceivedAt    string      `yaml:"received_at"`
+}
+
+// suspension is returned by a wait node that cannot complete now
+type suspension struct {
+	wait  WaitState
+	index int
+}
+
+func (s *suspension) Error() string {
+	return fmt.Sprintf("run suspended at node %s", s.wait.Node)
+}
+
+func (s *suspension) Is(target error) bool {
+	return target == ErrSuspended
+}
+
+// ErrNotWaiting is returned when resuming a run that is not suspended
+var ErrNotWaiting = errors.New("run is not waiting")
+
+// isWaitNode reports whether a node is a built-in node that can suspend the
+// run: a wait node or an approval
+func isWaitNode(node NodeV1) bool {
+	return node.Type == sleepNodeType || node.Type == eventNodeType || node.Type == approvalNodeType
+}
+
+// describe explains what the wait is for, for log messages
+func (w WaitState) describe() string {
+	switch w.Type {
+	case sleepNodeType:
+		return "until " + w.WakeAt
+	case approvalNodeType:
+		if w.TimeoutAt != "" {
+			return "for approval until " + w.TimeoutAt
+		}
+		return "for approval"
+	default:
+		description := "for event " + w.Event
+		if w.CorrelationID != "" {
+			description += " (" + w.CorrelationID + ")"
+		}
+		if w.TimeoutAt != "" {
+			description += " until " + w.TimeoutAt
+		}
+		return description
+	}
+}
+
+// due reports whether a suspended wait can complete now
+func (e *Engine) due(w WaitState, runID string, now time.Time) bool {
+	switch w.Type {
+	case sleepNodeType:
+		return !now.Before(parseTime(w.WakeAt))
+	case approvalNodeType:
+		if decision, _ := e.readDecision(runID, w.Node); decision != nil {
+			return true
+		}
+	default:
+		if delivery, _ := e.readEvent(runID, w.Node); delivery != nil {
+			return true
+		}
+		if pending, _ := e.readPendingEvent(w.Event, w.CorrelationID); pending != nil {
+			return true
+		}
+	}
+	return w.TimeoutAt != "" && !now.Before(parseTime(w.TimeoutAt))
+}
+
+// parseTime parses an RFC 3339 time from a state file; unreadable times are
+// treated as already passed
+func parseTime(value string) time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// newWaitState resolves the inputs of a wait node into the state to wait for
+func newWaitState(node NodeV1, templateCtx *TemplateContext) (WaitState, error) {
+	wait := WaitState{Node: node.ID, Type: node.Type}
+
+	inputs, err := resolveTemplates(node.InputsFromWorkflow, templateCtx)
+	if err != nil {
+		return wait, fmt.Errorf("failed to resolve templates: %w", err)
+	}
+	input := func(name string) string {
+		if value, ok := inputs[name]; ok && value != nil {
+			return fmt.Sprint(value)
+		}
+		return ""
+	}
+
+	now := time.Now().UTC()
+	switch node.Type {
+	case sleepNodeType:
+		duration, until := input("duration"), input("until")
+		switch {
+		case duration != "" && until != "":
+			return wait, fmt.Errorf("sleep takes either duration or until, not both")
+		case duration != "":
+			d, err := time.ParseDuration(duration)
+			if err != nil || d < 0 {
+				return wait, fmt.Errorf("invalid duration %q: must be a duration such as 90s or 2h", duration)
+			}
+			wait.WakeAt = now.Add(d).Format(time.RFC3339)
+		case until != "":
+			t, err := time.Parse(time.RFC3339, until)
+			if err != nil {
+				return wait, fmt.Errorf("invalid until %q: must be an RFC 3339 time", until)
+			}
+			wait.WakeAt = t.UTC().Format(time.RFC3339)
+		default:
+			return wait, fmt.Errorf("sleep requires duration or until")
+		}
+
+	case eventNodeType:
+		wait.Event = input("event")
+		if wait.Event == "" {
+			return wait, fmt.Errorf("wait_for_event requires event")
+		}
+		wait.CorrelationID = input("correlation_id")
+		if timeout := input("timeout"); timeout != "" {
+			d, err := time.ParseDuration(timeout)
+			if err != nil || d <= 0 {
+				return wait, fmt.Errorf("invalid timeout %q: must be a positive duration such as 30m or 12h", timeout)
+			}
+			wait.TimeoutAt = now.Add(d).Format(time.RFC3339)
+		}
+		wait.OnTimeout = input("on_timeout")
+		if wait.OnTimeout != "" && wait.OnTimeout != "fail" && wait.OnTimeout != "continue" {
+			return wait, fmt.Errorf("invalid on_timeout %q: must be fail or continue", wait.OnTimeout)
+		}
+	}
+	return wait, nil
+}
+
+// executeWait completes a wait node if its wait is over, sleeping in process
+// when that takes at most maxInProcessWait, and otherwise returns a
+// suspension. A resumed run continues the wait it was suspended at.
+func (e *Engine) executeWait(ctx context.Context, node NodeV1, templateCtx *TemplateContext) (map[string]interface{}, error) {
+	var wait WaitState
+	if resumed := templateCtx.resumed; resumed != nil && resumed.Node == node.ID {
+		wait = *resumed
+	} else {
+		var err error
+		if wait, err = newWaitState(node, templateCtx); err != nil {
+			return nil, err
+		}
+	}
+
+	if wait.Type == sleepNodeType {
+		remaining := time.Until(parseTime(wait.WakeAt))
+		if remaining > maxInProcessWait {
+			return nil, &suspension{wait: wait}
+		}
+		if remaining > 0 {
+			timer := time.NewTimer(remaining)
+			defer timer.Stop()
+			select {
+			case <-ctx.Done():
+				return nil, fmt.Errorf("sleep cancelled: %w", context.Cause(ctx))
+			case <-timer.C:
+			}
+		}
+		return map[string]interface{}{
+			"slept_until": wait.WakeAt,
+			"woke_at":     time.Now().UTC().Format(time.RFC3339),
+		}, nil
+	}
+
+	delivery, err := e.readEvent(templateCtx.Run.ID, node.ID)
+	if err != nil {
+		return nil, err
+	}
+	if delivery == nil {
+		// The event may have been posted before the run got here
+		if delivery, err = e.claimPendingEvent(templateCtx.Run.ID, wait); err != nil {
+			return nil, err
+		}
+	}
+	if delivery != nil {
+		return map[string]interface{}{
+			"event":          delivery.Event,
+			"correlation_id": delivery.CorrelationID,
+			"payload":        delivery.Payload,
+			"received_at":    delivery.ReceivedAt,
+			"timed_out":      false,
+		}, nil
+	}
+
+	if wait.TimeoutAt != "" && !time.Now().Before(parseTime(wait.TimeoutAt)) {
+		if wait.OnTimeout != "continue" {
+			return nil, fmt.Errorf("timed out waiting for event %s", wait.Event)
+		}
+		return map[string]interface{}{
+			"event":          wait.Event,
+			"correlation_id": wait.CorrelationID,
+			"timed_out":      true,
+		}, nil
+	}
+
+	return nil, &suspension{wait: wait}
+}
+
+// suspendedKey returns the state key of a suspended run
+func suspendedKey(runID string) string {
+	return runKey(runID, "suspended.yaml")
+}
+
+// workflowSnapshotKey returns the copy of the workflow a suspended run
+// resumes with, so that later edits of the workflow file do not affect it
+func workflowSnapshotKey(runID string) string {
+	return runKey(runID, "workflow.yaml")
+}
+
+// eventKey returns the key holding the event delivered to a waiting node
+func eventKey(runID, node string) string {
+	return runKey(runID, "events/"+node+".yaml")
+}
+
+// pendingEventKey returns the key holding an event with a correlation ID that
+// no run was waiting for
+func pendingEventKey(name, correlationID string) string {
+	sum := sha256.Sum256([]byte(name + "\x00" + correlationID))
+	return "events/pending/" + hex.EncodeToString(sum[:]) + ".yaml"
+}
+
+// pendingEventsLock serializes claiming pending events, so that each is
+// delivered to one run
+const pendingEventsLock = "events/pending.lock"
+
+// suspendRun saves what is needed to resume the run at its wait node
+func (e *Engine) suspendRun(workflow *WorkflowV1, record *RunRecord, templateCtx *TemplateContext, suspended *suspension) error {
+	if err := e.Store.Write(workflowSnapshotKey(record.ID), workflow); err != nil {
+		return fmt.Errorf("failed to suspend run: %w", err)
+	}
+
+	state := SuspendedRun{
+		RunID:       record.ID,
+		Workflow:    workflow.Name,
+		SuspendedAt: time.Now().UTC().Format(time.RFC3339),
+		NodeIndex:   suspended.index,
+		Wait:        suspended.wait,
+		Data:        templateCtx.WorkflowData,
+		Nodes:       templateCtx.Nodes,
+		Vars:        templateCtx.Vars,
+		Workspace:   templateCtx.Run.Workspace,
+	}
+	if err := e.Store.Write(suspendedKey(record.ID), state); err != nil {
+		return fmt.Errorf("failed to suspend run: %w", err)
+	}
+
+	record.Status = RunWaiting
+	record.saveOrWarn()
+	e.Logger.Printf("Run %s suspended at node %s, waiting %s %s", record.ID, suspended.wait.Node, suspended.wait.describe(), statusINFO)
+	return nil
+}
+
+// loadSuspendedRun reads the state of a suspended run
+func (e *Engine) loadSuspendedRun(runID string) (*SuspendedRun, error) {
+	var state SuspendedRun
+	if err := e.Store.Read(suspendedKey(runID), &state); err != nil {
+		return nil, err
+	}
+	if state.RunID == "" {
+		return nil, fmt.Errorf("run %s: %w", runID, ErrNotWaiting)
+	}
+	return &state, nil
+}
+
+// removeSuspendedRun deletes the saved state of a run that has finished
+func (e *Engine) removeSuspendedRun(runID string) {
+	if err := e.Store.Delete(suspendedKey(runID)); err != nil {
+		e.Logger.Printf("Failed to remove suspended state of run %s: %v %s", runID, err, statusWARN)
+	}
+}
+
+// Resume continues a suspended run at its wait node. A run whose wait is not
+// over yet is left suspended with status RunWaiting and an error matching
+// ErrSuspended; a run already being resumed by another process is an error.
+func (e *Engine) Resume(ctx context.Context, runID string) (Result, error) {
+	unlock, err := e.Store.Lock(runKey(runID, "resume.lock"))
+	if err != nil {
+		return Result{RunID: runID}, fmt.Errorf("run %s is already being resumed: %w", runID, err)
+	}
+	defer unlock()
+
+	state, err := e.loadSuspendedRun(runID)
+	if err != nil {
+		return Result{RunID: runID}, err
+	}
+	if !e.due(state.Wait, runID, time.Now()) {
+		return Result{RunID: runID, Status: RunWaiting}, &suspension{wait: state.Wait, index: state.NodeIndex}
+	}
+
+	var workflow WorkflowV1
+	if err := e.Store.Read(workflowSnapshotKey(runID), &workflow); err != nil {
+		return Result{RunID: runID}, err
+	}
+	if state.NodeIndex >= len(workflow.Nodes) || workflow.Nodes[state.NodeIndex].ID != state.Wait.Node {
+		return Result{RunID: runID}, fmt.Errorf("run %s: saved workflow does not match its suspended state", runID)
+	}
+
+	record, err := e.LoadRun(runID)
+	if err != nil || record == nil {
+		record = &RunRecord{ID: runID, Workflow: workflow.Name, StartedAt: state.SuspendedAt, engine: e}
+	}
+
+	// The wait node is recorded again once it completes
+	nodes := record.Nodes[:0]
+	for _, node := range record.Nodes {
+		if node.Status != NodeWaiting {
+			nodes = append(nodes, node)
+		}
+	}
+	record.Nodes = nodes
+	record.Status = RunRunning
+	record.saveOrWarn()
+	e.Logger.Printf("Resuming run %s of %s at node %s %s", runID, workflow.Name, state.Wait.Node, statusINFO)
+
+	if state.Nodes == nil {
+		state.Nodes = make(map[string]NodeOutput)
+	}
+	if state.Vars == nil {
+		state.Vars = make(map[string]interface{})
+	}
+	templateCtx := &TemplateContext{
+		WorkflowData: state.Data,
+		Nodes:        state.Nodes,
+		Vars:         state.Vars,
+		Run:          RunInfo{ID: runID, Status: RunRunning, Workspace: state.Workspace},
+		resumed:      &state.Wait,
+	}
+	err = e.run(ctx, &workflow, record, templateCtx, state.NodeIndex)
+	return newResult(record, templateCtx), err
+}
+
+// SuspendedRuns lists the suspended runs, optionally of one workflow, oldest
+// first
+func (e *Engine) SuspendedRuns(workflow string) ([]SuspendedRun, error) {
+	keys, err := e.Store.List("runs/*/suspended.yaml")
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []SuspendedRun
+	for _, key := range keys {
+		var state SuspendedRun
+		if err := e.Store.Read(key, &state); err != nil || state.RunID == "" {
+			continue
+		}
+		if workflow != "" && state.Workflow != workflow {
+			continue
+		}
+		runs = append(runs, state)
+	}
+
+	sort.Slice(runs, func(i, j int) bool { return runs[i].SuspendedAt < runs[j].SuspendedAt })
+	return runs, nil
+}
+
+// DueRuns returns the IDs of suspended runs whose wait is over, optionally of
+// one workflow
+func (e *Engine) DueRuns(workflow string) ([]string, error) {
+	runs, err := e.SuspendedRuns(workflow)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var due []string
+	for _, state := range runs {
+		if e.due(state.Wait, state.RunID, now) {
+			due = append(due, state.RunID)
+		}
+	}
+	return due, nil
+}
+
+// readEvent returns the event delivered to a waiting node, or nil
+func (e *Engine) readEvent(runID, node string) (*EventDelivery, error) {
+	var delivery EventDelivery
+	if err := e.Store.Read(eventKey(runID, node), &delivery); err != nil {
+		return nil, err
+	}
+	if delivery.Event == "" {
+		return nil, nil
+	}
+	return &delivery, nil
+}
+
+// readPendingEvent returns the pending event with a name and correlation ID,
+// or nil if there is none or it has expired
+func (e *Engine) readPendingEvent(name, correlationID string) (*EventDelivery, error) {
+	if correlationID == "" {
+		return nil, nil
+	}
+
+	var delivery EventDelivery
+	if err := e.Store.Read(pendingEventKey(name, correlationID), &delivery); err != nil {
+		return nil, err
+	}
+	if delivery.Event != name || delivery.CorrelationID != correlationID {
+		return nil, nil
+	}
+	if time.Since(parseTime(delivery.ReceivedAt)) > pendingEventTTL {
+		return nil, nil
+	}
+	return &delivery, nil
+}
+
+// claimPendingEvent delivers the pending event a wait with a correlation ID
+// is waiting for to its node, and returns it, or nil if there is none
+func (e *Engine) claimPendingEvent(runID string, wait WaitState) (*EventDelivery, error) {
+	if wait.CorrelationID == "" {
+		return nil, nil
+	}
+
+	unlock, err := e.Store.Lock(pendingEventsLock)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	key := pendingEventKey(wait.Event, wait.CorrelationID)
+	delivery, err := e.readPendingEvent(wait.Event, wait.CorrelationID)
+	if err != nil {
+		return nil, err
+	}
+	if delivery == nil {
+		// Drop an expired event
+		return nil, e.Store.Delete(key)
+	}
+
+	if err := e.Store.Create(eventKey(runID, wait.Node), *delivery); err != nil && !errors.Is(err, fs.ErrExist) {
+		return nil, fmt.Errorf("failed to deliver event to run %s: %w", runID, err)
+	}
+	if err := e.Store.Delete(key); err != nil {
+		return nil, err
+	}
+	e.Logger.Printf("Run %s received event %s (%s) posted before it was waiting %s", runID, wait.Event, wait.CorrelationID, statusINFO)
+	return e.readEvent(runID, wait.Node)
+}
+
+// DeliverEvent hands an event to every suspended run waiting for it with a
+// matching correlation ID; a node without a correlation ID accepts any. It
+// returns the IDs of the runs that received the event. A node keeps the
+// first event delivered to it.
+//
+// An event with a correlation ID that no run received is kept for
+// pendingEventTTL, and goes to the first run that starts waiting for it with
+// that correlation ID, so that events posted before their run got to its
+// wait_for_event node are not lost. Only the first such event is kept.
+func (e *Engine) DeliverEvent(name, correlationID string, payload interface{}) ([]string, error) {
+	runs, err := e.SuspendedRuns("")
+	if err != nil {
+		return nil, err
+	}
+
+	delivery := EventDelivery{
+		Event:         name,
+		CorrelationID: correlationID,
+		Payload:       payload,
+		ReceivedAt:    time.Now().UTC().Format(time.RFC3339),
+	}
+	var delivered []string
+	for _, state := range runs {
+		wait := state.Wait
+		if wait.Type != eventNodeType || wait.Event != name {
+			continue
+		}
+		if wait.CorrelationID != "" && wait.CorrelationID != correlationID {
+			continue
+		}
+
+		if err := e.Store.Create(eventKey(state.RunID, wait.Node), delivery); err != nil {
+			if errors.Is(err, fs.ErrExist) {
+				continue
+			}
+			return delivered, fmt.Errorf("failed to deliver event to run %s: %w", state.RunID, err)
+		}
+		delivered = append(delivered, state.RunID)
+	}
+
+	if len(delivered) == 0 && correlationID != "" {
+		if err := e.storePendingEvent(delivery); err != nil {
+			return nil, err
+		}
+	}
+	return delivered, nil
+}
+
+// storePendingEvent keeps an event for a run that is not waiting for it yet,
+// replacing an expired one
+func (e *Engine) storePendingEvent(delivery EventDelivery) error {
+	unlock, err := e.Store.Lock(pendingEventsLock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if pending, err := e.readPendingEvent(delivery.Event, delivery.CorrelationID); err != nil || pending != nil {
+		return err
+	}
+	if err := e.Store.Write(pendingEventKey(delivery.Event, delivery.CorrelationID), delivery); err != nil {
+		return fmt.Errorf("failed to store event %s: %w", delivery.Event, err)
+	}
+	return nil
+}
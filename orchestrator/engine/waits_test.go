@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// loadTestWorkflow loads a workflow from its YAML into e
+func loadTestWorkflow(t *testing.T, e *Engine, workflow string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "workflow.yaml")
+	if err := os.WriteFile(path, []byte(workflow), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Load(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+const eventWorkflow = `version: "1"
+name: wait-for-event
+nodes:
+  - id: signed
+    type: wait_for_event
+    inputs_from_workflow:
+      event: order_signed
+      correlation_id: "{{.WorkflowData.order_id}}"
+`
+
+func TestEventBeforeWait(t *testing.T) {
+	old := time.Now().Add(-2 * pendingEventTTL).UTC().Format(time.RFC3339)
+	tests := []struct {
+		name          string
+		correlationID string
+		receivedAt    string // Stores the pending event directly when set
+		wantDelivered bool
+	}{
+		{name: "correlated event is kept", correlationID: "order-1", wantDelivered: true},
+		{name: "other correlation ID", correlationID: "order-2"},
+		{name: "uncorrelated event is dropped"},
+		{name: "expired event", correlationID: "order-1", receivedAt: old},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := testEngine(t)
+			loadTestWorkflow(t, e, eventWorkflow)
+
+			payload := map[string]interface{}{"signer": "alice"}
+			if tt.receivedAt != "" {
+				pending := EventDelivery{Event: "order_signed", CorrelationID: tt.correlationID, Payload: payload, ReceivedAt: tt.receivedAt}
+				if err := e.Store.Write(pendingEventKey(pending.Event, pending.CorrelationID), pending); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				runIDs, err := e.DeliverEvent("order_signed", tt.correlationID, payload)
+				if err != nil || len(runIDs) != 0 {
+					t.Fatalf("DeliverEvent = %v, %v; want no runs", runIDs, err)
+				}
+			}
+
+			result, err := e.Run(context.Background(), map[string]interface{}{"order_id": "order-1"})
+			if !tt.wantDelivered {
+				if !errors.Is(err, ErrSuspended) {
+					t.Fatalf("Run error = %v, want the run suspended", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			output := result.Nodes["signed"].Output
+			if output["correlation_id"] != "order-1" || output["timed_out"] != false {
+				t.Errorf("output = %v, want the order-1 event", output)
+			}
+			if p, _ := output["payload"].(map[string]interface{}); p["signer"] != "alice" {
+				t.Errorf("payload = %v, want the posted payload", output["payload"])
+			}
+
+			// The event went to this run; the next one waits for a new event
+			if _, err := e.Run(context.Background(), map[string]interface{}{"order_id": "order-1"}); !errors.Is(err, ErrSuspended) {
+				t.Errorf("second run error = %v, want the run suspended", err)
+			}
+		})
+	}
+}
+
+func TestEventWhileSuspending(t *testing.T) {
+	e := testEngine(t)
+	loadTestWorkflow(t, e, eventWorkflow)
+
+	result, err := e.Run(context.Background(), map[string]interface{}{"order_id": "order-1"})
+	if !errors.Is(err, ErrSuspended) {
+		t.Fatalf("Run error = %v, want the run suspended", err)
+	}
+
+	// An event stored as pending while the run was suspending makes it due
+	pending := EventDelivery{Event: "order_signed", CorrelationID: "order-1", ReceivedAt: time.Now().UTC().Format(time.RFC3339)}
+	if err := e.storePendingEvent(pending); err != nil {
+		t.Fatal(err)
+	}
+	due, err := e.DueRuns("")
+	if err != nil || len(due) != 1 || due[0] != result.RunID {
+		t.Fatalf("DueRuns = %v, %v; want [%s]", due, err, result.RunID)
+	}
+
+	resumed, err := e.Resume(context.Background(), result.RunID)
+	if err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	if resumed.Status != RunSucceeded {
+		t.Errorf("status = %s, want %s", resumed.Status, RunSucceeded)
+	}
+}
@@ -0,0 +1,260 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/experimental"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/yaml.v3"
+)
+
+// wasmPageBytes is the size of a page of WebAssembly linear memory
+const wasmPageBytes = 64 << 10
+
+// defaultWasmTimeout limits the run time of modules whose sandbox does not
+// set cpu_seconds. Fuel only counts function calls, so without it a loop
+// that makes none would run forever.
+const defaultWasmTimeout = 60 * time.Second
+
+// Why a WebAssembly action was stopped before it exited
+var (
+	errWasmOutOfFuel      = errors.New("action ran out of fuel")
+	errWasmOutputExceeded = errors.New("action output exceeded max_output_bytes")
+	errWasmTimeout        = errors.New("action exceeded cpu_seconds")
+)
+
+// WasmRunner runs actions compiled to WebAssembly (WASI preview 1) with an
+// embedded runtime and hands every other action to Next. Modules get the YAML
+// input on stdin and write their output to stdout like native actions, but
+// see only the environment and directories their node grants them.
+type WasmRunner struct {
+	Logger   Logger
+	Next     ActionRunner
+	CacheDir string // Keeps compiled modules between runs; empty caches them in memory
+
+	cacheOnce sync.Once
+	cache     wazero.CompilationCache
+}
+
+// RunAction runs the request's action if it is a WebAssembly module. The
+// request's sandbox policy limits its memory, run time and fuel, and its
+// filesystem allowlists become the module's preopened directories.
+func (r *WasmRunner) RunAction(ctx context.Context, req ActionRequest) (map[string]interface{}, error) {
+	if !isWasmAction(req.Path) {
+		return r.Next.RunAction(ctx, req)
+	}
+
+	logger := req.logger(r.Logger)
+
+	binary, err := os.ReadFile(req.Path)
+	if err != nil {
+		return nil, fmt.Errorf("action failed to start: %w", err)
+	}
+
+	var limits SandboxRLimitsV1
+	if req.SandboxPolicy != nil {
+		limits = req.SandboxPolicy.RLimits
+	}
+	if limits.CPUSeconds == 0 {
+		limits.CPUSeconds = uint64(defaultWasmTimeout / time.Second)
+	}
+
+	runCtx, span := tracer.Start(ctx, "wasm.run", trace.WithAttributes(
+		attrActionType.String(req.Type),
+		attribute.String("process.executable.path", req.Path),
+	))
+	defer span.End()
+
+	// Limits stop the module through its context, with the limit as cause
+	runCtx, cancel := context.WithCancelCause(runCtx)
+	defer cancel(nil)
+	runCtx, cancelTimeout := context.WithTimeoutCause(runCtx, time.Duration(limits.CPUSeconds)*time.Second, errWasmTimeout)
+	defer cancelTimeout()
+	if limits.Fuel > 0 {
+		runCtx = context.WithValue(runCtx, wasmFuelKey{}, &wasmFuel{limit: limits.Fuel, cancel: cancel})
+		runCtx = experimental.WithFunctionListenerFactory(runCtx, wasmFuelListener{})
+	}
+
+	config := wazero.NewRuntimeConfig().
+		WithCompilationCache(r.compilationCache(logger)).
+		WithCloseOnContextDone(true)
+	if limits.MemoryBytes > 0 {
+		config = config.WithMemoryLimitPages(uint32(min(limits.MemoryBytes/wasmPageBytes, 1<<16)))
+	}
+	runtime := wazero.NewRuntimeWithConfig(runCtx, config)
+	defer runtime.Close(context.Background())
+
+	if _, err := wasi_snapshot_preview1.Instantiate(runCtx, runtime); err != nil {
+		endSpan(span, err)
+		return nil, fmt.Errorf("action failed to start: %w", err)
+	}
+	compiled, err := runtime.CompileModule(runCtx, binary)
+	if err != nil {
+		endSpan(span, err)
+		return nil, fmt.Errorf("action failed to start: invalid WebAssembly module: %w", err)
+	}
+
+	stdout := &limitedBuffer{limit: req.MaxOutputBytes}
+	stderr := &limitedBuffer{limit: maxStderrBytes}
+	if !req.TruncateOutput {
+		stdout.onExceed = func() {
+			logger.Printf("Action %s exceeded max_output_bytes (%d), stopping it %s", req.Type, req.MaxOutputBytes, statusFAILED)
+			cancel(errWasmOutputExceeded)
+		}
+	}
+
+	module := wazero.NewModuleConfig().
+		WithName(req.Type).
+		WithArgs(req.Type).
+		WithStdin(bytes.NewReader(req.Input)).
+		WithStdout(stdout).
+		WithStderr(stderr).
+		WithSysWalltime().
+		WithSysNanotime().
+		WithSysNanosleep().
+		WithRandSource(rand.Reader).
+		WithFSConfig(wasmFSConfig(req.sandbox))
+	for _, entry := range withTraceEnv(runCtx, req.Env) {
+		if name, value, ok := strings.Cut(entry, "="); ok {
+			module = module.WithEnv(name, value)
+		}
+	}
+
+	// Instantiating runs the module's _start function to completion
+	instance, err := runtime.InstantiateModule(runCtx, compiled, module)
+	if instance != nil {
+		instance.Close(context.Background())
+	}
+	exitCode := 0
+	var exitErr *sys.ExitError
+	if errors.As(err, &exitErr) {
+		exitCode = int(exitErr.ExitCode())
+		err = nil
+		if exitCode != 0 {
+			err = fmt.Errorf("exit status %d", exitCode)
+		}
+	}
+	span.SetAttributes(attrExitCode.Int(exitCode))
+	trace.SpanFromContext(ctx).SetAttributes(attrExitCode.Int(exitCode))
+	endSpan(span, err)
+
+	if stderr.Len() > 0 {
+		if err != nil || runCtx.Err() != nil {
+			logger.Printf("Action stderr output: %s %s", stderr.String(), statusWARN)
+		} else {
+			logger.Printf("Action stderr: %s %s", stderr.String(), statusINFO)
+		}
+	}
+
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("action cancelled: %w", context.Cause(ctx))
+	}
+	switch cause := context.Cause(runCtx); {
+	case errors.Is(cause, errWasmOutOfFuel):
+		return nil, fmt.Errorf("%w (fuel %d)", cause, limits.Fuel)
+	case errors.Is(cause, errWasmTimeout):
+		return nil, fmt.Errorf("%w (%d seconds)", cause, limits.CPUSeconds)
+	case errors.Is(cause, errWasmOutputExceeded):
+		return nil, fmt.Errorf("action output exceeded max_output_bytes of %d bytes", req.MaxOutputBytes)
+	}
+
+	if err != nil {
+		// Failing actions usually still report why on stdout
+		var failure ActionError
+		if yaml.Unmarshal(stdout.Bytes(), &failure) == nil && failure.Error != "" {
+			return nil, fmt.Errorf("action failed: %w: %s", err, failure.Error)
+		}
+		return nil, fmt.Errorf("action failed: %w", err)
+	}
+
+	return parseActionOutput(ctx, logger, req, stdout.Bytes(), stdout.Exceeded())
+}
+
+// Close releases the compiled modules held in memory and closes Next if it
+// can be closed
+func (r *WasmRunner) Close() error {
+	if r.cache != nil {
+		r.cache.Close(context.Background())
+	}
+	if closer, ok := r.Next.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// compilationCache returns the cache shared by the runner's runtimes
+func (r *WasmRunner) compilationCache(logger Logger) wazero.CompilationCache {
+	r.cacheOnce.Do(func() {
+		if r.CacheDir != "" {
+			cache, err := wazero.NewCompilationCacheWithDir(r.CacheDir)
+			if err == nil {
+				r.cache = cache
+				return
+			}
+			logger.Printf("Caching compiled WebAssembly actions in memory only: %v %s", err, statusWARN)
+		}
+		r.cache = wazero.NewCompilationCache()
+	})
+	return r.cache
+}
+
+// wasmFSConfig preopens the directories a sandbox policy allows, at their
+// host paths. Modules without a filesystem policy get no directory at all.
+func wasmFSConfig(spec *sandboxSpec) wazero.FSConfig {
+	config := wazero.NewFSConfig()
+	if spec == nil {
+		return config
+	}
+	for _, dir := range spec.Read {
+		config = config.WithReadOnlyDirMount(dir, dir)
+	}
+	for _, dir := range spec.Write {
+		config = config.WithDirMount(dir, dir)
+	}
+	return config
+}
+
+// wasmFuel counts the function calls of one module run
+type wasmFuel struct {
+	used   atomic.Uint64
+	limit  uint64
+	cancel context.CancelCauseFunc
+}
+
+type wasmFuelKey struct{}
+
+// wasmFuelListener burns a unit of the run's fuel per function call. Loops
+// are not metered, so fuel bounds the calls a module makes and its run time
+// limit bounds the rest. The listener finds the meter in the call's context
+// rather than holding it, since compiled modules and their listeners are
+// shared between runs.
+type wasmFuelListener struct{}
+
+func (wasmFuelListener) NewFunctionListener(api.FunctionDefinition) experimental.FunctionListener {
+	return wasmFuelListener{}
+}
+
+func (wasmFuelListener) Before(ctx context.Context, _ api.Module, _ api.FunctionDefinition, _ []uint64, _ experimental.StackIterator) {
+	if fuel, ok := ctx.Value(wasmFuelKey{}).(*wasmFuel); ok && fuel.used.Add(1) == fuel.limit+1 {
+		fuel.cancel(errWasmOutOfFuel)
+	}
+}
+
+func (wasmFuelListener) After(context.Context, api.Module, api.FunctionDefinition, []uint64) {}
+
+func (wasmFuelListener) Abort(context.Context, api.Module, api.FunctionDefinition, error) {}
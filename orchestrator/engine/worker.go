@@ -0,0 +1,565 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WorkerV1 is the worker section of an action manifest. An action declaring
+// it is started once and serves many requests over stdin/stdout, so it can
+// keep connections and other expensive state between nodes.
+type WorkerV1 struct {
+	Protocol    string `yaml:"protocol"`               // Framing of requests; only ndjson so far
+	Concurrency int    `yaml:"concurrency,omitempty"`  // Requests one worker handles at once, default 1
+	IdleTimeout string `yaml:"idle_timeout,omitempty"` // Stop the worker after this long without requests, default 1m
+}
+
+// The worker protocol. The engine starts the action with OCTA_ACTION_PROTOCOL
+// set and waits for a hello frame naming the protocol; actions that do not
+// answer in time are run once per request until a retry after a backoff.
+// Requests and responses are JSON objects on a line of their own, matched by
+// id.
+const (
+	workerProtocolEnv    = "OCTA_ACTION_PROTOCOL"
+	workerProtocolNDJSON = "ndjson"
+
+	defaultWorkerIdleTimeout = time.Minute
+	workerStartTimeout       = 10 * time.Second
+	workerRetryDelay         = 30 * time.Second // After a failed start, doubling up to maxWorkerRetryDelay
+	maxWorkerRetryDelay      = 10 * time.Minute
+
+	// A frame may hold an output of twice the largest max_output_bytes of
+	// the requests in flight, leaving room for JSON escapes, plus this much
+	// for the rest of the frame. A longer line kills the worker.
+	workerFrameOverhead = 64 << 10
+)
+
+var (
+	// errWorkerUnavailable makes the runner fall back to a process per request
+	errWorkerUnavailable = errors.New("action worker unavailable")
+
+	// errWorkerStopped is why a worker that exited cleanly is gone
+	errWorkerStopped = errors.New("exit status 0")
+)
+
+// workerRequest is a frame sent to a worker. A request with Cancel set asks
+// the worker to abandon the request with the same id.
+type workerRequest struct {
+	ID          string `json:"id"`
+	Input       string `json:"input,omitempty"` // YAML, as a one-shot action reads it on stdin
+	Cancel      bool   `json:"cancel,omitempty"`
+	Traceparent string `json:"traceparent,omitempty"`
+	Tracestate  string `json:"tracestate,omitempty"`
+}
+
+// workerResponse is a frame received from a worker
+type workerResponse struct {
+	ID       string `json:"id"`
+	Output   string `json:"output,omitempty"` // YAML, as a one-shot action writes it on stdout
+	Error    string `json:"error,omitempty"`
+	Protocol string `json:"protocol,omitempty"` // Only set in the hello frame
+}
+
+// actionWorker is a running worker process
+type actionWorker struct {
+	key         string
+	actionType  string
+	cmd         *exec.Cmd
+	idleTimeout time.Duration
+	grace       time.Duration // How long the worker may take to exit once stopped
+
+	writeMu sync.Mutex
+	stdin   io.WriteCloser
+
+	slots chan struct{} // Holds a token per request in flight
+
+	mu      sync.Mutex
+	pending map[string]pendingCall
+	nextID  uint64
+
+	done chan struct{} // Closed once the process exited
+	err  error         // Why it exited; set before done is closed
+
+	// Guarded by the runner's workersMu
+	inFlight int
+	idle     *time.Timer
+}
+
+// pendingCall is a request waiting for its response
+type pendingCall struct {
+	reply          chan workerResponse
+	maxOutputBytes int64
+}
+
+// workerStart is a worker being started. It is closed once the worker is in
+// the pool or its start failed.
+type workerStart chan struct{}
+
+// workerBackoff delays the next start of a worker that failed to start
+type workerBackoff struct {
+	until time.Time
+	delay time.Duration
+}
+
+// workerKey identifies the workers a request can be sent to: one started
+// with the same binary, working directory and environment
+func workerKey(req ActionRequest) string {
+	return req.Path + "\x00" + req.Dir + "\x00" + strings.Join(req.Env, "\x00")
+}
+
+// runOnWorker sends a request to the action's worker, starting it if needed.
+// It returns errWorkerUnavailable if the action has to run as a process.
+func (r *ProcessRunner) runOnWorker(ctx context.Context, logger Logger, req ActionRequest) (map[string]interface{}, error) {
+	w, err := r.acquireWorker(ctx, logger, req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.releaseWorker(w)
+
+	ctx, span := tracer.Start(ctx, "worker.request", trace.WithAttributes(
+		attrActionType.String(req.Type),
+		attribute.String("process.executable.path", req.Path),
+		attrPID.Int(w.cmd.Process.Pid),
+	))
+	resp, err := w.call(ctx, req.Input, req.MaxOutputBytes)
+	if err == nil && resp.Error != "" {
+		err = errors.New(resp.Error)
+	}
+	endSpan(span, err)
+
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("action cancelled: %w", context.Cause(ctx))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("action failed: %w", err)
+	}
+
+	data, exceeded, err := limitOutput(req, []byte(resp.Output))
+	if err != nil {
+		return nil, err
+	}
+	return parseActionOutput(ctx, logger, req, data, exceeded)
+}
+
+// acquireWorker returns a running worker for the request and counts the
+// request as in flight. Only one worker per key is started at a time; the
+// other requests for it wait for the start outside the runner's lock.
+func (r *ProcessRunner) acquireWorker(ctx context.Context, logger Logger, req ActionRequest) (*actionWorker, error) {
+	key := workerKey(req)
+
+	for {
+		r.workersMu.Lock()
+		if backoff, ok := r.backoff[key]; ok && time.Now().Before(backoff.until) {
+			r.workersMu.Unlock()
+			return nil, errWorkerUnavailable
+		}
+		if w := r.workers[key]; w != nil && !w.exited() {
+			w.inFlight++
+			if w.idle != nil {
+				w.idle.Stop()
+				w.idle = nil
+			}
+			r.workersMu.Unlock()
+			return w, nil
+		}
+		if start := r.starting[key]; start != nil {
+			r.workersMu.Unlock()
+			select {
+			case <-start:
+				continue
+			case <-ctx.Done():
+				return nil, fmt.Errorf("action cancelled: %w", context.Cause(ctx))
+			}
+		}
+
+		start := make(workerStart)
+		if r.starting == nil {
+			r.starting = make(map[string]workerStart)
+		}
+		r.starting[key] = start
+		r.workersMu.Unlock()
+
+		w, err := r.startWorker(ctx, logger, key, req)
+
+		r.workersMu.Lock()
+		delete(r.starting, key)
+		close(start)
+		switch {
+		case err != nil && ctx.Err() != nil:
+			// Not the worker's fault; the next request tries again
+			r.workersMu.Unlock()
+			return nil, fmt.Errorf("action cancelled: %w", context.Cause(ctx))
+		case err != nil:
+			delay := workerRetryDelay
+			if backoff, ok := r.backoff[key]; ok {
+				delay = min(backoff.delay*2, maxWorkerRetryDelay)
+			}
+			if r.backoff == nil {
+				r.backoff = make(map[string]workerBackoff)
+			}
+			r.backoff[key] = workerBackoff{until: time.Now().Add(delay), delay: delay}
+			r.workersMu.Unlock()
+			logger.Printf("Action %s cannot run as a worker, starting it per request for the next %s: %v %s", req.Type, delay, err, statusWARN)
+			return nil, errWorkerUnavailable
+		}
+		delete(r.backoff, key)
+		if r.workers == nil {
+			r.workers = make(map[string]*actionWorker)
+		}
+		r.workers[key] = w
+		w.inFlight++
+		r.workersMu.Unlock()
+		return w, nil
+	}
+}
+
+// releaseWorker ends a request and schedules the worker's idle stop
+func (r *ProcessRunner) releaseWorker(w *actionWorker) {
+	r.workersMu.Lock()
+	defer r.workersMu.Unlock()
+
+	w.inFlight--
+	if w.inFlight == 0 {
+		w.idle = time.AfterFunc(w.idleTimeout, func() { r.stopIdleWorker(w) })
+	}
+}
+
+// stopIdleWorker stops a worker unless a request arrived in the meantime
+func (r *ProcessRunner) stopIdleWorker(w *actionWorker) {
+	r.workersMu.Lock()
+	if w.inFlight > 0 || r.workers[w.key] != w {
+		r.workersMu.Unlock()
+		return
+	}
+	delete(r.workers, w.key)
+	r.workersMu.Unlock()
+
+	w.stop(w.grace)
+}
+
+// forgetWorker removes a worker whose process exited from the pool
+func (r *ProcessRunner) forgetWorker(w *actionWorker) {
+	r.workersMu.Lock()
+	defer r.workersMu.Unlock()
+
+	if r.workers[w.key] == w {
+		delete(r.workers, w.key)
+	}
+}
+
+// Close stops the action workers. Requests still in flight fail.
+func (r *ProcessRunner) Close() error {
+	r.workersMu.Lock()
+	workers := r.workers
+	r.workers = nil
+	r.workersMu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, w := range workers {
+		wg.Add(1)
+		go func(w *actionWorker) {
+			defer wg.Done()
+			w.stop(w.grace)
+		}(w)
+	}
+	wg.Wait()
+	return nil
+}
+
+// startWorker starts the action in worker mode and waits for its hello frame
+// until ctx is done
+func (r *ProcessRunner) startWorker(ctx context.Context, logger Logger, key string, req ActionRequest) (*actionWorker, error) {
+	if req.Worker.Protocol != workerProtocolNDJSON {
+		return nil, fmt.Errorf("unsupported worker protocol %q", req.Worker.Protocol)
+	}
+
+	w := &actionWorker{
+		key:         key,
+		actionType:  req.Type,
+		idleTimeout: defaultWorkerIdleTimeout,
+		grace:       req.gracePeriod(r.GracePeriod),
+		slots:       make(chan struct{}, max(req.Worker.Concurrency, 1)),
+		pending:     make(map[string]pendingCall),
+		done:        make(chan struct{}),
+	}
+	if req.Worker.IdleTimeout != "" {
+		d, err := time.ParseDuration(req.Worker.IdleTimeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid idle_timeout %q", req.Worker.IdleTimeout)
+		}
+		w.idleTimeout = d
+	}
+
+	env := req.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	w.cmd = exec.Command(req.Path)
+	w.cmd.Env = append(slices.Clip(env), workerProtocolEnv+"="+workerProtocolNDJSON)
+	w.cmd.Dir = req.Dir
+	w.cmd.Stderr = &workerStderr{logger: logger, actionType: req.Type}
+	setProcessGroup(w.cmd)
+
+	var err error
+	if w.stdin, err = w.cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	stdout, err := w.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := w.cmd.Start(); err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(stdout)
+
+	// The worker announces itself before it is sent any request
+	hello := make(chan error, 1)
+	go func() {
+		line, err := readFrame(reader, func() int64 { return workerFrameOverhead })
+		if err != nil {
+			hello <- fmt.Errorf("no hello frame: %w", err)
+			return
+		}
+		var resp workerResponse
+		if err := json.Unmarshal(line, &resp); err != nil || resp.Protocol != workerProtocolNDJSON {
+			hello <- fmt.Errorf("unexpected hello frame %.100q", line)
+			return
+		}
+		hello <- nil
+	}()
+	select {
+	case err = <-hello:
+	case <-time.After(workerStartTimeout):
+		err = fmt.Errorf("no hello frame within %s", workerStartTimeout)
+	case <-ctx.Done():
+		err = context.Cause(ctx)
+	}
+	if err != nil {
+		signalProcessGroup(w.cmd, syscall.SIGKILL)
+		go w.cmd.Wait()
+		return nil, err
+	}
+
+	logger.Printf("Started action worker %s (pid %d) %s", req.Type, w.cmd.Process.Pid, statusINFO)
+	go func() {
+		w.read(reader)
+		r.forgetWorker(w)
+		if w.err == errWorkerStopped {
+			logger.Printf("Stopped action worker %s (pid %d) %s", req.Type, w.cmd.Process.Pid, statusINFO)
+		} else {
+			logger.Printf("Action worker %s (pid %d) failed: %v %s", req.Type, w.cmd.Process.Pid, w.err, statusWARN)
+		}
+	}()
+	return w, nil
+}
+
+// read dispatches response frames to their requests until the worker's
+// stdout is closed, then reaps the worker and fails the pending requests
+func (w *actionWorker) read(reader *bufio.Reader) {
+	var readErr error
+	for {
+		line, err := readFrame(reader, w.frameLimit)
+		if err != nil {
+			readErr = err
+			break
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var resp workerResponse
+		if err := json.Unmarshal(line, &resp); err != nil {
+			readErr = fmt.Errorf("invalid frame: %w", err)
+			break
+		}
+
+		w.mu.Lock()
+		call, ok := w.pending[resp.ID]
+		delete(w.pending, resp.ID)
+		w.mu.Unlock()
+		if ok {
+			call.reply <- resp
+		}
+	}
+
+	// A protocol error leaves the worker in an unknown state
+	if readErr != io.EOF {
+		signalProcessGroup(w.cmd, syscall.SIGKILL)
+	}
+	waitErr := w.cmd.Wait()
+
+	switch {
+	case readErr != io.EOF:
+		w.err = readErr
+	case waitErr != nil:
+		w.err = waitErr
+	default:
+		w.err = errWorkerStopped
+	}
+	close(w.done)
+}
+
+// exited reports whether the worker's process exited. Such a worker stays in
+// the pool until it is forgotten.
+func (w *actionWorker) exited() bool {
+	select {
+	case <-w.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// frameLimit returns the longest frame the worker may send with the current
+// requests in flight
+func (w *actionWorker) frameLimit() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var largest int64
+	for _, call := range w.pending {
+		largest = max(largest, call.maxOutputBytes)
+	}
+	return 2*largest + workerFrameOverhead
+}
+
+// call sends a request, whose output may be up to maxOutputBytes long, and
+// waits for its response
+func (w *actionWorker) call(ctx context.Context, input []byte, maxOutputBytes int64) (workerResponse, error) {
+	select {
+	case w.slots <- struct{}{}:
+	case <-w.done:
+		return workerResponse{}, fmt.Errorf("worker exited: %w", w.err)
+	case <-ctx.Done():
+		return workerResponse{}, context.Cause(ctx)
+	}
+	defer func() { <-w.slots }()
+
+	reply := make(chan workerResponse, 1)
+	w.mu.Lock()
+	w.nextID++
+	id := strconv.FormatUint(w.nextID, 10)
+	w.pending[id] = pendingCall{reply: reply, maxOutputBytes: maxOutputBytes}
+	w.mu.Unlock()
+	defer func() {
+		w.mu.Lock()
+		delete(w.pending, id)
+		w.mu.Unlock()
+	}()
+
+	// The request carries the trace context a process gets in its environment
+	carrier := propagation.MapCarrier{}
+	traceContext.Inject(ctx, carrier)
+	err := w.send(workerRequest{
+		ID:          id,
+		Input:       string(input),
+		Traceparent: carrier.Get("traceparent"),
+		Tracestate:  carrier.Get("tracestate"),
+	})
+	if err != nil {
+		return workerResponse{}, fmt.Errorf("failed to send request to action worker: %w", err)
+	}
+
+	select {
+	case resp := <-reply:
+		return resp, nil
+	case <-w.done:
+		select {
+		case resp := <-reply:
+			return resp, nil
+		default:
+		}
+		return workerResponse{}, fmt.Errorf("worker exited: %w", w.err)
+	case <-ctx.Done():
+		w.send(workerRequest{ID: id, Cancel: true})
+		return workerResponse{}, context.Cause(ctx)
+	}
+}
+
+// send writes a frame to the worker's stdin
+func (w *actionWorker) send(req workerRequest) error {
+	line, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+	_, err = w.stdin.Write(append(line, '\n'))
+	return err
+}
+
+// stop closes the worker's stdin, which asks it to exit, and kills it if it
+// is still running after the grace period
+func (w *actionWorker) stop(grace time.Duration) {
+	w.writeMu.Lock()
+	w.stdin.Close()
+	w.writeMu.Unlock()
+
+	select {
+	case <-w.done:
+	case <-time.After(grace):
+		signalProcessGroup(w.cmd, syscall.SIGKILL)
+		<-w.done
+	}
+}
+
+// readFrame reads a line of at most limit() bytes. The limit is checked as
+// the line grows, since requests may be sent while it is read.
+func readFrame(reader *bufio.Reader, limit func() int64) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := reader.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, chunk...)
+		if maxBytes := limit(); int64(len(line)) > maxBytes {
+			return nil, fmt.Errorf("frame exceeds %d bytes", maxBytes)
+		}
+		if !isPrefix {
+			return line, nil
+		}
+	}
+}
+
+// workerStderr logs the stderr of a worker line by line, since a worker
+// outlives the requests it serves
+type workerStderr struct {
+	logger     Logger
+	actionType string
+	buf        []byte
+}
+
+func (s *workerStderr) Write(p []byte) (int, error) {
+	s.buf = append(s.buf, p...)
+	for {
+		i := bytes.IndexByte(s.buf, '\n')
+		if i < 0 {
+			break
+		}
+		s.logger.Printf("Action %s stderr: %s %s", s.actionType, s.buf[:i], statusINFO)
+		s.buf = s.buf[i+1:]
+	}
+	if len(s.buf) > maxStderrBytes {
+		s.logger.Printf("Action %s stderr: %s %s", s.actionType, s.buf, statusINFO)
+		s.buf = nil
+	}
+	return len(p), nil
+}
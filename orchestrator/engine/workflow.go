@@ -0,0 +1,85 @@
+package engine
+
+// WorkflowV1 represents the V1 workflow definition structure
+type WorkflowV1 struct {
+	Name               string                 `yaml:"name"`
+	Description        string                 `yaml:"description"`
+	WorkflowDataSchema map[string]string      `yaml:"workflow_data_schema,omitempty"`
+	Nodes              []NodeV1               `yaml:"nodes"`
+	Finally            []NodeV1               `yaml:"finally,omitempty"`
+	Triggers           []TriggerV1            `yaml:"triggers,omitempty"`
+	Permissions        *PermissionsV1         `yaml:"permissions,omitempty"`
+	Vars               map[string]interface{} `yaml:"vars,omitempty"` // Templated once per run, including those from imports
+	Matrix             *MatrixV1              `yaml:"matrix,omitempty"`
+}
+
+// NodeV1 represents a V1 action node with YAML-based input
+type NodeV1 struct {
+	ID                 string                 `yaml:"id"`
+	Type               string                 `yaml:"type"`
+	InputsFromWorkflow map[string]interface{} `yaml:"inputs_from_workflow"`
+	Env                *EnvPolicyV1           `yaml:"env,omitempty"`
+	WorkingDir         string                 `yaml:"working_dir,omitempty"`
+	MaxInputBytes      int64                  `yaml:"max_input_bytes,omitempty"`
+	MaxOutputBytes     int64                  `yaml:"max_output_bytes,omitempty"`
+	OnOutputLimit      string                 `yaml:"on_output_limit,omitempty"` // fail (default) or truncate
+	Sandbox            *SandboxPolicyV1       `yaml:"sandbox,omitempty"`
+	Artifacts          []string               `yaml:"artifacts,omitempty"` // Globs of files to keep; relative to the run workspace
+	Cache              *CacheV1               `yaml:"cache,omitempty"`
+	Needs              []string               `yaml:"needs,omitempty"`      // Skip the node if all of these nodes were skipped
+	On                 string                 `yaml:"on,omitempty"`         // Switch nodes: template matched against cases
+	Cases              map[string][]string    `yaml:"cases,omitempty"`      // Switch nodes: value or pattern to the node IDs to run
+	Default            []string               `yaml:"default,omitempty"`    // Switch nodes: node IDs to run when no case matches
+	Script             string                 `yaml:"script,omitempty"`     // Script nodes: Starlark code setting output
+	When               string                 `yaml:"when,omitempty"`       // Expression; the node is skipped unless it is true
+	ForEach            string                 `yaml:"for_each,omitempty"`   // Expression giving a list; the node runs once per item
+	Compensate         *NodeV1                `yaml:"compensate,omitempty"` // Action undoing the node's side effects if the run fails
+}
+
+// TemplateContext holds data available for templating
+type TemplateContext struct {
+	WorkflowData map[string]interface{} `yaml:"workflow_data"`
+	Nodes        map[string]NodeOutput  `yaml:"nodes"`
+	Vars         map[string]interface{} `yaml:"vars"`
+	Run          RunInfo                `yaml:"run"`
+	Output       map[string]interface{} `yaml:"output,omitempty"` // In compensations, the compensated node's output
+	Item         interface{}            `yaml:"-"`                // In for_each nodes, the current item
+	Index        int                    `yaml:"-"`                // In for_each nodes, the position of Item
+
+	vars    *varResolver // Evaluates Vars as the nodes they refer to complete
+	resumed *WaitState   // Wait the run was suspended at, when resuming
+	routes  routes       // Switches deciding whether branch nodes run
+}
+
+// NodeOutput stores the YAML output from executed nodes
+type NodeOutput struct {
+	Output  map[string]interface{} `yaml:"output"`
+	Error   string                 `yaml:"error,omitempty"`
+	Skipped bool                   `yaml:"skipped,omitempty"` // On a switch branch not taken
+}
+
+// TriggerV1 declares an event source that starts workflow runs in server mode
+type TriggerV1 struct {
+	Git     *GitTriggerV1     `yaml:"git,omitempty"`
+	FSWatch *FSWatchTriggerV1 `yaml:"fs_watch,omitempty"`
+}
+
+// GitTriggerV1 starts a run for every new commit pushed to a branch
+type GitTriggerV1 struct {
+	URL         string `yaml:"url"`
+	Branch      string `yaml:"branch,omitempty"`       // Branch to watch (default: main)
+	Username    string `yaml:"username,omitempty"`     // Git username (optional)
+	Password    string `yaml:"password,omitempty"`     // Git password/token (optional)
+	PasswordEnv string `yaml:"password_env,omitempty"` // Environment variable holding the password/token
+	Interval    int    `yaml:"interval,omitempty"`     // Poll interval in seconds (default: 60)
+	Batch       bool   `yaml:"batch,omitempty"`        // Start one run per poll instead of one per commit
+	MaxCommits  int    `yaml:"max_commits,omitempty"`  // Max commits picked up per poll (default: 20)
+}
+
+// FSWatchTriggerV1 starts a run when files in a local directory change
+type FSWatchTriggerV1 struct {
+	Path     string   `yaml:"path"`               // Directory to watch
+	Glob     string   `yaml:"glob,omitempty"`     // File name pattern (default: *)
+	Events   []string `yaml:"events,omitempty"`   // create, write, remove, rename, chmod (default: create, write)
+	Debounce string   `yaml:"debounce,omitempty"` // Quiet period before a run starts (default: 1s)
+}
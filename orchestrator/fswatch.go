@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/octo-agent/go-ai-agent-v1/orchestrator/engine"
+)
+
+// fsWatchEvents maps trigger event names to fsnotify operations. When an
+// fsnotify event carries several operations, the first of them in this order
+// names it.
+var fsWatchEvents = []struct {
+	name string
+	op   fsnotify.Op
+}{
+	{"create", fsnotify.Create},
+	{"write", fsnotify.Write},
+	{"remove", fsnotify.Remove},
+	{"rename", fsnotify.Rename},
+	{"chmod", fsnotify.Chmod},
+}
+
+// fsWatchOp returns the fsnotify operation of a trigger event name
+func fsWatchOp(name string) (fsnotify.Op, bool) {
+	for _, event := range fsWatchEvents {
+		if event.name == name {
+			return event.op, true
+		}
+	}
+	return 0, false
+}
+
+// fsWatchTrigger watches a directory and coalesces bursts of events per file
+type fsWatchTrigger struct {
+	config   engine.FSWatchTriggerV1
+	ops      fsnotify.Op
+	debounce time.Duration
+
+	mu      sync.Mutex
+	pending map[string]*pendingFileEvent
+}
+
+// pendingFileEvent collects the events seen for one file during the debounce
+// window. Every event restarts the window with a new timer and generation, so
+// that a timer which already fired while the event was being handled finds a
+// newer generation and leaves the file pending.
+type pendingFileEvent struct {
+	timer      *time.Timer
+	generation int
+	events     map[string]bool
+	last       string
+}
+
+func newFSWatchTrigger(config engine.FSWatchTriggerV1) (*fsWatchTrigger, error) {
+	if config.Path == "" {
+		return nil, fmt.Errorf("fs_watch trigger requires a path")
+	}
+	if config.Glob == "" {
+		config.Glob = "*"
+	}
+	if _, err := filepath.Match(config.Glob, ""); err != nil {
+		return nil, fmt.Errorf("invalid fs_watch glob %q: %w", config.Glob, err)
+	}
+	if len(config.Events) == 0 {
+		config.Events = []string{"create", "write"}
+	}
+
+	var ops fsnotify.Op
+	for _, name := range config.Events {
+		op, ok := fsWatchOp(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown fs_watch event %q (must be one of: create, write, remove, rename, chmod)", name)
+		}
+		ops |= op
+	}
+
+	debounce := time.Second
+	if config.Debounce != "" {
+		var err error
+		if debounce, err = time.ParseDuration(config.Debounce); err != nil {
+			return nil, fmt.Errorf("invalid fs_watch debounce %q: %w", config.Debounce, err)
+		}
+	}
+
+	return &fsWatchTrigger{
+		config:   config,
+		ops:      ops,
+		debounce: debounce,
+		pending:  make(map[string]*pendingFileEvent),
+	}, nil
+}
+
+// Run watches the directory until ctx is cancelled
+func (t *fsWatchTrigger) Run(ctx context.Context, runs chan<- runRequest) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("fs_watch trigger could not start: %v %s", err, statusFAILED)
+		return
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(t.config.Path); err != nil {
+		log.Printf("fs_watch trigger could not watch %s: %v %s", t.config.Path, err, statusFAILED)
+		return
+	}
+
+	log.Printf("fs_watch trigger watching %s for %s %v %s", t.config.Path, t.config.Glob, t.config.Events, statusINFO)
+
+	for {
+		select {
+		case <-ctx.Done():
+			t.mu.Lock()
+			for _, p := range t.pending {
+				p.timer.Stop()
+			}
+			t.mu.Unlock()
+			return
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("fs_watch trigger error on %s: %v %s", t.config.Path, err, statusWARN)
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			t.handle(ctx, runs, event)
+		}
+	}
+}
+
+// handle filters an fsnotify event and (re)starts the file's debounce timer
+func (t *fsWatchTrigger) handle(ctx context.Context, runs chan<- runRequest, event fsnotify.Event) {
+	if event.Op&t.ops == 0 {
+		return
+	}
+	if matched, _ := filepath.Match(t.config.Glob, filepath.Base(event.Name)); !matched {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, exists := t.pending[event.Name]
+	if !exists {
+		p = &pendingFileEvent{events: make(map[string]bool)}
+		t.pending[event.Name] = p
+	} else {
+		p.timer.Stop()
+	}
+	p.generation++
+	path, generation := event.Name, p.generation
+	p.timer = time.AfterFunc(t.debounce, func() { t.fire(ctx, runs, path, generation) })
+
+	p.last = ""
+	for _, watched := range fsWatchEvents {
+		if event.Op&watched.op != 0 && t.ops&watched.op != 0 {
+			p.events[watched.name] = true
+			if p.last == "" {
+				p.last = watched.name
+			}
+		}
+	}
+}
+
+// fire starts a run for a file once its events have settled, unless a later
+// event restarted the debounce window after generation
+func (t *fsWatchTrigger) fire(ctx context.Context, runs chan<- runRequest, path string, generation int) {
+	t.mu.Lock()
+	p := t.pending[path]
+	if p == nil || p.generation != generation {
+		t.mu.Unlock()
+		return
+	}
+	delete(t.pending, path)
+	t.mu.Unlock()
+
+	var events []string
+	for name := range p.events {
+		events = append(events, name)
+	}
+	sort.Strings(events)
+
+	data := map[string]interface{}{
+		"trigger":    "fs_watch",
+		"watch_path": t.config.Path,
+		"file_path":  path,
+		"file_name":  filepath.Base(path),
+		"event":      p.last,
+		"events":     events,
+	}
+
+	// The file may already be gone, e.g. for remove and rename events
+	if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+		// A new file is usually created and written in one burst; report it as created
+		if p.events["create"] {
+			data["event"] = "create"
+		}
+		data["size"] = info.Size()
+		checksum, err := fileChecksum(path)
+		if err != nil {
+			log.Printf("fs_watch trigger could not checksum %s: %v %s", path, err, statusWARN)
+		} else {
+			data["checksum"] = checksum
+		}
+	}
+
+	log.Printf("fs_watch trigger detected %s on %s %s", data["event"], path, statusINFO)
+
+	select {
+	case runs <- runRequest{Source: "fs_watch:" + path, Data: data}:
+	case <-ctx.Done():
+	}
+}
+
+// fileChecksum returns the hex-encoded SHA-256 of a file's contents
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/octo-agent/go-ai-agent-v1/orchestrator/engine"
+)
+
+func TestFSWatchDebounce(t *testing.T) {
+	tests := []struct {
+		name       string
+		events     []string // Config events, default: create, write
+		ops        []fsnotify.Op
+		file       string
+		wantRun    bool
+		wantEvent  string
+		wantEvents []string
+	}{
+		{
+			name:       "burst starts one run",
+			ops:        []fsnotify.Op{fsnotify.Create, fsnotify.Write, fsnotify.Write},
+			file:       "report.pdf",
+			wantRun:    true,
+			wantEvent:  "create",
+			wantEvents: []string{"create", "write"},
+		},
+		{
+			name:       "writes only",
+			ops:        []fsnotify.Op{fsnotify.Write, fsnotify.Write},
+			file:       "report.pdf",
+			wantRun:    true,
+			wantEvent:  "write",
+			wantEvents: []string{"write"},
+		},
+		{
+			name:       "unwatched operations are left out",
+			ops:        []fsnotify.Op{fsnotify.Write, fsnotify.Chmod},
+			file:       "report.pdf",
+			wantRun:    true,
+			wantEvent:  "write",
+			wantEvents: []string{"write"},
+		},
+		{
+			name:       "several operations at once",
+			events:     []string{"write", "chmod"},
+			ops:        []fsnotify.Op{fsnotify.Chmod | fsnotify.Write},
+			file:       "report.pdf",
+			wantRun:    true,
+			wantEvent:  "write",
+			wantEvents: []string{"chmod", "write"},
+		},
+		{
+			name: "unwatched operation",
+			ops:  []fsnotify.Op{fsnotify.Remove},
+			file: "report.pdf",
+		},
+		{
+			name: "glob mismatch",
+			ops:  []fsnotify.Op{fsnotify.Create},
+			file: "notes.txt",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, tt.file)
+			if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			trigger, err := newFSWatchTrigger(engine.FSWatchTriggerV1{Path: dir, Glob: "*.pdf", Events: tt.events, Debounce: "20ms"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			runs := make(chan runRequest, 2)
+			for _, op := range tt.ops {
+				trigger.handle(ctx, runs, fsnotify.Event{Name: path, Op: op})
+			}
+
+			if !tt.wantRun {
+				select {
+				case req := <-runs:
+					t.Fatalf("unexpected run %v", req.Data)
+				case <-time.After(100 * time.Millisecond):
+				}
+				return
+			}
+
+			req := receiveRun(t, runs)
+			if req.Data["event"] != tt.wantEvent {
+				t.Errorf("event = %v, want %s", req.Data["event"], tt.wantEvent)
+			}
+			if !reflect.DeepEqual(req.Data["events"], tt.wantEvents) {
+				t.Errorf("events = %v, want %v", req.Data["events"], tt.wantEvents)
+			}
+			if req.Data["size"] != int64(4) {
+				t.Errorf("size = %v, want 4", req.Data["size"])
+			}
+
+			select {
+			case req := <-runs:
+				t.Errorf("second run %v", req.Data)
+			case <-time.After(100 * time.Millisecond):
+			}
+		})
+	}
+}
+
+func TestFSWatchStaleTimer(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.pdf")
+	trigger, err := newFSWatchTrigger(engine.FSWatchTriggerV1{Path: dir, Debounce: "50ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runs := make(chan runRequest, 2)
+	trigger.handle(ctx, runs, fsnotify.Event{Name: path, Op: fsnotify.Create})
+	trigger.handle(ctx, runs, fsnotify.Event{Name: path, Op: fsnotify.Write})
+
+	// The first timer firing after the second event must not start a run
+	// before the restarted debounce window is over
+	trigger.fire(ctx, runs, path, 1)
+	select {
+	case req := <-runs:
+		t.Fatalf("stale timer started run %v", req.Data)
+	default:
+	}
+
+	req := receiveRun(t, runs)
+	if !reflect.DeepEqual(req.Data["events"], []string{"create", "write"}) {
+		t.Errorf("events = %v, want [create write]", req.Data["events"])
+	}
+}
+
+// receiveRun waits for the trigger's next run
+func receiveRun(t *testing.T, runs <-chan runRequest) runRequest {
+	t.Helper()
+	select {
+	case req := <-runs:
+		return req
+	case <-time.After(2 * time.Second):
+		t.Fatal("no run started")
+		return runRequest{}
+	}
+}
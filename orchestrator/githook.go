@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// validHook reports whether a push webhook was sent by a git host that knows
+// the server token: as a bearer token, as GitLab's secret token, or as the
+// secret of GitHub's or Gitea's HMAC-SHA256 signature of the body
+func (s *server) validHook(r *http.Request, body []byte) bool {
+	if s.validToken(bearerToken(r)) || s.validToken(r.Header.Get("X-Gitlab-Token")) {
+		return true
+	}
+
+	signature := r.Header.Get("X-Gitea-Signature")
+	if value, ok := strings.CutPrefix(r.Header.Get("X-Hub-Signature-256"), "sha256="); ok {
+		signature = value
+	}
+	presented, err := hex.DecodeString(signature)
+	if signature == "" || err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(s.token))
+	mac.Write(body)
+	return hmac.Equal(presented, mac.Sum(nil))
+}
+
+// gitPushEvent holds the fields we use from GitHub/GitLab/Gitea push payloads
+type gitPushEvent struct {
+	Ref        string `json:"ref"`
+	Repository struct {
+		CloneURL string `json:"clone_url"`
+		GitURL   string `json:"git_http_url"`
+	} `json:"repository"`
+}
+
+// handleGitHook accepts push webhooks and polls the matching git triggers
+// right away. Deliveries must be authenticated with the server token (see
+// validHook), and the poll itself decides which commits are new, so duplicate
+// deliveries cannot start runs for commits that do not exist.
+func (s *server) handleGitHook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.token == "" {
+		http.Error(w, serverTokenEnvVar+" is not set on the server, so this endpoint is disabled", http.StatusForbidden)
+		return
+	}
+
+	var event gitPushEvent
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "failed to read body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !s.validHook(r, body) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &event); err != nil {
+			log.Printf("Ignoring unparseable push payload: %v %s", err, statusWARN)
+		}
+	}
+
+	repoURL := event.Repository.CloneURL
+	if repoURL == "" {
+		repoURL = event.Repository.GitURL
+	}
+
+	matched := 0
+	for _, git := range s.gitTriggers {
+		if git.matches(repoURL, event.Ref) {
+			git.Poke()
+			matched++
+		}
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(w, "%d trigger(s) notified\n", matched)
+}
@@ -1,14 +1,17 @@
 package main
 
 import (
-	"bytes"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
-	"strings"
-	"text/template"
+	"path/filepath"
+	"slices"
 
+	"github.com/octo-agent/go-ai-agent-v1/orchestrator/engine"
+	"golang.org/x/term"
 	"gopkg.in/yaml.v3"
 )
 
@@ -29,216 +32,145 @@ const (
 	statusWARN   = "[" + colorYellow + "WARN" + colorReset + "]"
 )
 
-// WorkflowV1 represents the V1 workflow definition structure
-type WorkflowV1 struct {
-	Name               string            `yaml:"name"`
-	Description        string            `yaml:"description"`
-	WorkflowDataSchema map[string]string `yaml:"workflow_data_schema,omitempty"`
-	Nodes              []NodeV1          `yaml:"nodes"`
-}
+func main() {
+	// The sandbox helper replaces itself with the action it wraps
+	if len(os.Args) > 1 && os.Args[1] == engine.SandboxHelperArg {
+		engine.RunSandboxHelper()
+		return
+	}
 
-// NodeV1 represents a V1 action node with YAML-based input
-type NodeV1 struct {
-	ID                 string                 `yaml:"id"`
-	Type               string                 `yaml:"type"`
-	InputsFromWorkflow map[string]interface{} `yaml:"inputs_from_workflow"`
-}
+	// Configure logging
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
-// TemplateContext holds data available for templating
-type TemplateContext struct {
-	WorkflowData map[string]interface{} `yaml:"workflow_data"`
-	Nodes        map[string]NodeOutput  `yaml:"nodes"`
-}
+	// Under the name of a builtin action the orchestrator is that action
+	if name := filepath.Base(os.Args[0]); slices.Contains(engine.Builtins(), name) {
+		actionCommand(name, os.Args[1:])
+		return
+	}
+	if len(os.Args) >= 3 && os.Args[1] == "action" {
+		actionCommand(os.Args[2], os.Args[3:])
+		return
+	}
 
-// NodeOutput stores the YAML output from executed nodes
-type NodeOutput struct {
-	Output map[string]interface{} `yaml:"output"`
-	Error  string                 `yaml:"error,omitempty"`
-}
+	if len(os.Args) == 2 && os.Args[1] == "sandbox-check" {
+		engine.SandboxCheck()
+		return
+	}
 
-// ActionError represents an error response from an action
-type ActionError struct {
-	Error           string                 `yaml:"error"`
-	OriginalRequest map[string]interface{} `yaml:"original_request,omitempty"`
-}
+	if len(os.Args) == 3 && os.Args[1] == "render" {
+		if err := engine.Render(os.Args[2], os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error rendering workflow: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-func main() {
-	// Configure logging
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	// Server mode keeps the workflow's triggers running
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		serve(os.Args[2:])
+		return
+	}
+
+	// Suspended runs continue once their wait is over
+	if len(os.Args) > 1 && os.Args[1] == "resume" {
+		resumeCommand(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "event" {
+		eventCommand(os.Args[2:])
+		return
+	}
 
 	// Check command-line arguments
-	if len(os.Args) < 2 || len(os.Args) > 3 {
-		fmt.Fprintf(os.Stderr, "Usage: %s <workflow_file.yaml> [initial_data_yaml]\n", os.Args[0])
+	flags := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	matrixFile := flags.String("matrix", "", "run every combination of the matrix in this file")
+	parallelism := flags.Int("parallelism", 0, "matrix combinations run at the same time")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [-matrix matrix.yaml] [-parallelism n] <workflow_file.yaml> [initial_data_yaml]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s serve [-addr 127.0.0.1:8080] <workflow_file.yaml> [initial_data_yaml]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s resume [-due] [run-id]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s event [-correlation id] <name> [payload_yaml]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s render <workflow_file.yaml>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s action <type>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s sandbox-check\n", os.Args[0])
 		os.Exit(1)
 	}
+	flags.Parse(os.Args[1:])
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		flags.Usage()
+	}
 
-	workflowFile := os.Args[1]
+	workflowFile := flags.Arg(0)
 	var initialData map[string]interface{}
 
 	// Parse optional initial data
-	if len(os.Args) == 3 {
-		initialDataStr := os.Args[2]
+	if flags.NArg() == 2 {
+		initialDataStr := flags.Arg(1)
 		if err := yaml.Unmarshal([]byte(initialDataStr), &initialData); err != nil {
 			log.Fatalf("Error parsing initial data YAML: %v", err)
 		}
-	} else {
-		initialData = make(map[string]interface{})
 	}
 
 	// Parse workflow definition
-	workflow, err := parseWorkflowV1(workflowFile)
-	if err != nil {
+	e := engine.New()
+	if err := e.Load(workflowFile); err != nil {
 		log.Fatalf("Error parsing workflow file: %v", err)
 	}
+	workflow := e.Workflow
 
 	// Update the workflow start message
 	log.Printf("Starting workflow execution: %s %s", workflow.Name, statusINFO)
 	log.Printf("Description: %s %s", workflow.Description, statusINFO)
 
-	// Execute workflow
-	if err := executeWorkflowV1(workflow, initialData); err != nil {
-		// Update failure messages
-		log.Printf("Workflow execution failed: %s %s", err, statusFAILED)
-		log.Fatalf("Workflow execution failed: %v %s", err, statusFAILED)
-	}
-
-	// Update workflow completion message
-	log.Printf("Workflow completed successfully %s", statusOK)
-}
-
-// parseWorkflowV1 reads and parses the V1 workflow YAML file
-func parseWorkflowV1(filename string) (*WorkflowV1, error) {
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read file: %w", err)
-	}
-
-	var workflow WorkflowV1
-	if err := yaml.Unmarshal(data, &workflow); err != nil {
-		return nil, fmt.Errorf("failed to parse YAML: %w", err)
-	}
+	shutdownTracing := initTracing()
 
-	return &workflow, nil
-}
+	// A run started by a traced caller joins the caller's trace
+	ctx, stop := withSignals(contextFromEnv(context.Background()))
+	defer stop()
 
-// executeWorkflowV1 executes all nodes in the workflow
-func executeWorkflowV1(workflow *WorkflowV1, initialData map[string]interface{}) error {
-	// Initialize template context
-	context := &TemplateContext{
-		WorkflowData: initialData,
-		Nodes:        make(map[string]NodeOutput),
-	}
+	// Approval nodes prompt on the terminal the run was started from
+	e.Interactive = term.IsTerminal(int(os.Stdin.Fd()))
 
-	// Execute each node sequentially
-	for _, node := range workflow.Nodes {
-		// Update node execution messages
-		log.Printf("Executing node: %s (%s) %s", node.ID, node.Type, statusINFO)
-
-		output, err := executeNodeV1(node, context)
+	// A matrix runs the workflow once per combination
+	if *matrixFile != "" {
+		matrix, err := engine.LoadMatrix(*matrixFile)
 		if err != nil {
-			log.Printf("Node %s execution failed %s", node.ID, statusFAILED)
-			return fmt.Errorf("error executing node %s: %w", node.ID, err)
+			log.Fatalf("Error parsing matrix: %v", err)
 		}
-
-		// Store the output for future template resolution
-		context.Nodes[node.ID] = NodeOutput{
-			Output: output,
-		}
-
-		// Update node completion message
-		log.Printf("Node %s completed successfully %s", node.ID, statusOK)
-	}
-
-	return nil
-}
-
-// executeNodeV1 executes a single V1 node
-func executeNodeV1(node NodeV1, context *TemplateContext) (map[string]interface{}, error) {
-	// Resolve templates in the input
-	resolvedInput, err := resolveTemplates(node.InputsFromWorkflow, context)
-	if err != nil {
-		return nil, fmt.Errorf("failed to resolve templates: %w", err)
-	}
-
-	// Convert resolved input to YAML
-	inputYAML, err := yaml.Marshal(resolvedInput)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal input YAML: %w", err)
+		workflow.Matrix = matrix
 	}
-
-	log.Printf("Sending to action: %s", string(inputYAML))
-
-	// Get the path to the orchestrator binary
-	execPath, err := os.Executable()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get executable path: %w", err)
-	}
-
-	// Construct action binary path in same directory
-	actionPath := strings.Replace(execPath, "orchestrator", node.Type, 1)
-
-	// Execute the action binary
-	cmd := exec.Command(actionPath)
-	cmd.Stdin = strings.NewReader(string(inputYAML))
-
-	// Capture stdout and stderr separately
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	if err := cmd.Run(); err != nil {
-		// Log stderr for debugging
-		if stderr.Len() > 0 {
-			// Update the stderr capture message
-			log.Printf("Action stderr output: %s %s", stderr.String(), statusWARN)
+	if workflow.Matrix != nil {
+		if *parallelism > 0 {
+			workflow.Matrix.Parallelism = *parallelism
 		}
-		return nil, fmt.Errorf("action failed: %w", err)
-	}
-
-	// Log stderr if present (for debugging)
-	if stderr.Len() > 0 {
-		log.Printf("Action stderr: %s %s", stderr.String(), statusINFO)
+		code := runMatrix(ctx, e, initialData)
+		e.Close()
+		shutdownTracing()
+		stop()
+		os.Exit(code)
 	}
 
-	// Parse the output YAML
-	var output map[string]interface{}
-	if err := yaml.Unmarshal(stdout.Bytes(), &output); err != nil {
-		return nil, fmt.Errorf("failed to parse action output YAML: %w", err)
-	}
-
-	// Check for error in the output
-	if errorMsg, exists := output["error"]; exists {
-		return nil, fmt.Errorf("action returned error: %v", errorMsg)
-	}
-
-	log.Printf("Action output: %s %s", stdout.String(), statusINFO)
-	return output, nil
-}
-
-// resolveTemplates processes templates in the input data
-func resolveTemplates(input map[string]interface{}, context *TemplateContext) (map[string]interface{}, error) {
-	// Convert input to YAML and back to handle nested structures
-	inputYAML, err := yaml.Marshal(input)
-	if err != nil {
-		return nil, err
-	}
-
-	// Apply template processing to the YAML string
-	tmpl, err := template.New("input").Parse(string(inputYAML))
+	// Execute workflow
+	result, err := e.Run(ctx, initialData)
+	e.Close()
+	shutdownTracing()
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse template: %w", err)
-	}
-
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, context); err != nil {
-		return nil, fmt.Errorf("failed to execute template: %w", err)
-	}
+		if result.Status == engine.RunCancelled {
+			log.Printf("Workflow run %s cancelled: %v %s", result.RunID, err, statusWARN)
+			stop()
+			os.Exit(exitCancelled)
+		}
+		if errors.Is(err, engine.ErrSuspended) {
+			log.Printf("Workflow run %s is waiting; continue it with: resume %s %s", result.RunID, result.RunID, statusINFO)
+			stop()
+			os.Exit(exitSuspended)
+		}
 
-	// Parse the resolved YAML back
-	var resolved map[string]interface{}
-	if err := yaml.Unmarshal(buf.Bytes(), &resolved); err != nil {
-		return nil, fmt.Errorf("failed to parse resolved YAML: %w", err)
+		// Update failure messages
+		log.Printf("Workflow execution failed: %s %s", err, statusFAILED)
+		log.Fatalf("Workflow execution failed: %v %s", err, statusFAILED)
 	}
 
-	return resolved, nil
+	// Update workflow completion message
+	log.Printf("Workflow completed successfully %s", statusOK)
 }
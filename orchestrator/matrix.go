@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/octo-agent/go-ai-agent-v1/orchestrator/engine"
+)
+
+// runMatrix runs every combination of the workflow's matrix, prints a summary
+// and returns the exit code: 0 when all succeeded, exitSuspended when a run is
+// waiting, exitCancelled when runs were cancelled or skipped, 1 on failure
+func runMatrix(ctx context.Context, e *engine.Engine, initialData map[string]interface{}) int {
+	results, err := e.RunMatrix(ctx, initialData)
+	if err != nil {
+		log.Printf("%v %s", err, statusFAILED)
+		return 1
+	}
+
+	printMatrixSummary(results)
+
+	code := 0
+	for _, result := range results {
+		switch result.Status {
+		case engine.RunSucceeded:
+		case engine.RunWaiting:
+			if code == 0 {
+				code = exitSuspended
+			}
+		case engine.RunCancelled, engine.MatrixSkipped:
+			if code == 0 {
+				code = exitCancelled
+			}
+		default:
+			code = 1
+		}
+	}
+	return code
+}
+
+// printMatrixSummary prints one line per combination with its run's outcome
+func printMatrixSummary(results []engine.MatrixResult) {
+	width := len("COMBINATION")
+	for _, result := range results {
+		if n := len(engine.MatrixLabel(result.Values)); n > width {
+			width = n
+		}
+	}
+
+	succeeded := 0
+	fmt.Printf("\n%-*s  %-24s  %-10s  %10s  %s\n", width, "COMBINATION", "RUN ID", "STATUS", "DURATION", "ERROR")
+	for _, result := range results {
+		if result.Status == engine.RunSucceeded {
+			succeeded++
+		}
+		runID, duration, message := "-", "-", ""
+		if result.RunID != "" {
+			runID = result.RunID
+			duration = result.Duration.Round(time.Millisecond).String()
+		}
+		if result.Err != nil {
+			message = result.Err.Error()
+		}
+		fmt.Printf("%-*s  %-24s  %-10s  %10s  %s\n", width, engine.MatrixLabel(result.Values), runID, result.Status, duration, message)
+	}
+	fmt.Printf("%d of %d combinations succeeded\n", succeeded, len(results))
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/octo-agent/go-ai-agent-v1/orchestrator/engine"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gopkg.in/yaml.v3"
+)
+
+// serverTokenEnvVar names the shared secret that callers of the approvals
+// and events APIs and git hosts delivering push webhooks must present
+const serverTokenEnvVar = "OCTA_SERVER_TOKEN"
+
+// runRequest asks the server to start one workflow run, or to resume a
+// suspended one
+type runRequest struct {
+	Source   string
+	Data     map[string]interface{}
+	ResumeID string
+	Done     chan<- error // Receives the run's error, nil if it succeeded or suspended, then is closed; if set
+}
+
+// server runs a workflow in daemon mode, starting runs from its triggers
+type server struct {
+	engine      *engine.Engine
+	workflow    *engine.WorkflowV1
+	baseData    map[string]interface{}
+	runs        chan runRequest
+	triggers    []trigger
+	gitTriggers []*gitTrigger
+	token       string // The shared secret from OCTA_SERVER_TOKEN; the APIs are disabled without it
+
+	wake     chan struct{}   // Pokes the scheduler to look for due runs
+	mu       sync.Mutex      // Guards resuming
+	resuming map[string]bool // Suspended runs queued for the worker
+}
+
+// serve parses the serve subcommand arguments and blocks until interrupted
+func serve(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", "127.0.0.1:8080", "listen address for webhooks and the APIs")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		fmt.Fprintf(os.Stderr, "Usage: %s serve [-addr 127.0.0.1:8080] <workflow_file.yaml> [initial_data_yaml]\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	baseData := make(map[string]interface{})
+	if flags.NArg() == 2 {
+		if err := yaml.Unmarshal([]byte(flags.Arg(1)), &baseData); err != nil {
+			log.Fatalf("Error parsing initial data YAML: %v", err)
+		}
+	}
+
+	e := engine.New()
+	if err := e.Load(flags.Arg(0)); err != nil {
+		log.Fatalf("Error parsing workflow file: %v", err)
+	}
+	workflow := e.Workflow
+
+	if len(workflow.Triggers) == 0 {
+		log.Fatalf("Workflow %s declares no triggers %s", workflow.Name, statusFAILED)
+	}
+	if workflow.Matrix != nil {
+		log.Printf("Matrix is ignored in server mode; each event starts a single run %s", statusWARN)
+	}
+
+	srv := &server{
+		engine:   e,
+		workflow: workflow,
+		baseData: baseData,
+		runs:     make(chan runRequest, 100),
+		wake:     make(chan struct{}, 1),
+		resuming: make(map[string]bool),
+		token:    os.Getenv(serverTokenEnvVar),
+	}
+	for i, config := range workflow.Triggers {
+		switch {
+		case config.Git != nil:
+			git := newGitTrigger(e, *config.Git)
+			srv.gitTriggers = append(srv.gitTriggers, git)
+			srv.triggers = append(srv.triggers, git)
+		case config.FSWatch != nil:
+			fsWatch, err := newFSWatchTrigger(*config.FSWatch)
+			if err != nil {
+				log.Fatalf("Invalid trigger %d: %v %s", i, err, statusFAILED)
+			}
+			srv.triggers = append(srv.triggers, fsWatch)
+		default:
+			log.Fatalf("Trigger %d has no known trigger type %s", i, statusFAILED)
+		}
+	}
+
+	shutdownTracing := initTracing()
+
+	ctx, stop := withSignals(context.Background())
+	defer stop()
+
+	err := srv.Run(ctx, *addr)
+	e.Close()
+	shutdownTracing()
+	if err != nil {
+		log.Fatalf("Server failed: %v %s", err, statusFAILED)
+	}
+}
+
+// Run starts the triggers, the run worker and the HTTP listener
+func (s *server) Run(ctx context.Context, addr string) error {
+	log.Printf("Serving workflow %s on %s %s", s.workflow.Name, addr, statusINFO)
+	if s.token == "" {
+		log.Printf("%s is not set: the approvals, events and git hook endpoints are disabled %s", serverTokenEnvVar, statusWARN)
+	}
+
+	for _, t := range s.triggers {
+		go t.Run(ctx, s.runs)
+	}
+	go s.worker(ctx)
+	go s.scheduler(ctx)
+
+	queueDepth := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "octa_run_queue_depth",
+		Help: "Runs waiting for the worker.",
+	}, func() float64 { return float64(len(s.runs)) })
+	if err := prometheus.Register(queueDepth); err != nil {
+		return fmt.Errorf("failed to register queue metric: %w", err)
+	}
+	defer prometheus.Unregister(queueDepth)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/hooks/git", s.handleGitHook)
+	mux.HandleFunc("GET /approvals", s.authorize(s.handleListApprovals))
+	mux.HandleFunc("POST /approvals/{run}/{node}", s.authorize(s.handleDecideApproval))
+	mux.HandleFunc("POST /events/{name}", s.authorize(s.handleEvent))
+	mux.Handle("/metrics", promhttp.Handler())
+
+	httpServer := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	log.Printf("Server stopped %s", statusINFO)
+	return nil
+}
+
+// worker executes queued runs one at a time
+func (s *server) worker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case req := <-s.runs:
+			err := s.execute(ctx, req)
+			if req.Done != nil {
+				req.Done <- err
+				close(req.Done)
+			}
+		}
+	}
+}
+
+// execute starts a queued run, or resumes a suspended one, and returns the
+// error of a run that failed
+func (s *server) execute(ctx context.Context, req runRequest) error {
+	if req.ResumeID != "" {
+		return s.resume(ctx, req)
+	}
+
+	data := make(map[string]interface{}, len(s.baseData)+len(req.Data))
+	for key, value := range s.baseData {
+		data[key] = value
+	}
+	for key, value := range req.Data {
+		data[key] = value
+	}
+
+	log.Printf("Starting run of %s from %s %s", s.workflow.Name, req.Source, statusINFO)
+	result, err := s.engine.Run(ctx, data)
+	switch {
+	case err == nil:
+		log.Printf("Run from %s completed successfully %s", req.Source, statusOK)
+	case result.Status == engine.RunWaiting:
+		log.Printf("Run %s from %s is waiting %s", result.RunID, req.Source, statusINFO)
+		return nil
+	default:
+		log.Printf("Run from %s failed: %v %s", req.Source, err, statusFAILED)
+	}
+	return err
+}
+
+// resume continues a suspended run queued by the scheduler
+func (s *server) resume(ctx context.Context, req runRequest) error {
+	defer func() {
+		s.mu.Lock()
+		delete(s.resuming, req.ResumeID)
+		s.mu.Unlock()
+	}()
+
+	log.Printf("Resuming run %s from %s %s", req.ResumeID, req.Source, statusINFO)
+	result, err := s.engine.Resume(ctx, req.ResumeID)
+	switch {
+	case err == nil:
+		log.Printf("Run %s completed successfully %s", req.ResumeID, statusOK)
+	case result.Status == engine.RunWaiting:
+		log.Printf("Run %s is waiting %s", req.ResumeID, statusINFO)
+		return nil
+	default:
+		log.Printf("Run %s failed: %v %s", req.ResumeID, err, statusFAILED)
+	}
+	return err
+}
+
+// scheduler queues the suspended runs of the workflow whose wait is over.
+// It looks every few seconds, and right away when poked after an event.
+func (s *server) scheduler(ctx context.Context) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		due, err := s.engine.DueRuns(s.workflow.Name)
+		if err != nil {
+			log.Printf("Failed to list suspended runs: %v %s", err, statusWARN)
+		}
+		for _, runID := range due {
+			s.mu.Lock()
+			queued := s.resuming[runID]
+			s.resuming[runID] = true
+			s.mu.Unlock()
+			if queued {
+				continue
+			}
+
+			select {
+			case s.runs <- runRequest{Source: "scheduler", ResumeID: runID}:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// poke makes the scheduler look for due runs without waiting for its tick
+func (s *server) poke() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// authorize wraps a handler so it only serves requests that present the
+// server token as a bearer token
+func (s *server) authorize(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.token == "" {
+			http.Error(w, serverTokenEnvVar+" is not set on the server, so this endpoint is disabled", http.StatusForbidden)
+			return
+		}
+		if !s.validToken(bearerToken(r)) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// validToken compares a presented token with the server token in constant
+// time
+func (s *server) validToken(token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header
+func bearerToken(r *http.Request) string {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// approvalRequest is the body of a decision posted to the approvals API
+type approvalRequest struct {
+	Decision string `json:"decision"` // approve or reject
+	Approver string `json:"approver"`
+	Comment  string `json:"comment"`
+}
+
+// handleListApprovals returns the approvals waiting for a decision
+func (s *server) handleListApprovals(w http.ResponseWriter, r *http.Request) {
+	pending, err := s.engine.PendingApprovals()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if pending == nil {
+		pending = []engine.ApprovalRecord{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pending)
+}
+
+// handleDecideApproval approves or rejects a waiting approval node; the
+// scheduler then resumes its run if it was suspended
+func (s *server) handleDecideApproval(w http.ResponseWriter, r *http.Request) {
+	var req approvalRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Approver) == "" {
+		http.Error(w, "approver is required", http.StatusBadRequest)
+		return
+	}
+	decision, err := engine.ParseDecision(req.Decision)
+	if err != nil || decision == "" {
+		http.Error(w, "decision must be approve or reject", http.StatusBadRequest)
+		return
+	}
+
+	runID, node := r.PathValue("run"), r.PathValue("node")
+	err = s.engine.DecideApproval(runID, node, engine.ApprovalDecision{
+		Decision: decision,
+		Approver: req.Approver,
+		Comment:  req.Comment,
+	})
+	switch {
+	case errors.Is(err, engine.ErrApprovalDecided):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	log.Printf("Approval of node %s in run %s %s by %s %s", node, runID, decision, req.Approver, statusINFO)
+	s.poke()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"run_id": runID, "node": node, "decision": decision})
+}
+
+// eventRequest is the body of an event posted to the events API
+type eventRequest struct {
+	CorrelationID string      `json:"correlation_id"`
+	Payload       interface{} `json:"payload"`
+}
+
+// handleEvent delivers an event to the suspended runs waiting for it; the
+// scheduler then resumes those of this workflow. An event with a correlation
+// ID is kept for a run that is not waiting yet.
+func (s *server) handleEvent(w http.ResponseWriter, r *http.Request) {
+	var req eventRequest
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err == nil && len(body) > 0 {
+		err = json.Unmarshal(body, &req)
+	}
+	if err != nil {
+		http.Error(w, "invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	name := r.PathValue("name")
+	runIDs, err := s.engine.DeliverEvent(name, req.CorrelationID, req.Payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(runIDs) == 0 && req.CorrelationID == "" {
+		http.Error(w, "no run is waiting for event "+name, http.StatusNotFound)
+		return
+	}
+
+	if len(runIDs) == 0 {
+		// Kept for the run that starts waiting for it
+		log.Printf("Stored event %s (%s) until a run waits for it %s", name, req.CorrelationID, statusINFO)
+	} else {
+		log.Printf("Delivered event %s to %d run(s) %s", name, len(runIDs), statusINFO)
+	}
+	s.poke()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string][]string{"runs": append([]string{}, runIDs...)})
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/octo-agent/go-ai-agent-v1/orchestrator/engine"
+)
+
+// exitCancelled is the exit code of a run stopped by SIGINT/SIGTERM
+const exitCancelled = 130
+
+// withSignals returns a context that is cancelled by the first SIGINT or
+// SIGTERM. Later signals are logged and otherwise ignored so that cleanup can
+// finish; a supervising process is expected to escalate after the grace period.
+func withSignals(parent context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(parent)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		for sig := range signals {
+			if ctx.Err() == nil {
+				log.Printf("Received %s, cancelling %s", sig, statusWARN)
+				cancel(engine.SignalError{Signal: sig})
+			} else {
+				log.Printf("Received %s again, still shutting down %s", sig, statusWARN)
+			}
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		close(signals)
+		cancel(nil)
+	}
+}
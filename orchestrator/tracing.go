@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// traceFileEnvVar selects the JSON file exporter; spans are appended to the
+// named file, one JSON object per span
+const traceFileEnvVar = "OCTA_TRACE_FILE"
+
+// initTracing installs a trace provider exporting to the file named by
+// OCTA_TRACE_FILE, or over OTLP/HTTP when an OTEL_EXPORTER_OTLP_ENDPOINT or
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is configured. Without either, tracing
+// stays disabled. The returned function flushes and stops the exporter.
+func initTracing() func() {
+	exporter, err := newSpanExporter()
+	if err != nil {
+		log.Printf("Tracing disabled: %v %s", err, statusWARN)
+		return func() {}
+	}
+	if exporter == nil {
+		return func() {}
+	}
+
+	res, err := resource.New(context.Background(),
+		resource.WithAttributes(attribute.String("service.name", "octa-orchestrator")),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		log.Printf("Incomplete trace resource: %v %s", err, statusWARN)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := provider.Shutdown(ctx); err != nil {
+			log.Printf("Failed to flush traces: %v %s", err, statusWARN)
+		}
+	}
+}
+
+// newSpanExporter creates the configured exporter, or nil if none is
+func newSpanExporter() (sdktrace.SpanExporter, error) {
+	if path := os.Getenv(traceFileEnvVar); path != "" {
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open trace file: %w", err)
+		}
+		return stdouttrace.New(stdouttrace.WithWriter(file))
+	}
+
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "" {
+		// The exporter reads its endpoint, headers and TLS settings from the
+		// standard OTEL_EXPORTER_OTLP_* variables
+		return otlptracehttp.New(context.Background())
+	}
+
+	return nil, nil
+}
+
+// contextFromEnv returns ctx carrying the trace context the orchestrator was
+// started with, so that a run started by a traced caller joins its trace
+func contextFromEnv(ctx context.Context) context.Context {
+	carrier := propagation.MapCarrier{
+		"traceparent": os.Getenv("TRACEPARENT"),
+		"tracestate":  os.Getenv("TRACESTATE"),
+	}
+	return propagation.TraceContext{}.Extract(ctx, carrier)
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/octo-agent/go-ai-agent-v1/orchestrator/engine"
+	"gopkg.in/yaml.v3"
+)
+
+// trigger is a running event source
+type trigger interface {
+	// Run sends a run request per event until ctx is cancelled
+	Run(ctx context.Context, runs chan<- runRequest)
+}
+
+// gitTriggerState is the last-seen commit persisted per repository and branch
+type gitTriggerState struct {
+	URL        string `yaml:"url"`
+	Branch     string `yaml:"branch"`
+	LastCommit string `yaml:"last_commit"`
+	UpdatedAt  string `yaml:"updated_at"`
+}
+
+// gitTrigger polls a repository through the watch-git action
+type gitTrigger struct {
+	engine *engine.Engine
+	config engine.GitTriggerV1
+	nudge  chan struct{}
+}
+
+func newGitTrigger(e *engine.Engine, config engine.GitTriggerV1) *gitTrigger {
+	if config.Branch == "" {
+		config.Branch = "main"
+	}
+	if config.Interval == 0 {
+		config.Interval = 60
+	}
+	if config.MaxCommits == 0 {
+		config.MaxCommits = 20
+	}
+	if config.Password == "" && config.PasswordEnv != "" {
+		config.Password = os.Getenv(config.PasswordEnv)
+	}
+
+	return &gitTrigger{
+		engine: e,
+		config: config,
+		nudge:  make(chan struct{}, 1),
+	}
+}
+
+// Poke schedules an immediate poll, e.g. after a push webhook arrived
+func (t *gitTrigger) Poke() {
+	select {
+	case t.nudge <- struct{}{}:
+	default:
+		// A poll is already pending
+	}
+}
+
+// Run polls until ctx is cancelled, sending a run request for new commits
+func (t *gitTrigger) Run(ctx context.Context, runs chan<- runRequest) {
+	ticker := time.NewTicker(time.Duration(t.config.Interval) * time.Second)
+	defer ticker.Stop()
+
+	log.Printf("Git trigger watching %s (%s) every %ds %s", t.config.URL, t.config.Branch, t.config.Interval, statusINFO)
+
+	for {
+		if err := t.poll(ctx, runs); err != nil {
+			log.Printf("Git trigger poll for %s failed: %v %s", t.config.URL, err, statusWARN)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-t.nudge:
+		}
+	}
+}
+
+// poll checks for commits newer than the persisted one
+func (t *gitTrigger) poll(ctx context.Context, runs chan<- runRequest) error {
+	stateKey := t.stateKey()
+
+	var state gitTriggerState
+	if err := t.engine.Store.Read(stateKey, &state); err != nil {
+		return err
+	}
+
+	input := map[string]interface{}{
+		"url":            t.config.URL,
+		"branch":         t.config.Branch,
+		"max_checks":     1,
+		"max_commits":    t.config.MaxCommits,
+		"exit_on_change": true,
+		"since_commit":   state.LastCommit,
+	}
+	if t.config.Username != "" {
+		input["username"] = t.config.Username
+		input["password"] = t.config.Password
+	}
+
+	inputYAML, err := yaml.Marshal(input)
+	if err != nil {
+		return fmt.Errorf("failed to marshal watch-git input: %w", err)
+	}
+
+	output, err := t.engine.RunAction(ctx, "watch-git", inputYAML)
+	if err != nil {
+		return err
+	}
+
+	lastCommit, _ := output["last_commit"].(string)
+	if lastCommit == "" || lastCommit == state.LastCommit {
+		return nil
+	}
+
+	changes, _ := output["changes"].([]interface{})
+	if state.LastCommit == "" {
+		// First time we see this repository: remember HEAD without replaying history
+		log.Printf("Git trigger recorded initial commit %s for %s %s", lastCommit, t.config.URL, statusINFO)
+		return t.saveState(stateKey, lastCommit)
+	}
+	if len(changes) == 0 {
+		return t.saveState(stateKey, lastCommit)
+	}
+
+	log.Printf("Git trigger detected %d new commit(s) on %s %s", len(changes), t.config.URL, statusINFO)
+	batches := [][]interface{}{changes}
+	if !t.config.Batch {
+		batches = batches[:0]
+		for _, change := range changes {
+			batches = append(batches, []interface{}{change})
+		}
+	}
+
+	// A commit counts as seen once its run has finished or suspended, so
+	// that commits queued when the server stops are run after a restart.
+	// Runs are made at most once: a failed run is logged, not retried.
+	for _, batch := range batches {
+		ok, runErr := t.enqueue(ctx, runs, batch)
+		if !ok {
+			return nil
+		}
+		hash := commitHash(batch)
+		if runErr != nil {
+			log.Printf("Git trigger run for commit %s on %s failed and will not be retried: %v %s", hash, t.config.URL, runErr, statusFAILED)
+		}
+		if hash != "" {
+			if err := t.saveState(stateKey, hash); err != nil {
+				return err
+			}
+		}
+	}
+
+	// watch-git reports at most max_commits commits, the oldest first
+	if hasMore, _ := output["has_more"].(bool); hasMore {
+		log.Printf("Git trigger has more than %d new commits on %s, polling again %s", t.config.MaxCommits, t.config.URL, statusINFO)
+		t.Poke()
+	}
+	return nil
+}
+
+// saveState persists the last commit runs have been made for
+func (t *gitTrigger) saveState(stateKey, lastCommit string) error {
+	return t.engine.Store.Write(stateKey, gitTriggerState{
+		URL:        t.config.URL,
+		Branch:     t.config.Branch,
+		LastCommit: lastCommit,
+		UpdatedAt:  time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// commitHash returns the hash of the newest of the given changes
+func commitHash(changes []interface{}) string {
+	if len(changes) == 0 {
+		return ""
+	}
+	latest, _ := changes[len(changes)-1].(map[string]interface{})
+	hash, _ := latest["commit_hash"].(string)
+	return hash
+}
+
+// enqueue sends a run request whose workflow data describes the given changes
+// and waits until the run has finished or suspended, returning the error of a
+// failed run. The top-level change fields are taken from the newest change. It
+// returns false if ctx was cancelled first.
+func (t *gitTrigger) enqueue(ctx context.Context, runs chan<- runRequest, changes []interface{}) (bool, error) {
+	if len(changes) == 0 {
+		return true, nil
+	}
+
+	data := map[string]interface{}{
+		"trigger":  "git",
+		"repo_url": t.config.URL,
+		"branch":   t.config.Branch,
+		"changes":  changes,
+	}
+	if latest, ok := changes[len(changes)-1].(map[string]interface{}); ok {
+		for key, value := range latest {
+			data[key] = value
+		}
+	}
+
+	done := make(chan error, 1)
+	select {
+	case runs <- runRequest{Source: "git:" + t.config.URL, Data: data, Done: done}:
+	case <-ctx.Done():
+		return false, nil
+	}
+	select {
+	case err := <-done:
+		// A run cut short by the shutdown is made again after a restart
+		return ctx.Err() == nil, err
+	case <-ctx.Done():
+		return false, nil
+	}
+}
+
+// stateKey returns the state store key for this trigger's repository and
+// branch
+func (t *gitTrigger) stateKey() string {
+	sum := sha256.Sum256([]byte(t.config.URL + "#" + t.config.Branch))
+	return "triggers/git/" + hex.EncodeToString(sum[:8]) + ".yaml"
+}
+
+// matches reports whether a push for repoURL and ref concerns this trigger.
+// Empty values match anything.
+func (t *gitTrigger) matches(repoURL, ref string) bool {
+	if ref != "" && ref != "refs/heads/"+t.config.Branch && ref != t.config.Branch {
+		return false
+	}
+	if repoURL != "" && normalizeRepoURL(repoURL) != normalizeRepoURL(t.config.URL) {
+		return false
+	}
+	return true
+}
+
+// normalizeRepoURL strips the parts that differ between clone and web URLs
+func normalizeRepoURL(url string) string {
+	for _, prefix := range []string{"https://", "http://", "ssh://", "git@"} {
+		url = strings.TrimPrefix(url, prefix)
+	}
+	url = strings.Replace(url, ":", "/", 1)
+	url = strings.TrimSuffix(url, "/")
+	return strings.ToLower(strings.TrimSuffix(url, ".git"))
+}
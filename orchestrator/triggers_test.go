@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/octo-agent/go-ai-agent-v1/orchestrator/engine"
+	"gopkg.in/yaml.v3"
+)
+
+// memStore is an in-memory engine.StateStore
+type memStore struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func (s *memStore) Read(key string, v interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if data, ok := s.data[key]; ok {
+		return yaml.Unmarshal(data, v)
+	}
+	return nil
+}
+
+func (s *memStore) Write(key string, v interface{}) error {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data == nil {
+		s.data = make(map[string][]byte)
+	}
+	s.data[key] = data
+	return nil
+}
+
+func (s *memStore) Create(key string, v interface{}) error {
+	s.mu.Lock()
+	_, exists := s.data[key]
+	s.mu.Unlock()
+	if exists {
+		return fs.ErrExist
+	}
+	return s.Write(key, v)
+}
+
+func (s *memStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, key)
+	return nil
+}
+
+func (s *memStore) List(pattern string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for key := range s.data {
+		if matched, _ := path.Match(pattern, key); matched {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (s *memStore) Lock(key string) (func(), error) {
+	return func() {}, nil
+}
+
+// fakeWatchGit answers watch-git requests with a canned output and records
+// the since_commit it was asked for
+type fakeWatchGit struct {
+	output map[string]interface{}
+	since  string
+}
+
+func (f *fakeWatchGit) RunAction(ctx context.Context, req engine.ActionRequest) (map[string]interface{}, error) {
+	var input map[string]interface{}
+	if err := yaml.Unmarshal(req.Input, &input); err != nil {
+		return nil, err
+	}
+	f.since, _ = input["since_commit"].(string)
+	return f.output, nil
+}
+
+// change returns a watch-git change for a commit
+func change(hash string) map[string]interface{} {
+	return map[string]interface{}{"commit_hash": hash, "message": "commit " + hash}
+}
+
+func TestGitTriggerPoll(t *testing.T) {
+	tests := []struct {
+		name       string
+		batch      bool
+		lastCommit string // Persisted before the poll
+		output     map[string]interface{}
+		runErr     error
+		wantRuns   [][]string // Commit hashes of each run
+		wantState  string
+		wantPoke   bool
+	}{
+		{
+			name:      "first poll records HEAD",
+			output:    map[string]interface{}{"last_commit": "a"},
+			wantState: "a",
+		},
+		{
+			name:      "first poll does not replay changes",
+			output:    map[string]interface{}{"last_commit": "b", "changes": []interface{}{change("b")}},
+			wantState: "b",
+		},
+		{
+			name:       "no new commits",
+			lastCommit: "a",
+			output:     map[string]interface{}{"last_commit": "a"},
+			wantState:  "a",
+		},
+		{
+			name:       "one run per commit",
+			lastCommit: "a",
+			output:     map[string]interface{}{"last_commit": "c", "changes": []interface{}{change("b"), change("c")}},
+			wantRuns:   [][]string{{"b"}, {"c"}},
+			wantState:  "c",
+		},
+		{
+			name:       "batch",
+			batch:      true,
+			lastCommit: "a",
+			output:     map[string]interface{}{"last_commit": "c", "changes": []interface{}{change("b"), change("c")}},
+			wantRuns:   [][]string{{"b", "c"}},
+			wantState:  "c",
+		},
+		{
+			name:       "state follows the reported changes",
+			lastCommit: "a",
+			output:     map[string]interface{}{"last_commit": "d", "changes": []interface{}{change("b")}},
+			wantRuns:   [][]string{{"b"}},
+			wantState:  "b",
+		},
+		{
+			name:       "failed runs are not retried",
+			lastCommit: "a",
+			output:     map[string]interface{}{"last_commit": "b", "changes": []interface{}{change("b")}},
+			runErr:     errors.New("boom"),
+			wantRuns:   [][]string{{"b"}},
+			wantState:  "b",
+		},
+		{
+			name:       "more commits waiting",
+			lastCommit: "a",
+			output:     map[string]interface{}{"last_commit": "b", "changes": []interface{}{change("b")}, "has_more": true},
+			wantRuns:   [][]string{{"b"}},
+			wantState:  "b",
+			wantPoke:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			watchGit := &fakeWatchGit{output: tt.output}
+			e := engine.New()
+			e.Logger = log.New(io.Discard, "", 0)
+			e.Store = &memStore{}
+			e.ActionDir = t.TempDir()
+			e.Runner = watchGit
+
+			trigger := newGitTrigger(e, engine.GitTriggerV1{URL: "https://example.com/repo.git", Batch: tt.batch})
+			if tt.lastCommit != "" {
+				if err := trigger.saveState(trigger.stateKey(), tt.lastCommit); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			runs := make(chan runRequest)
+			var got [][]string
+			served := make(chan struct{})
+			go func() {
+				defer close(served)
+				for req := range runs {
+					var hashes []string
+					for _, c := range req.Data["changes"].([]interface{}) {
+						hashes = append(hashes, c.(map[string]interface{})["commit_hash"].(string))
+					}
+					got = append(got, hashes)
+					req.Done <- tt.runErr
+					close(req.Done)
+				}
+			}()
+
+			err := trigger.poll(context.Background(), runs)
+			close(runs)
+			<-served
+			if err != nil {
+				t.Fatalf("poll: %v", err)
+			}
+
+			if watchGit.since != tt.lastCommit {
+				t.Errorf("since_commit = %q, want %q", watchGit.since, tt.lastCommit)
+			}
+			if len(got) != len(tt.wantRuns) {
+				t.Fatalf("runs = %v, want %v", got, tt.wantRuns)
+			}
+			for i := range got {
+				if len(got[i]) != len(tt.wantRuns[i]) {
+					t.Fatalf("runs = %v, want %v", got, tt.wantRuns)
+				}
+				for j := range got[i] {
+					if got[i][j] != tt.wantRuns[i][j] {
+						t.Fatalf("runs = %v, want %v", got, tt.wantRuns)
+					}
+				}
+			}
+
+			var state gitTriggerState
+			if err := e.Store.Read(trigger.stateKey(), &state); err != nil {
+				t.Fatal(err)
+			}
+			if state.LastCommit != tt.wantState {
+				t.Errorf("last_commit = %q, want %q", state.LastCommit, tt.wantState)
+			}
+
+			poked := len(trigger.nudge) > 0
+			if poked != tt.wantPoke {
+				t.Errorf("poked = %v, want %v", poked, tt.wantPoke)
+			}
+		})
+	}
+}
+
+func TestGitTriggerPollCancelled(t *testing.T) {
+	e := engine.New()
+	e.Logger = log.New(io.Discard, "", 0)
+	e.Store = &memStore{}
+	e.ActionDir = t.TempDir()
+	e.Runner = &fakeWatchGit{output: map[string]interface{}{"last_commit": "c", "changes": []interface{}{change("b"), change("c")}}}
+
+	trigger := newGitTrigger(e, engine.GitTriggerV1{URL: "https://example.com/repo.git"})
+	if err := trigger.saveState(trigger.stateKey(), "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first run is cut short by the shutdown, so no commit counts as seen
+	ctx, cancel := context.WithCancel(context.Background())
+	runs := make(chan runRequest)
+	go func() {
+		req := <-runs
+		cancel()
+		req.Done <- context.Canceled
+		close(req.Done)
+	}()
+	if err := trigger.poll(ctx, runs); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+
+	var state gitTriggerState
+	if err := e.Store.Read(trigger.stateKey(), &state); err != nil {
+		t.Fatal(err)
+	}
+	if state.LastCommit != "a" {
+		t.Errorf("last_commit = %q, want a", state.LastCommit)
+	}
+}
+
+func TestGitTriggerMatches(t *testing.T) {
+	trigger := &gitTrigger{config: engine.GitTriggerV1{URL: "https://github.com/Owner/Repo.git", Branch: "main"}}
+	tests := []struct {
+		repoURL, ref string
+		want         bool
+	}{
+		{"", "", true},
+		{"https://github.com/owner/repo", "refs/heads/main", true},
+		{"git@github.com:owner/repo.git", "main", true},
+		{"https://github.com/owner/repo.git", "refs/heads/dev", false},
+		{"https://github.com/owner/other.git", "refs/heads/main", false},
+	}
+	for _, tt := range tests {
+		if got := trigger.matches(tt.repoURL, tt.ref); got != tt.want {
+			t.Errorf("matches(%q, %q) = %v, want %v", tt.repoURL, tt.ref, got, tt.want)
+		}
+	}
+}